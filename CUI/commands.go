@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"TransAV1_CUI/transav1"
+)
+
+// --- サブコマンド ---
+// convert (変換) に加え、進捗状況の確認、変換の開始時に暗黙に行われる処理 (回復・クリーンアップ) と検証を単独で実行できる
+
+// command: サブコマンドの定義
+type command struct {
+	name  string
+	usage func()     // ヘルプメッセージ (-h) を表示する
+	flags func()     // flag.CommandLine にフラグを登録する
+	run   func() int // 実行し、終了コードを返す
+}
+
+// commands: サブコマンドの一覧 (先頭の convert はサブコマンド名を省略した場合に使用する)
+func commands() []command {
+	return []command{
+		{name: "convert", usage: printUsage, flags: registerConvertFlags, run: runConvert},
+		{name: "status", usage: printStatusUsage, flags: registerStatusFlags, run: runStatus}, // status.go
+		{name: "verify", usage: printVerifyUsage, flags: registerVerifyFlags, run: runVerify},
+		{name: "clean", usage: printCleanUsage, flags: registerCleanFlags, run: runClean},
+		{name: "recover", usage: printRecoverUsage, flags: registerRecoverFlags, run: runRecover},
+		{name: "doctor", usage: printDoctorUsage, flags: registerConvertFlags, run: runDoctor}, // 変換時と同じオプションを診断する
+	}
+}
+
+// selectCommand: 先頭の引数からサブコマンドを選び、残りの引数とともに返す
+// 先頭の引数がサブコマンド名でない場合 (従来のフラグのみの呼び出し) は convert とする
+func selectCommand(args []string) (command, []string) {
+	cmds := commands()
+	for _, cmd := range cmds {
+		if args[0] == cmd.name {
+			return cmd, args[1:]
+		}
+	}
+	return cmds[0], args
+}
+
+// registerLogFlags: 全サブコマンド共通のログ関連フラグを登録する
+func registerLogFlags() {
+	flag.BoolVar(&logToFile, "log", false, "ログをファイルにも書き出す")
+	flag.BoolVar(&debugMode, "debug", false, "詳細ログ出力")
+}
+
+// requireFlags: 必須のフラグが指定されているか確認し、なければヘルプを表示して終了する
+func requireFlags(needSource bool) {
+	if destDir == "" || (needSource && sourceDir == "") {
+		if needSource {
+			logger.Println("エラー: -s (入力元) と -o (出力先) は必須です。")
+		} else {
+			logger.Println("エラー: -o (出力先) は必須です。")
+		}
+		flag.CommandLine.Usage() // ヘルプを表示
+		os.Exit(1)
+	}
+}
+
+// printMaintenanceUsage: verify / clean / recover のヘルプメッセージを表示する (本文は各コマンドで指定)
+func printMaintenanceUsage(synopsis, body string) {
+	progName := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "使用法 (Usage):\n  %s %s\n\n%s\nオプション:\n", progName, synopsis, body)
+	flag.CommandLine.PrintDefaults()
+}
+
+// --- verify: 変換済みの出力の検証 ---
+
+// printVerifyUsage: verify のヘルプメッセージを表示する
+func printVerifyUsage() {
+	printMaintenanceUsage("verify -s <入力元ディレクトリ> -o <出力先ディレクトリ> [オプション...]", `説明 (Description):
+  変換を行わずに、出力先の変換済みの動画を入力と比較して検証します (ffprobe が必要)。
+  ジャーナルがある場合は完了済みのエンコード・再多重化の出力を、ない場合は入力元の各動画に
+  対応する出力 (「`+transav1.OutputSuffix+`」形式、-container の指定に従う) を対象とします。
+  検証に失敗した出力には「出力ファイル名`+transav1.VerifySuffix+`」マーカーを作成し、ジャーナル上は失敗として
+  記録します。これらは次回の convert (または clean) で再変換の対象に戻ります。
+  失敗が1件でもある場合は終了コード 1 で終了します。
+`)
+}
+
+// registerVerifyFlags: verify のフラグを登録する
+func registerVerifyFlags() {
+	flag.StringVar(&sourceDir, "s", "", "入力元ディレクトリ (必須)")
+	flag.StringVar(&destDir, "o", "", "出力先ディレクトリ (必須)")
+	flag.StringVar(&ffmpegDir, "ffmpegdir", defaultFfmpegDir, "ffmpeg/ffprobe 格納ディレクトリ")
+	flag.StringVar(&ffmpegPriority, "priority", defaultPriority, "ffmpeg/ffprobe の優先度 (idle|BelowNormal|Normal|AboveNormal)")
+	flag.StringVar(&verifyFlag, "verify", defaultVerify, "検証の方法 (probe: 再生時間とストリーム数, decode: probe に加えて出力全体をデコード)")
+	flag.Float64Var(&verifyToleranceSeconds, "verifytol", defaultVerifyTol, "許容する入力と出力の再生時間の差 (秒)")
+	flag.IntVar(&timeoutSeconds, "timeout", defaultTimeout, "デコード確認 1件あたりのタイムアウト秒数 (0で無効)")
+	registerFilterFlags()
+	flag.StringVar(&collisionFlag, "collision", defaultCollision, "出力名が衝突した場合の扱い (number|ext|fail, 変換時と揃える)")
+	flag.StringVar(&containerFlag, "container", defaultContainer, "出力のコンテナ (mp4|mkv|webm|auto, 変換時と揃える)")
+	flag.StringVar(&configPath, "config", "", "JSON 設定ファイル (拡張子ごとの扱い \"extensions\" を変換時と揃える)")
+	flag.BoolVar(&sniffFlag, "sniff", false, "拡張子が未知のファイルを ffprobe で調べ、動画であれば対象とする")
+	registerStreamFlags()
+	registerLogFlags()
+}
+
+// runVerify: verify サブコマンドを実行し、終了コードを返す
+func runVerify() int {
+	setupLogging(destDir, startTime, logToFile, debugMode)
+	requireFlags(true)
+	normalizePaths()
+	locateFFmpeg()
+
+	cfg := transav1.DefaultConfig()
+	cfg.FFmpegPath, cfg.FFprobePath, cfg.Priority = ffmpegPath, ffprobePath, ffmpegPriority
+	cfg.Timeout = time.Duration(timeoutSeconds) * time.Second
+	cfg.Verify = transav1.VerifyMode(verifyFlag)
+	cfg.VerifyTolerance = time.Duration(verifyToleranceSeconds * float64(time.Second))
+	applyFilterFlags(&cfg)
+	applyClassifyConfig(&cfg, loadConfigFlag())
+	cfg.Collision = transav1.CollisionPolicy(collisionFlag)
+	cfg.Container = transav1.Container(containerFlag)
+	applyStreamFlags(&cfg)
+	cfg.Logger = logger
+	if debugMode {
+		cfg.DebugLogger = debugLogger
+	}
+	converter, err := transav1.New(cfg)
+	if err != nil {
+		logger.Fatalf("エラー: %v", err)
+	}
+
+	ctx, stopInterruptHandler := setupInterruptHandler()
+	defer stopInterruptHandler()
+	report, err := converter.VerifyTree(ctx, sourceDir, destDir)
+	if err != nil {
+		stopInterruptHandler()
+		logger.Fatalf("エラー: %v", err)
+	}
+	return finishReport(report)
+}
+
+// --- clean: 失敗マーカーと不完全な出力の削除 ---
+
+// printCleanUsage: clean のヘルプメッセージを表示する
+func printCleanUsage() {
+	printMaintenanceUsage("clean -o <出力先ディレクトリ> [-force]", `説明 (Description):
+  変換を行わずに、convert -restart が変換の開始前に行う処理のみを実行します。
+  ジャーナルがある場合は、失敗・タイムアウト・中断した動画と出力が欠けた動画の失敗マーカーと
+  不完全な出力を削除して未処理に戻します。ジャーナルがない出力先では、マーカーファイル
+  (*.failed, *.timeout など) とサイズ 0 の動画ファイルを削除します。
+  -force を指定した場合は、対話的に確認した後、出力先ディレクトリを完全に削除します。
+`)
+}
+
+// registerCleanFlags: clean のフラグを登録する
+func registerCleanFlags() {
+	flag.StringVar(&destDir, "o", "", "出力先ディレクトリ (必須)")
+	flag.BoolVar(&forceStart, "force", false, "出力先ディレクトリを完全に削除する (確認あり)")
+	registerLogFlags()
+}
+
+// runClean: clean サブコマンドを実行し、終了コードを返す
+func runClean() int {
+	// -force で削除する出力先にはログファイルを作成しない
+	setupLogging(destDir, startTime, logToFile && !forceStart, debugMode)
+	requireFlags(false)
+	normalizePaths()
+
+	if forceStart {
+		if _, err := os.Stat(destDir); os.IsNotExist(err) {
+			logger.Println("情報: 出力ディレクトリが存在しないため、削除するものはありません。")
+			return 0
+		}
+		removeDestDir(destDir)
+		return 0
+	}
+
+	cfg := transav1.DefaultConfig()
+	cfg.Logger = logger
+	if debugMode {
+		cfg.DebugLogger = debugLogger
+	}
+	ctx, stopInterruptHandler := setupInterruptHandler()
+	defer stopInterruptHandler()
+	report, err := transav1.CleanTree(ctx, cfg, destDir)
+	if err != nil {
+		stopInterruptHandler()
+		logger.Fatalf("エラー: %v", err)
+	}
+	return finishReport(report)
+}
+
+// --- recover: QuickMode で中断された動画の回復 ---
+
+// printRecoverUsage: recover のヘルプメッセージを表示する
+func printRecoverUsage() {
+	printMaintenanceUsage("recover -s <入力元ディレクトリ> -o <出力先ディレクトリ>", `説明 (Description):
+  変換を行わずに、convert が変換の開始時に行う QuickMode (-quick) の回復処理のみを実行します。
+  強制終了などで「.processing」の名前のまま残った入力元の動画を元の名前に戻し、
+  不完全な出力を削除して未処理に戻します。
+  回復できなかった動画 (手動での確認が必要) がある場合は終了コード 1 で終了します。
+`)
+}
+
+// registerRecoverFlags: recover のフラグを登録する
+func registerRecoverFlags() {
+	flag.StringVar(&sourceDir, "s", "", "入力元ディレクトリ (必須)")
+	flag.StringVar(&destDir, "o", "", "出力先ディレクトリ (必須)")
+	registerLogFlags()
+}
+
+// runRecover: recover サブコマンドを実行し、終了コードを返す
+func runRecover() int {
+	setupLogging(destDir, startTime, logToFile, debugMode)
+	requireFlags(true)
+	normalizePaths()
+
+	cfg := transav1.DefaultConfig()
+	cfg.Logger = logger
+	if debugMode {
+		cfg.DebugLogger = debugLogger
+	}
+	ctx, stopInterruptHandler := setupInterruptHandler()
+	defer stopInterruptHandler()
+	report, err := transav1.RecoverTree(ctx, cfg, sourceDir, destDir)
+	if err != nil {
+		stopInterruptHandler()
+		logger.Fatalf("エラー: %v", err)
+	}
+	return finishReport(report)
+}
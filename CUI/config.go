@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"TransAV1_CUI/transav1"
+)
+
+// --- 設定ファイル (-config) ---
+
+// fileConfig: -config で指定する JSON 設定ファイルの内容
+//
+//	{
+//	  "encoders": [
+//	    {"name": "av1_nvenc", "options": "-cq 25 -preset p5", "timeout": 3600, "retry_on_timeout": true},
+//	    {"name": "av1_qsv", "options": "-global_quality 25", "args": ["-vf", "scale=1280:-2, fps=30"]},
+//	    {"name": "libsvtav1", "options": "-crf 28 -preset 7"}
+//	  ],
+//	  "extensions": {".vob": "encode", ".ts": "copy", ".nfo": "ignore", ".jpg": "convert-image"},
+//	  "sniff": true,
+//	  "image_encoder": "libaom-av1",
+//	  "image_options": "-crf 30 -still-picture 1"
+//	}
+type fileConfig struct {
+	Encoders     []encoderConfig   `json:"encoders"`      // エンコーダチェーン (試行順)
+	Extensions   map[string]string `json:"extensions"`    // 拡張子ごとの扱い (encode|copy|ignore|convert-image)
+	Sniff        bool              `json:"sniff"`         // 拡張子が未知のファイルを ffprobe で調べる (-sniff と同じ)
+	ImageEncoder string            `json:"image_encoder"` // convert-image に使用するエンコーダ
+	ImageOptions string            `json:"image_options"` // convert-image に使用するエンコーダオプション
+}
+
+// encoderConfig: 設定ファイル中のエンコーダチェーンの1段
+type encoderConfig struct {
+	Name           string   `json:"name"`
+	Options        string   `json:"options"`
+	Args           []string `json:"args"`             // options の後に1要素ずつそのまま渡す引数
+	Timeout        int      `json:"timeout"`          // タイムアウト秒数 (0: -timeout を使用, 負の値: タイムアウトなし)
+	RetryOnTimeout bool     `json:"retry_on_timeout"` // タイムアウトした場合も次のエンコーダで再試行するか
+}
+
+// loadFileConfig: JSON 設定ファイルを読み込む (未知のキーはエラーとする)
+func loadFileConfig(path string) (*fileConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイル '%s' を開けません: %w", path, err)
+	}
+	defer f.Close()
+
+	var cfg fileConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields() // キー名の誤りを黙って無視しない
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("設定ファイル '%s' の解析に失敗: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// loadConfigFlag: -config が指定されていれば設定ファイルを読み込む (読み込めない場合は終了する)
+func loadConfigFlag() *fileConfig {
+	if configPath == "" {
+		return nil
+	}
+	fileCfg, err := loadFileConfig(configPath)
+	if err != nil {
+		logger.Fatalf("エラー: %v", err)
+	}
+	logger.Printf("情報: 設定ファイルを読み込みました: %s", configPath)
+	return fileCfg
+}
+
+// encoderChain: 設定ファイルのエンコーダチェーンを transav1.Encoder に変換する
+func (c *fileConfig) encoderChain() []transav1.Encoder {
+	var chain []transav1.Encoder
+	for _, e := range c.Encoders {
+		chain = append(chain, transav1.Encoder{
+			Name: e.Name, Options: e.Options, Args: e.Args,
+			Timeout: secondsToTimeout(e.Timeout), RetryOnTimeout: e.RetryOnTimeout,
+		})
+	}
+	return chain
+}
+
+// secondsToTimeout: 段ごとのタイムアウト秒数を transav1.Encoder.Timeout に変換する
+// (0: -timeout を使用, 負の値: タイムアウトなし)
+func secondsToTimeout(seconds int) time.Duration {
+	if seconds < 0 {
+		return -1
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// --- コマンドラインでのエンコーダチェーン指定 (-encoder / -encopt / -encarg / -enctimeout / -encretry) ---
+// -encoder を指定した順にチェーンの段が追加され、-encopt などは直前の -encoder の段に適用される
+//   例: -encoder av1_nvenc -encopt "-cq 25" -enctimeout 3600 -encretry -encoder libsvtav1 -encopt "-crf 28"
+
+// errNoEncoder: -encoder より前に段の設定が指定された場合のエラー
+var errNoEncoder = errors.New("先に -encoder でエンコーダ名を指定してください")
+
+// encoderChainFlag: コマンドラインで指定されたエンコーダチェーン
+type encoderChainFlag []transav1.Encoder
+
+// last: 直前に追加された段を返す
+func (c *encoderChainFlag) last() (*transav1.Encoder, error) {
+	if len(*c) == 0 {
+		return nil, errNoEncoder
+	}
+	return &(*c)[len(*c)-1], nil
+}
+
+// encoderNameValue: -encoder (チェーンに段を追加する)
+type encoderNameValue struct{ chain *encoderChainFlag }
+
+func (v encoderNameValue) String() string { return "" }
+
+func (v encoderNameValue) Set(s string) error {
+	name := strings.TrimSpace(s)
+	if name == "" {
+		return errors.New("エンコーダ名が空です")
+	}
+	*v.chain = append(*v.chain, transav1.Encoder{Name: name})
+	return nil
+}
+
+// encoderOptionsValue: -encopt (直前の段のオプション)
+type encoderOptionsValue struct{ chain *encoderChainFlag }
+
+func (v encoderOptionsValue) String() string { return "" }
+
+func (v encoderOptionsValue) Set(s string) error {
+	enc, err := v.chain.last()
+	if err != nil {
+		return err
+	}
+	enc.Options = s
+	return nil
+}
+
+// encoderTimeoutValue: -enctimeout (直前の段のタイムアウト秒数)
+type encoderTimeoutValue struct{ chain *encoderChainFlag }
+
+func (v encoderTimeoutValue) String() string { return "" }
+
+func (v encoderTimeoutValue) Set(s string) error {
+	enc, err := v.chain.last()
+	if err != nil {
+		return err
+	}
+	seconds, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("秒数を整数で指定してください: '%s'", s)
+	}
+	enc.Timeout = secondsToTimeout(seconds)
+	return nil
+}
+
+// encoderArgValue: -encarg (直前の段に引数を1つ追加する, 分割・引用符の解釈は行わない)
+type encoderArgValue struct{ chain *encoderChainFlag }
+
+func (v encoderArgValue) String() string { return "" }
+
+func (v encoderArgValue) Set(s string) error {
+	enc, err := v.chain.last()
+	if err != nil {
+		return err
+	}
+	enc.Args = append(enc.Args, s)
+	return nil
+}
+
+// encoderRetryValue: -encretry (直前の段がタイムアウトした場合も次の段で再試行する)
+type encoderRetryValue struct{ chain *encoderChainFlag }
+
+func (v encoderRetryValue) String() string   { return "false" }
+func (v encoderRetryValue) IsBoolFlag() bool { return true }
+
+func (v encoderRetryValue) Set(s string) error {
+	enc, err := v.chain.last()
+	if err != nil {
+		return err
+	}
+	retry, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("true または false を指定してください: '%s'", s)
+	}
+	enc.RetryOnTimeout = retry
+	return nil
+}
+
+// registerEncoderChainFlags: エンコーダチェーン指定用のフラグを登録する
+func registerEncoderChainFlags(chain *encoderChainFlag) {
+	flag.Var(encoderNameValue{chain}, "encoder", "エンコーダチェーンに段を追加 (指定順に試行, 複数指定可)")
+	flag.Var(encoderOptionsValue{chain}, "encopt", "直前の -encoder 用の追加ffmpegオプション")
+	flag.Var(encoderArgValue{chain}, "encarg", "直前の -encoder に追加する引数 (1つずつ, 複数指定可)")
+	flag.Var(encoderTimeoutValue{chain}, "enctimeout", "直前の -encoder のタイムアウト秒数 (0: -timeout, -1: 無効)")
+	flag.Var(encoderRetryValue{chain}, "encretry", "直前の -encoder がタイムアウトしても次の段で再試行する")
+}
+
+// --- エンコーダチェーンの決定 ---
+
+// resolveEncoderChain: 使用するエンコーダチェーンとその指定元を決定する
+// 優先順位: コマンドラインの -encoder > 設定ファイルの "encoders" > 従来の -hwenc/-hwopt/-cpuenc/-cpuopt
+func resolveEncoderChain(cliChain encoderChainFlag, fileCfg *fileConfig) ([]transav1.Encoder, string) {
+	if len(cliChain) > 0 {
+		return cliChain, "-encoder"
+	}
+	if fileCfg != nil && len(fileCfg.Encoders) > 0 {
+		return fileCfg.encoderChain(), "-config"
+	}
+	var chain []transav1.Encoder
+	if hwEncoder != "" {
+		chain = append(chain, transav1.Encoder{Name: hwEncoder, Options: hwEncoderOptions, Args: hwEncoderArgs})
+	}
+	if cpuEncoder != "" {
+		chain = append(chain, transav1.Encoder{Name: cpuEncoder, Options: cpuEncoderOptions, Args: cpuEncoderArgs})
+	}
+	return chain, "-hwenc/-cpuenc"
+}
+
+// legacyEncoderFlagsSet: 従来のエンコーダ指定フラグ (-hwenc など) が明示的に指定されたか
+func legacyEncoderFlagsSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "hwenc", "hwopt", "hwarg", "cpuenc", "cpuopt", "cpuarg":
+			set = true
+		}
+	})
+	return set
+}
+
+// stringListFlag: 複数回指定できる文字列フラグ (-hwarg / -cpuarg, 指定順に追加する)
+type stringListFlag []string
+
+func (l *stringListFlag) String() string { return strings.Join(*l, " ") }
+
+func (l *stringListFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// --- 処理対象の絞り込み (-include / -exclude / -excludefile / -nodefaultexclude) ---
+
+var (
+	includePatterns   stringListFlag // 処理対象とするファイルのパターン (-include)
+	excludePatterns   stringListFlag // 除外するファイル・ディレクトリのパターン (-exclude)
+	excludeFile       string         // 除外パターンを記述したファイル (-excludefile)
+	noDefaultExcludes bool           // 既定の除外 (OS が作成するファイルなど) を無効にするか
+)
+
+// registerFilterFlags: 処理対象の絞り込みのフラグを登録する (convert / doctor / status / verify)
+func registerFilterFlags() {
+	flag.Var(&includePatterns, "include", "処理対象とするファイルのパターン (入力元からの相対パス, 複数指定可)")
+	flag.Var(&excludePatterns, "exclude", "除外するファイル・ディレクトリのパターン (入力元からの相対パス, 複数指定可)")
+	flag.StringVar(&excludeFile, "excludefile", "", "除外パターンを1行に1つずつ記述したファイル")
+	flag.BoolVar(&noDefaultExcludes, "nodefaultexclude", false, "OS が作成するファイル (Thumbs.db, .DS_Store など) を既定で除外しない")
+}
+
+// filterPatterns: -include / -exclude / -excludefile の指定からパターンを求める
+func filterPatterns() (include, exclude []string, err error) {
+	exclude = excludePatterns
+	if excludeFile != "" {
+		patterns, err := transav1.ReadPatternFile(excludeFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		exclude = append(exclude, patterns...)
+	}
+	return includePatterns, exclude, nil
+}
+
+// applyFilterFlags: 処理対象の絞り込みの指定を cfg に設定する (パターンの検証は transav1.New などで行われる)
+func applyFilterFlags(cfg *transav1.Config) {
+	include, exclude, err := filterPatterns()
+	if err != nil {
+		logger.Fatalf("エラー: %v", err)
+	}
+	cfg.Include, cfg.Exclude, cfg.NoDefaultExcludes = include, exclude, noDefaultExcludes
+	if len(include) > 0 {
+		logger.Printf("情報: 処理対象のパターン: %s", strings.Join(include, ", "))
+	}
+	if len(exclude) > 0 {
+		logger.Printf("情報: 除外パターン: %s", strings.Join(exclude, ", "))
+	}
+}
+
+// --- ファイルの分類 (設定ファイルの "extensions" など / -sniff) ---
+
+var sniffFlag bool // 拡張子が未知のファイルを ffprobe で調べるか (-sniff)
+
+// applyClassifyConfig: ファイルの分類の指定を cfg に設定する (扱いの値の検証は transav1.New などで行われる)
+func applyClassifyConfig(cfg *transav1.Config, fileCfg *fileConfig) {
+	cfg.Sniff = sniffFlag
+	if fileCfg != nil {
+		if len(fileCfg.Extensions) > 0 {
+			cfg.Extensions = make(map[string]transav1.FileClass, len(fileCfg.Extensions))
+			labels := make([]string, 0, len(fileCfg.Extensions))
+			for ext, class := range fileCfg.Extensions {
+				cfg.Extensions[ext] = transav1.FileClass(class)
+				labels = append(labels, ext+": "+class)
+			}
+			sort.Strings(labels)
+			logger.Printf("情報: 拡張子ごとの扱い: %s", strings.Join(labels, ", "))
+		}
+		cfg.Sniff = cfg.Sniff || fileCfg.Sniff
+		if fileCfg.ImageEncoder != "" {
+			cfg.ImageEncoder = fileCfg.ImageEncoder
+		}
+		if fileCfg.ImageOptions != "" {
+			cfg.ImageOptions = fileCfg.ImageOptions
+		}
+	}
+	if cfg.Sniff {
+		logger.Println("情報: 拡張子が未知のファイルは内容を調べ、動画であればエンコードします (-sniff)。")
+	}
+}
+
+// --- 出力に含めるストリーム (-streams / -langs) ---
+
+// registerStreamFlags: ストリームの選び方のフラグを登録する (convert / verify)
+func registerStreamFlags() {
+	flag.StringVar(&streamsFlag, "streams", defaultStreams, "出力に含めるストリーム (all|audio|lang|first)")
+	flag.StringVar(&languagesFlag, "langs", "", "-streams lang で残す音声・字幕の言語 (カンマ区切り, 例: jpn,eng)")
+}
+
+// applyStreamFlags: ストリームの選び方の指定を cfg に設定する (値の検証は transav1.New で行われる)
+func applyStreamFlags(cfg *transav1.Config) {
+	cfg.Streams = transav1.StreamPolicy(streamsFlag)
+	cfg.Languages = nil
+	if languagesFlag != "" {
+		cfg.Languages = strings.Split(languagesFlag, ",")
+	}
+}
+
+// validateEncoderChain: エンコーダチェーンの各段のオプションを検証する
+// (検出処理でエンコーダごと除外されて設定の誤りが見過ごされないよう、検出前に確認する)
+func validateEncoderChain(chain []transav1.Encoder) error {
+	for _, enc := range chain {
+		if err := enc.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
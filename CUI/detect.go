@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+
+	"TransAV1_CUI/transav1"
+)
+
+// detectEncoderChain: ffmpeg で実際に使用できるエンコーダを検出し、使用するエンコーダチェーンを決定する (-detect)
+// explicit が true (チェーンが明示的に指定された) の場合は、指定されたチェーンから使用できない段を除く
+// false (デフォルトのチェーン) の場合は、既知の AV1 エンコーダのうち使用できる HW エンコーダ全てと
+// 最初に使用できる CPU エンコーダでチェーンを構成する
+// エンコーダ一覧を取得できない場合は検出を行わず、元のチェーンをそのまま返す
+func detectEncoderChain(chain []transav1.Encoder, explicit bool) []transav1.Encoder {
+	candidates := chain
+	if !explicit {
+		candidates = transav1.KnownAV1Encoders()
+	}
+	logger.Printf("情報: 使用可能なエンコーダを検出しています (%d 件)...", len(candidates))
+	statuses, err := transav1.DetectEncoders(context.Background(), ffmpegPath, candidates)
+	if err != nil {
+		logger.Printf("警告: エンコーダの検出に失敗したため、指定されたチェーンをそのまま使用します: %v", err)
+		return chain
+	}
+
+	var detected []transav1.Encoder
+	hasCPU := false
+	for _, s := range statuses {
+		name := s.Encoder.Name
+		switch {
+		case !s.Usable:
+			logger.Printf("情報: エンコーダ %s を除外しました: %s", name, s.Reason)
+		case !explicit && !s.Encoder.Hardware() && hasCPU:
+			// 自動構成では CPU エンコーダは1つで十分 (失敗時に低速なエンコーダを何度も試行しない)
+			logger.Printf("情報: エンコーダ %s は使用可能ですが、CPU エンコーダは既にチェーンにあるため使用しません", name)
+		default:
+			debugLogPrintf("エンコーダ %s: 使用可能", name)
+			detected = append(detected, s.Encoder)
+			hasCPU = hasCPU || !s.Encoder.Hardware()
+		}
+	}
+	if len(detected) == 0 {
+		logger.Fatalf("エラー: 使用可能なエンコーダがありません。ffmpeg (%s) のビルドとドライバを確認してください。", ffmpegPath)
+	}
+	return detected
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeDiskSpace: 未対応 OS では空き容量を取得できない
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("空き容量の取得は %s では未対応です", runtime.GOOS)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace: パスを含むドライブの、現在のユーザーが利用可能な空き容量 (バイト) を返す
+func freeDiskSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeAvailable, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &freeAvailable, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return freeAvailable, nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"TransAV1_CUI/transav1"
+)
+
+// doctorMinFreeSpace: 入力元が指定されていない場合に求める最低限の空き容量
+const doctorMinFreeSpace = 1 << 30 // 1 GiB
+
+// doctorStatus: 診断項目の結果
+type doctorStatus int
+
+const (
+	doctorOK   doctorStatus = iota // 問題なし
+	doctorWarn                     // 動作はするが注意が必要
+	doctorFail                     // 変換の途中で失敗する原因となる問題
+	doctorSkip                     // 前提となる項目が未指定・失敗のため確認しなかった
+)
+
+// label: 表に表示する結果の名称
+func (s doctorStatus) label() string {
+	switch s {
+	case doctorOK:
+		return " OK "
+	case doctorWarn:
+		return "WARN"
+	case doctorFail:
+		return "FAIL"
+	}
+	return " -- "
+}
+
+// doctorCheck: 診断項目1件
+type doctorCheck struct {
+	status doctorStatus
+	name   string
+	detail string
+}
+
+// doctorReport: 診断結果の一覧
+type doctorReport struct {
+	checks []doctorCheck
+}
+
+// add: 診断結果を追加する
+func (d *doctorReport) add(status doctorStatus, name, format string, v ...interface{}) {
+	d.checks = append(d.checks, doctorCheck{status: status, name: name, detail: fmt.Sprintf(format, v...)})
+}
+
+// count: 指定した結果の項目数を返す
+func (d *doctorReport) count(status doctorStatus) int {
+	n := 0
+	for _, c := range d.checks {
+		if c.status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// print: 診断結果を表形式で出力する
+func (d *doctorReport) print() {
+	width := 0
+	for _, c := range d.checks {
+		width = max(width, displayWidth(c.name))
+	}
+	fmt.Println("診断結果:")
+	for _, c := range d.checks {
+		pad := strings.Repeat(" ", width-displayWidth(c.name))
+		fmt.Printf("  [%s] %s%s  %s\n", c.status.label(), c.name, pad, c.detail)
+	}
+	fmt.Printf("\n問題: %d 件, 警告: %d 件\n", d.count(doctorFail), d.count(doctorWarn))
+}
+
+// displayWidth: 端末上の表示幅 (全角文字を 2 として数える) を返す
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if r >= 0x2E80 { // CJK 記号・かな・漢字・全角形など
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+// --- printDoctorUsage 関数: doctor のヘルプメッセージを表示 ---
+func printDoctorUsage() {
+	progName := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, `使用法 (Usage):
+  %s doctor [-s <入力元>] [-o <出力先>] [オプション...]
+
+説明 (Description):
+  変換を行わずに、実行環境と設定を事前に診断して結果を表で表示します。
+  問題 (FAIL) が1件でもある場合は終了コード 1 で終了します。
+  変換時と同じオプションを指定すると、その設定で問題がないかを確認できます。
+
+診断項目:
+  - ffmpeg / ffprobe が見つかるか、そのバージョン
+  - エンコーダチェーンの各エンコーダが使用できるか、-hwopt / -cpuopt / -encopt などの
+    オプションがエンコーダに受け付けられるか (合成映像のテストエンコードで確認)
+  - 入力元・出力先の存在と重複 (出力先が入力元の中にある、またはその逆)
+  - 出力先と一時ディレクトリ (-tempdir) への書き込み権限と空き容量
+    (入力元を指定した場合は、動画の合計サイズ・最大サイズから必要な容量を見積もります)
+
+主なオプション:
+  -s, -o, -ffmpegdir, -hwenc, -hwopt, -cpuenc, -cpuopt, -encoder, -encopt, -config,
+  -detect, -tempdir, -quick (各オプションの説明は %s -h を参照)
+`, progName, progName)
+}
+
+// runDoctor: 環境と設定を診断して結果を表示し、終了コードを返す (0: 問題なし, 1: 問題あり)
+func runDoctor() int {
+	rep := &doctorReport{}
+	ctx := context.Background()
+
+	// --- ffmpeg / ffprobe ---
+	ffmpeg, _, err := findTool(ffmpegDir, "ffmpeg")
+	if err != nil {
+		rep.add(doctorFail, "ffmpeg", "見つかりません (-ffmpegdir '%s' または 環境変数PATH)", ffmpegDir)
+		ffmpeg = ""
+	} else {
+		rep.add(doctorOK, "ffmpeg", "%s (%s)", ffmpeg, toolVersion(ctx, ffmpeg))
+	}
+	if ffprobe, _, err := findTool(ffmpegDir, "ffprobe"); err != nil {
+		rep.add(doctorFail, "ffprobe", "見つかりません。入力の事前検証、出力の検証、AV1 ソースの判定、進捗の割合表示が行われません")
+	} else {
+		rep.add(doctorOK, "ffprobe", "%s (%s)", ffprobe, toolVersion(ctx, ffprobe))
+	}
+
+	// --- エンコーダ ---
+	doctorEncoders(ctx, rep, ffmpeg)
+
+	// --- 処理対象の絞り込み ---
+	doctorFilters(rep)
+
+	// --- 入力元・出力先 ---
+	doctorPaths(rep)
+
+	rep.print()
+	if rep.count(doctorFail) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// toolVersion: "ffmpeg -version" の1行目からバージョン表記を取り出す (取得できない場合は "バージョン不明")
+func toolVersion(ctx context.Context, path string) string {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "-version").Output()
+	if err != nil {
+		return "バージョン不明"
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	line, _, _ = strings.Cut(line, " Copyright") // 例: "ffmpeg version 6.1.1 Copyright (c) ..."
+	if line = strings.TrimSpace(line); line == "" {
+		return "バージョン不明"
+	}
+	return line
+}
+
+// doctorEncoders: エンコーダチェーンの各エンコーダとオプションが使用できるかを診断する
+// チェーンが明示されていない場合 (-detect による自動構成) は既知の AV1 エンコーダを全て確認する
+func doctorEncoders(ctx context.Context, rep *doctorReport, ffmpeg string) {
+	var fileCfg *fileConfig
+	if configPath != "" {
+		cfg, err := loadFileConfig(configPath)
+		if err != nil {
+			rep.add(doctorFail, "設定ファイル", "%v", err)
+		} else {
+			rep.add(doctorOK, "設定ファイル", "%s", configPath)
+			fileCfg = cfg
+		}
+	}
+	if ffmpeg == "" {
+		rep.add(doctorSkip, "エンコーダ", "ffmpeg が見つからないため確認しません")
+		return
+	}
+	available, err := transav1.ListFFmpegEncoders(ctx, ffmpeg)
+	if err != nil {
+		rep.add(doctorFail, "エンコーダ一覧", "%v", err)
+		return
+	}
+
+	chain, source := resolveEncoderChain(encoderChainFlags, fileCfg)
+	explicit := source != "-hwenc/-cpuenc" || legacyEncoderFlagsSet()
+	if detectEncoders && !explicit {
+		// 自動構成: 使用できないエンコーダはチェーンから除かれるだけなので警告に留める
+		usable := 0
+		for _, enc := range transav1.KnownAV1Encoders() {
+			name := "エンコーダ " + enc.Name
+			if !available[enc.Name] {
+				rep.add(doctorWarn, name, "ffmpeg のビルドに含まれていません (自動構成では除外されます)")
+			} else if err := transav1.TestEncoder(ctx, ffmpeg, enc); err != nil {
+				rep.add(doctorWarn, name, "%v (自動構成では除外されます)", err)
+			} else {
+				rep.add(doctorOK, name, "使用可能 (%s)", enc.Options)
+				usable++
+			}
+		}
+		if usable == 0 {
+			rep.add(doctorFail, "エンコーダチェーン", "使用可能な AV1 エンコーダがありません")
+		}
+		return
+	}
+
+	if len(chain) == 0 {
+		rep.add(doctorFail, "エンコーダチェーン", "エンコーダが指定されていません")
+		return
+	}
+	rep.add(doctorOK, "エンコーダチェーン", "%s (%s)", strings.Join(transav1.EncoderNames(chain), " → "), source)
+	for _, enc := range chain {
+		name := "エンコーダ " + enc.Name
+		if !available[enc.Name] {
+			rep.add(doctorFail, name, "ffmpeg のビルドに含まれていません")
+			continue
+		}
+		if err := enc.Validate(); err != nil {
+			rep.add(doctorFail, name, "%v", err)
+			continue
+		}
+		err := transav1.TestEncoder(ctx, ffmpeg, enc)
+		if err == nil {
+			rep.add(doctorOK, name, "使用可能 (オプション \"%s\" を受け付けました)", enc.OptionsString())
+			continue
+		}
+		// オプションなしで成功するなら、オプションが受け付けられていない
+		if (enc.Options != "" || len(enc.Args) > 0) && transav1.TestEncoder(ctx, ffmpeg, transav1.Encoder{Name: enc.Name}) == nil {
+			rep.add(doctorFail, name, "オプション \"%s\" が受け付けられません: %v", enc.OptionsString(), err)
+		} else {
+			rep.add(doctorFail, name, "使用できません (GPU・ドライバを確認してください): %v", err)
+		}
+	}
+}
+
+// doctorFilters: -include / -exclude / -excludefile のパターンを診断する (指定がない場合は表示しない)
+func doctorFilters(rep *doctorReport) {
+	include, exclude, err := filterPatterns()
+	if err != nil {
+		rep.add(doctorFail, "除外パターン", "%v", err)
+		return
+	}
+	check := func(name string, patterns []string) {
+		if len(patterns) == 0 {
+			return
+		}
+		for _, pattern := range patterns {
+			if err := transav1.ValidatePattern(pattern); err != nil {
+				rep.add(doctorFail, name, "%v", err)
+				return
+			}
+		}
+		rep.add(doctorOK, name, "%s", strings.Join(patterns, ", "))
+	}
+	check("対象パターン", include)
+	check("除外パターン", exclude)
+}
+
+// doctorPaths: 入力元・出力先・一時ディレクトリの存在、重複、書き込み権限、空き容量を診断する
+func doctorPaths(rep *doctorReport) {
+	var src, dst string
+	var totalVideo, largestVideo, totalOther int64 // 入力元の動画の合計・最大サイズ、その他のファイルの合計サイズ
+	sourceKnown := false
+
+	if sourceDir == "" {
+		rep.add(doctorSkip, "入力元", "-s が指定されていないため確認しません")
+	} else if abs, err := filepath.Abs(filepath.Clean(sourceDir)); err != nil {
+		rep.add(doctorFail, "入力元", "パスの正規化に失敗: %v", err)
+	} else if info, err := os.Stat(abs); err != nil {
+		rep.add(doctorFail, "入力元", "%v", err)
+	} else {
+		src = abs
+		totalVideo, largestVideo, totalOther, err = sourceSizes(abs, info)
+		if err != nil {
+			rep.add(doctorWarn, "入力元", "%s (走査中にエラー: %v)", abs, err)
+		} else {
+			rep.add(doctorOK, "入力元", "%s (動画 %s, 最大 %s, その他 %s)", abs,
+				transav1.FormatSize(totalVideo), transav1.FormatSize(largestVideo), transav1.FormatSize(totalOther))
+		}
+		sourceKnown = true
+	}
+
+	if destDir == "" {
+		rep.add(doctorSkip, "出力先", "-o が指定されていないため確認しません")
+	} else if abs, err := filepath.Abs(filepath.Clean(destDir)); err != nil {
+		rep.add(doctorFail, "出力先", "パスの正規化に失敗: %v", err)
+	} else {
+		dst = abs
+		doctorWritable(rep, "出力先", abs)
+	}
+
+	// --- パスの重複 (シンボリックリンクを解決して比較する) ---
+	if src != "" && dst != "" {
+		src, dst := transav1.ResolvePath(src), transav1.ResolvePath(dst)
+		switch {
+		case src == dst:
+			rep.add(doctorFail, "パスの重複", "入力元と出力先が同じです")
+		case transav1.IsSubPath(src, dst):
+			rep.add(doctorWarn, "パスの重複", "出力先が入力元の中にあります (入力元の走査では出力先を除外します)")
+		case transav1.IsSubPath(dst, src):
+			rep.add(doctorFail, "パスの重複", "入力元が出力先の中にあります (-force で入力元も削除されます)")
+		default:
+			rep.add(doctorOK, "パスの重複", "なし")
+		}
+	}
+
+	// --- 一時ディレクトリ ---
+	tempDir := tempDirFlag
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	if quickModeFlag {
+		rep.add(doctorSkip, "一時ディレクトリ", "-quick 指定時は動画の一時コピーを行いません (%s)", tempDir)
+	} else {
+		doctorWritable(rep, "一時ディレクトリ", tempDir)
+		// 一時ディレクトリには入力のコピーと出力が同時に置かれる (全レーンの並列数分で警告, 1件分もなければ問題)
+		warnAt, failAt := int64(0), int64(0)
+		if sourceKnown {
+			failAt = largestVideo * 2
+			warnAt = failAt * int64(max(hwJobs, 1)+max(cpuJobs, 1))
+		}
+		doctorFreeSpace(rep, "空き容量 (一時)", tempDir, warnAt, failAt)
+	}
+
+	// --- 出力先の空き容量 ---
+	if dst != "" {
+		// 動画の出力は通常入力より小さいが、最悪の場合は入力と同じ大きさになる (その他のファイルはそのままコピー)
+		warnAt, failAt := int64(0), int64(0)
+		if sourceKnown {
+			warnAt, failAt = totalVideo+totalOther, largestVideo+totalOther
+		}
+		doctorFreeSpace(rep, "空き容量 (出力先)", dst, warnAt, failAt)
+	}
+}
+
+// sourceSizes: 入力元の動画の合計・最大サイズと、その他のファイルの合計サイズを返す
+func sourceSizes(path string, info os.FileInfo) (totalVideo, largestVideo, totalOther int64, err error) {
+	if !info.IsDir() {
+		return info.Size(), info.Size(), 0, nil
+	}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return nil // 読み取れないディレクトリは変換時にもスキップされる
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if transav1.IsVideoFile(p) {
+			totalVideo += fi.Size()
+			largestVideo = max(largestVideo, fi.Size())
+		} else {
+			totalOther += fi.Size()
+		}
+		return nil
+	})
+	return totalVideo, largestVideo, totalOther, err
+}
+
+// doctorWritable: ディレクトリ (存在しない場合は作成先となる最も近い既存の親) に書き込めるかを診断する
+func doctorWritable(rep *doctorReport, name, dir string) {
+	target := dir
+	for {
+		info, err := os.Stat(target)
+		if err == nil {
+			if !info.IsDir() {
+				rep.add(doctorFail, name, "%s はディレクトリではありません", target)
+				return
+			}
+			break
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			rep.add(doctorFail, name, "%s: 存在するディレクトリが見つかりません", dir)
+			return
+		}
+		target = parent
+	}
+	f, err := os.CreateTemp(target, ".transav1_doctor_")
+	if err != nil {
+		rep.add(doctorFail, name, "%s に書き込めません: %v", target, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	if target != dir {
+		rep.add(doctorOK, name, "%s (存在しないため作成されます。%s に書き込み可能)", dir, target)
+		return
+	}
+	rep.add(doctorOK, name, "%s (書き込み可能)", dir)
+}
+
+// doctorFreeSpace: 空き容量を診断する
+// warnAt / failAt: 空き容量がこれを下回る場合に警告 / 問題とする (0 の場合は doctorMinFreeSpace 未満で警告)
+func doctorFreeSpace(rep *doctorReport, name, dir string, warnAt, failAt int64) {
+	// 存在しない出力先は、作成先となる最も近い既存の親で確認する
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		rep.add(doctorWarn, name, "空き容量を取得できません: %v", err)
+		return
+	}
+	freeSize := transav1.FormatSize(int64(free))
+	switch {
+	case warnAt == 0 && free < doctorMinFreeSpace:
+		rep.add(doctorWarn, name, "%s (空き %s, %s 未満)", dir, freeSize, transav1.FormatSize(doctorMinFreeSpace))
+	case failAt > 0 && free < uint64(failAt):
+		rep.add(doctorFail, name, "%s (空き %s, 少なくとも %s 必要)", dir, freeSize, transav1.FormatSize(failAt))
+	case warnAt > 0 && free < uint64(warnAt):
+		rep.add(doctorWarn, name, "%s (空き %s, 最大で %s 必要になる可能性があります)", dir, freeSize, transav1.FormatSize(warnAt))
+	default:
+		rep.add(doctorOK, name, "%s (空き %s)", dir, freeSize)
+	}
+}
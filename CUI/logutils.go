@@ -11,9 +11,11 @@ import (
 
 // --- グローバル変数 (ロギング関連) ---
 var (
-	logger      *log.Logger // 通常ログ用ロガー (標準出力 +/- ファイル)
+	logger      *log.Logger // 通常ログ用ロガー (コンソール +/- ファイル)
 	debugLogger *log.Logger // デバッグログ用ロガー (デバッグモード時のみ有効)
 	logFile     *os.File    // ログファイルオブジェクト (ファイル出力時)
+	// consoleOut: ログのコンソール出力先 (-events json 指定時は標準出力をイベント専用にするため標準エラー出力)
+	consoleOut io.Writer = os.Stdout
 	// debugMode は main.go で管理され、引数で渡される
 )
 
@@ -24,7 +26,7 @@ var (
 // debugModeFlag: デバッグモードを有効にするかのフラグ (main から)
 func setupLogging(destDir string, startTime time.Time, logToFileFlag bool, debugModeFlag bool) {
 	// --- 標準ロガー (logger) の設定 ---
-	var logOutput io.Writer = os.Stdout
+	var logOutput io.Writer = consoleOut
 	logFilePath := ""
 
 	if logToFileFlag {
@@ -37,19 +39,19 @@ func setupLogging(destDir string, startTime time.Time, logToFileFlag bool, debug
 			// OpenFile で追記モード (O_APPEND) を使用
 			logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
-				// ログファイルが開けなかった場合は標準エラーに警告を出し、標準出力のみを使用
-				log.Printf("警告: ログファイル '%s' を開けません (%v)。ログは標準出力にのみ出力されます。\n", logFilePath, err)
+				// ログファイルが開けなかった場合は標準エラーに警告を出し、コンソールのみを使用
+				log.Printf("警告: ログファイル '%s' を開けません (%v)。ログはコンソールにのみ出力されます。\n", logFilePath, err)
 				logFile = nil // logFile を nil に設定
 			} else {
-				// ログファイルが開けた場合、標準出力とファイルの両方に書き込む MultiWriter を設定
-				logOutput = io.MultiWriter(os.Stdout, logFile)
+				// ログファイルが開けた場合、コンソールとファイルの両方に書き込む MultiWriter を設定
+				logOutput = io.MultiWriter(consoleOut, logFile)
 				// どのファイルにログが出力されるか標準出力に表示 (logger が初期化される前なので log.Printf を使用)
 				log.Printf("ログを '%s' にも出力します。\n", logFilePath)
 			}
 		} else {
 			// checkLogDir が false を返した場合 (ディレクトリがない、書き込めないなど)
 			// 警告は checkLogDir 内で出力されるので、ここでは何もしない
-			// logOutput は os.Stdout のまま
+			// logOutput は consoleOut のまま
 		}
 	}
 	// logger を初期化 (logOutput は logToFileFlag と checkLogDir の結果によって決まる)
@@ -61,11 +63,11 @@ func setupLogging(destDir string, startTime time.Time, logToFileFlag bool, debug
 	if debugModeFlag {
 		// デバッグモードが有効な場合
 		if logFile != nil {
-			// ログファイルが有効なら、標準出力とログファイルの両方にデバッグログを出力
-			debugOutput = io.MultiWriter(os.Stdout, logFile)
+			// ログファイルが有効なら、コンソールとログファイルの両方にデバッグログを出力
+			debugOutput = io.MultiWriter(consoleOut, logFile)
 		} else {
-			// ログファイルが無効なら、標準出力にのみデバッグログを出力
-			debugOutput = os.Stdout
+			// ログファイルが無効なら、コンソールにのみデバッグログを出力
+			debugOutput = consoleOut
 		}
 	}
 	// debugLogger を初期化 (debugOutput は debugModeFlag の状態によって決まる)
@@ -2,28 +2,41 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
+
+	"TransAV1_CUI/transav1"
 )
 
-// --- パッケージレベル定数 (デフォルト値) ---
+// --- パッケージレベル定数 (デフォルト値, エンジンの既定値は transav1 パッケージで定義) ---
 const (
 	defaultFfmpegDir = "." // カレントディレクトリ
-	defaultPriority  = "BelowNormal"
-	defaultHwEnc     = "av1_nvenc"
-	defaultCpuEnc    = "libsvtav1"
-	defaultHwOpt     = "-cq 25 -preset p5"
-	defaultCpuOpt    = "-crf 28 -preset 7"
-	defaultTimeout   = 7200
-	tempDirPrefix    = "go_transav1_" // 一時ディレクトリ名の接頭辞
-	originSuffix     = ".origin"      // QuickMode 回復用マーカーのサフィックス
+	defaultPriority  = transav1.DefaultPriority
+	defaultHwEnc     = transav1.DefaultHWEncoder
+	defaultCpuEnc    = transav1.DefaultCPUEncoder
+	defaultHwOpt     = transav1.DefaultHWOptions
+	defaultCpuOpt    = transav1.DefaultCPUOptions
+	defaultTimeout   = int(transav1.DefaultTimeout / time.Second)
+	defaultHwJobs    = transav1.DefaultHWJobs
+	defaultCpuJobs   = transav1.DefaultCPUJobs
+	defaultProgress  = int(transav1.DefaultProgressInterval / time.Second) // 進捗ログの出力間隔 (秒)
+	defaultAV1Source = string(transav1.DefaultAV1Source)
+	defaultMinSaving = transav1.DefaultMinSaving
+	defaultLarger    = string(transav1.DefaultLarger)
+	defaultCollision = string(transav1.DefaultCollision)
+	defaultSidecars  = string(transav1.DefaultSidecars)
+	defaultStreams   = string(transav1.DefaultStreams)
+	defaultContainer = string(transav1.DefaultContainer)
+	defaultRetryOpt  = transav1.DefaultRetryOptions
+	defaultVerify    = string(transav1.DefaultVerify)
+	defaultVerifyTol = float64(transav1.DefaultVerifyTolerance) / float64(time.Second) // 出力検証で許容する再生時間の差 (秒)
 )
 
 // --- グローバル変数 ---
@@ -32,22 +45,46 @@ var (
 	destDir   string // 出力先ディレクトリパス
 	ffmpegDir string // ffmpeg/ffprobe 格納ディレクトリパス
 
-	// ffmpeg 実行関連 (ffmpeg.go で主に使用)
-	ffmpegPriority    string // ffmpeg プロセスの優先度
-	hwEncoder         string // ハードウェアエンコーダ名
-	cpuEncoder        string // CPUエンコーダ名
-	hwEncoderOptions  string // HWエンコーダ用オプション
-	cpuEncoderOptions string // CPUエンコーダ用オプション
-	timeoutSeconds    int    // ffmpeg 処理のタイムアウト秒数
+	// ffmpeg 実行関連 (transav1.Config に変換して使用)
+	ffmpegPriority         string           // ffmpeg プロセスの優先度
+	hwEncoder              string           // ハードウェアエンコーダ名
+	cpuEncoder             string           // CPUエンコーダ名
+	hwEncoderOptions       string           // HWエンコーダ用オプション
+	cpuEncoderOptions      string           // CPUエンコーダ用オプション
+	hwEncoderArgs          stringListFlag   // HWエンコーダ用に1つずつ追加する引数 (-hwarg)
+	cpuEncoderArgs         stringListFlag   // CPUエンコーダ用に1つずつ追加する引数 (-cpuarg)
+	timeoutSeconds         int              // ffmpeg 処理のタイムアウト秒数
+	hwJobs                 int              // HWレーンの同時エンコード数
+	cpuJobs                int              // CPUレーンの同時エンコード数
+	progressSeconds        int              // 進捗ログの出力間隔秒数 (0で無効)
+	eventsFormat           string           // 機械可読イベントの出力形式 ("" で無効, "json")
+	av1SourceFlag          string           // 入力が既に AV1 の場合の扱い (-av1src の指定値)
+	minSavingRatio         float64          // 出力に求める最小のサイズ削減率
+	largerFlag             string           // 出力が十分に小さくならなかった場合の扱い (-larger の指定値)
+	collisionFlag          string           // 出力名が衝突した場合の扱い (-collision の指定値)
+	sidecarFlag            string           // サイドカーファイルの扱い (-sidecar の指定値)
+	streamsFlag            string           // 出力に含めるストリームの選び方 (-streams の指定値)
+	languagesFlag          string           // -streams lang で残す言語 (-langs の指定値, カンマ区切り)
+	audioCodecFlag         string           // 音声の扱い (-acodec の指定値)
+	subtitleCodecFlag      string           // 字幕の扱い (-scodec の指定値)
+	noMetadata             bool             // メタデータとチャプターを引き継がないか (-nometadata)
+	containerFlag          string           // 出力のコンテナ (-container の指定値)
+	sizeRetryOptions       string           // -larger retry 時の CPU エンコーダ用オプション
+	verifyFlag             string           // エンコード後の出力検証の方法 (-verify の指定値)
+	verifyToleranceSeconds float64          // 出力検証で許容する再生時間の差 (秒)
+	encoderChainFlags      encoderChainFlag // -encoder などで指定されたエンコーダチェーン (config.go)
+	configPath             string           // JSON 設定ファイルのパス (-config)
+	detectEncoders         bool             // 起動時に使用可能なエンコーダを検出するか (-detect)
+	tempDirFlag            string           // 一時ディレクトリを作成する場所 (空の場合は OS の既定)
 
 	// 動作モード関連フラグ
-	logToFile         bool   // ログをファイルにも書き出すか
-	debugMode         bool   // デバッグログを有効にするか
-	restart           bool   // 再開モード (マーカー/0バイトファイル削除)
-	forceStart        bool   // 出力ディレクトリ強制削除モード
-	quickModeFlag     bool   // 一時コピーなしの高速モード
-	usingTempFileList bool   // 一時ファイルリストを使用するか
-	tempFileListPath  string // 一時ファイルリストのパス
+	logToFile         bool // ログをファイルにも書き出すか
+	debugMode         bool // デバッグログを有効にするか
+	restart           bool // 再開モード (マーカー/0バイトファイル削除)
+	forceStart        bool // 出力ディレクトリ強制削除モード
+	dryRun            bool // 実行計画の表示のみ行うモード (ファイルの変更と ffmpeg の実行を行わない)
+	quickModeFlag     bool // 一時コピーなしの高速モード
+	usingTempFileList bool // 一時ファイルリストを使用するか
 
 	// 実行パスと時間
 	ffmpegPath  string    // 検出された ffmpeg のフルパス
@@ -68,27 +105,44 @@ func printUsage() {
   ハードウェアエンコード失敗時にはCPUエンコードにフォールバックします。
 
 使用法 (Usage):
-  %s -s <入力元ディレクトリ|入力ファイル> -o <出力先ディレクトリ> [オプション...]
-  引数なしで起動した場合、詳細な使用法を表示するには -h オプションを使用してください。
+  %s [convert] -s <入力元ディレクトリ|入力ファイル> -o <出力先ディレクトリ> [オプション...]
+  %s status -s <入力元> -o <出力先> [-json]          (進捗状況の集計)
+  %s verify -s <入力元> -o <出力先> [オプション...]   (変換済みの出力の検証)
+  %s clean -o <出力先> [-force]                      (失敗マーカーと不完全な出力の削除)
+  %s recover -s <入力元> -o <出力先>                  (QuickMode で中断された動画の回復)
+  %s doctor [-s <入力元>] [-o <出力先>] [オプション...]   (環境と設定の事前診断)
+  サブコマンド名を省略した場合は convert として動作します。
+  各サブコマンドの詳細は「%s <サブコマンド> -h」で表示されます。
 
 説明 (Description):
   入力元がディレクトリの場合、再帰的に検索し、動画とその他のファイルを処理します。
   入力元がファイルの場合、そのファイルのみを動画として処理します (出力先はディレクトリ指定必須)。
 
   - 動画ファイル (%s) は AV1 にエンコードされます。
-    - まず -hwenc で指定されたHWエンコーダ (-hwopt オプション適用) を試行します。
-    - 失敗時 (タイムアウト以外) は -cpuenc (-cpuopt オプション適用) で再試行します。
-    - 音声は AAC に変換されます。
+    - エンコーダチェーンの先頭から順に試行し、失敗時は次のエンコーダで再試行します。
+    - チェーンは -encoder (複数指定可) または -config の設定ファイルで指定します。
+      指定がない場合は -hwenc (-hwopt) → -cpuenc (-cpuopt) の2段になります。
+    - タイムアウトした場合、-encretry を指定した段を除き、次のエンコーダは試行しません。
+    - HW と CPU のエンコーダはそれぞれ -hwjobs / -cpujobs の数まで並列に実行されます
+      (エンコーダ名が _nvenc, _qsv, _amf, _vaapi などで終わるものが HW として扱われます)。
+    - 音声・字幕は -streams / -acodec / -scodec の指定に従い、出力のコンテナに合わせてコピーまたは変換されます。
     - 出力ファイル名は元の名前に「%s」が付与されます (例: input.mp4 -> input_AV1.mp4)。
+      -container mkv / webm では拡張子が .mkv / .webm になります。
+      既にこの名前の動画 (変換済みの出力) は再エンコードせずにコピーします。
   - その他のファイル (画像 %s など) はそのまま出力先の対応するサブディレクトリにコピーされます。
     【重要】ディレクトリモードでは、その他のファイルのコピーは動画エンコード処理 *前* に実行されます。
   - 通常、エンコード処理は一時ディレクトリで行われます (-quick 指定時を除く)。
+  - 出力先が入力元の中にある場合、入力元の走査では出力先を除外します
+    (入力元と出力先が同じ場合、入力元が出力先の中にある場合はエラー終了します)。
   - ffmpeg/ffprobe は -ffmpegdir で指定されたディレクトリ、または環境変数PATHから検索されます。
-  - ffmpeg プロセスは指定された優先度で実行されます (Windows: SetPriorityClass, Linux/macOS: nice)。
-  - QuickMode (-quick) で中断された場合、次回起動時に回復処理が試行されます。
+  - ffmpeg プロセスは指定された優先度で実行されます (Windows: SetPriorityClass, Linux: setpriority + I/O優先度, macOS: setpriority)。
+  - Ctrl+C / SIGTERM を受信すると、実行中の ffmpeg を停止して作業状態を元に戻してから終了します
+    (終了コード 130)。もう一度受信すると即座に強制終了します。
+  - QuickMode (-quick) で強制終了された場合、次回起動時に回復処理が試行されます
+    (recover サブコマンドで変換を開始せずに回復処理のみを行うこともできます)。
 
 必須引数:
-`, progName, progName, getVideoExtList(), outputSuffix, getImageExtList()) // fileutils.go の関数を呼び出し
+`, progName, progName, progName, progName, progName, progName, progName, progName, transav1.VideoExtList(), transav1.OutputSuffix, transav1.ImageExtList())
 
 	// 各フラグの説明を出力
 	fmt.Fprintf(os.Stderr, "  -s <パス>\n\t入力元ディレクトリ、または単一の入力動画ファイルパス。\n")
@@ -101,16 +155,51 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  -cpuenc <名前>\n\tフォールバック用CPUエンコーダ名 (例: libsvtav1, libx265)。空文字で無効。\n\t(デフォルト: \"%s\")\n", defaultCpuEnc)
 	fmt.Fprintf(os.Stderr, "  -hwopt \"<オプション>\"\n\tHWエンコーダ用の追加ffmpegオプション (引用符で囲む)。\n\t(デフォルト: \"%s\")\n", defaultHwOpt)    // パッケージレベル定数を使用
 	fmt.Fprintf(os.Stderr, "  -cpuopt \"<オプション>\"\n\tCPUエンコーダ用の追加ffmpegオプション (引用符で囲む)。\n\t(デフォルト: \"%s\")\n", defaultCpuOpt) // パッケージレベル定数を使用
-	fmt.Fprintf(os.Stderr, "  -timeout <秒>\n\tffmpeg 各処理のタイムアウト秒数 (0で無効)。\n\t(デフォルト: %d)\n", defaultTimeout)                 // パッケージレベル定数を使用
+	fmt.Fprintf(os.Stderr, "\t※ -hwopt / -cpuopt / -encopt / -retryopt は空白で区切られ、'...' または \"...\" で空白を含む値を書けます。\n\t  例: -cpuopt \"-crf 28 -vf 'scale=1280:-2, fps=30' -metadata title='My Movie'\"\n\t  -i, -y, -c, -c:v, -c:a, -c:s, -map, -map_metadata, -map_chapters, -f, -progress, -loglevel と、\n\t  出力パスとみなされる引数は指定できません。\n")
+	fmt.Fprintf(os.Stderr, "  -hwarg <引数>, -cpuarg <引数>\n\tHW / CPU エンコーダに引数を1つずつ追加します (複数指定可, -hwopt / -cpuopt の後に渡されます)。\n\t引用符や空白の解釈を行わないため、値をそのまま渡せます。\n\t例: -cpuarg -vf -cpuarg \"scale=1280:-2, fps=30\"\n")
+	fmt.Fprintf(os.Stderr, "  -encoder <名前>\n\tエンコーダチェーンに段を追加します。指定した順に試行されます (複数指定可)。\n\t以下の -encopt / -encarg / -enctimeout / -encretry は直前の -encoder に適用されます。\n\t指定時、-hwenc / -hwopt / -cpuenc / -cpuopt と設定ファイルのチェーンは無視されます。\n\t例: -encoder av1_nvenc -encopt \"-cq 25\" -encoder av1_qsv -encoder libsvtav1 -encopt \"-crf 28\"\n")
+	fmt.Fprintf(os.Stderr, "  -encopt \"<オプション>\"\n\t直前の -encoder 用の追加ffmpegオプション (引用符で囲む)。\n")
+	fmt.Fprintf(os.Stderr, "  -encarg <引数>\n\t直前の -encoder に引数を1つずつ追加します (複数指定可, -encopt の後に渡されます)。\n")
+	fmt.Fprintf(os.Stderr, "  -enctimeout <秒>\n\t直前の -encoder のタイムアウト秒数 (0: -timeout を使用, -1: 無効)。\n")
+	fmt.Fprintf(os.Stderr, "  -encretry\n\t直前の -encoder がタイムアウトした場合も、次のエンコーダで再試行します。\n")
+	fmt.Fprintf(os.Stderr, "  -config <パス>\n\tJSON 設定ファイル。\"encoders\" にエンコーダチェーンを指定できます。\n\t例: {\"encoders\": [{\"name\": \"av1_nvenc\", \"options\": \"-cq 25\", \"args\": [\"-vf\", \"scale=1280:-2\"], \"timeout\": 3600, \"retry_on_timeout\": true},\n\t                  {\"name\": \"libsvtav1\", \"options\": \"-crf 28\"}]}\n")
+	fmt.Fprintf(os.Stderr, "\t\"extensions\" には拡張子ごとの扱いを指定できます (encode: エンコード, copy: コピー, ignore: 処理しない,\n\tconvert-image: 静止画を AVIF (「名前%s」) に変換し、失敗した場合はそのままコピー)。\n\t例: \"extensions\": {\".vob\": \"encode\", \".ts\": \"copy\", \".nfo\": \"ignore\", \".jpg\": \"convert-image\"}\n\t\"image_encoder\", \"image_options\" で静止画の変換に使用するエンコーダとオプションを指定できます\n\t(デフォルト: %s, \"%s\")。\"sniff\": true は -sniff と同じです。\n", transav1.ImageSuffix, transav1.DefaultImageEncoder, transav1.DefaultImageOptions)
+	fmt.Fprintf(os.Stderr, "  -detect\n\t起動時に ffmpeg -encoders と合成映像のテストエンコードで、使用できるエンコーダを検出します。\n\tエンコーダを指定していない場合は、%s のうち\n\t使用できる HW エンコーダ全てと最初に使用できる CPU エンコーダでチェーンを構成します。\n\t指定した場合は、使用できないエンコーダをチェーンから除きます。除外した理由はログに出力されます。\n\t-detect=false で無効にできます。\n\t(デフォルト: true)\n", strings.Join(transav1.EncoderNames(transav1.KnownAV1Encoders()), ", "))
+	fmt.Fprintf(os.Stderr, "  -timeout <秒>\n\tffmpeg 各処理のタイムアウト秒数 (0で無効)。\n\t(デフォルト: %d)\n", defaultTimeout) // パッケージレベル定数を使用
+	fmt.Fprintf(os.Stderr, "  -hwjobs <数>\n\tHWエンコーダで同時に処理する動画の数。\n\t(デフォルト: %d)\n", defaultHwJobs)
+	fmt.Fprintf(os.Stderr, "  -cpujobs <数>\n\tCPUエンコーダで同時に処理する動画の数。\n\tHWエンコーダで失敗した動画もこのレーンで再試行されます。\n\t(デフォルト: %d)\n", defaultCpuJobs)
+	fmt.Fprintf(os.Stderr, "  -progress <秒>\n\tエンコード中の進捗 (割合・速度・残り時間、全体の進捗) をログに出力する間隔 (0で無効)。\n\t割合と残り時間の算出には ffprobe が必要です。\n\t(デフォルト: %d)\n", defaultProgress)
+	fmt.Fprintf(os.Stderr, "  -events <形式>\n\t機械可読なイベントを標準出力に1行1件で出力します (形式: json)。\n\t指定時、通常のログは標準エラー出力に出力されます。\n\tイベント: %s\n\t(デフォルト: 無効)\n", strings.Join(transav1.EventNames, ", "))
+	fmt.Fprintf(os.Stderr, "  -av1src <扱い>\n\t入力の映像が既に AV1 の場合の扱い (判定には ffprobe が必要)。\n\t  encode: 通常どおり再エンコードする\n\t  skip:   何も出力しない\n\t  copy:   元のファイル名のまま出力先にコピーする\n\t  remux:  再エンコードせずに「%s」形式へ再多重化する\n\t処理した件数は終了時の実行サマリーに表示されます。\n\t(デフォルト: \"%s\")\n", transav1.OutputSuffix, defaultAV1Source)
+	fmt.Fprintf(os.Stderr, "  -minsaving <割合>\n\tエンコード後の出力に求める、入力に対するサイズの最小削減率 (0.2 で 20%%)。\n\t負の値を指定すると、その割合までは入力より大きい出力も許容します。\n\t(デフォルト: %g - 入力より大きくなければよい)\n", defaultMinSaving)
+	fmt.Fprintf(os.Stderr, "  -larger <扱い>\n\t削減率が -minsaving 未満だった場合の扱い。\n\t  original: 出力を破棄し、元のファイルをそのままコピーする\n\t  retry:    チェーン中の最初のCPUエンコーダと -retryopt で1回だけ再エンコードする\n\t            (それでも基準未満なら元のファイルをコピー)\n\t  keep:     出力をそのまま残し、実行サマリーとジャーナルに記録する\n\t  off:      出力サイズを確認しない\n\t(デフォルト: \"%s\")\n", defaultLarger)
+	fmt.Fprintf(os.Stderr, "  -retryopt \"<オプション>\"\n\t-larger retry で再エンコードする際の CPU エンコーダ用オプション。\n\t(デフォルト: \"%s\")\n", defaultRetryOpt)
+	fmt.Fprintf(os.Stderr, "  -verify <方法>\n\tエンコード後、出力を最終パスへ配置する前に行う検証 (ffprobe が必要)。\n\t  none:   検証しない\n\t  probe:  再生時間 (-verifytol の範囲) と映像・音声ストリーム数を入力と比較する\n\t  decode: probe に加え、出力全体をデコードしてエラーがないか確認する\n\t不一致の場合は失敗として扱い、「出力ファイル名%s」マーカーを作成します。\n\t(デフォルト: \"%s\")\n", transav1.VerifySuffix, defaultVerify)
+	fmt.Fprintf(os.Stderr, "  -verifytol <秒>\n\t出力検証で許容する、入力と出力の再生時間の差。\n\t(デフォルト: %g)\n", defaultVerifyTol)
 	fmt.Fprintf(os.Stderr, "  -quick\n\t高速モード: 一時コピーを行わず入力元ファイルを直接エンコード。\n\t処理失敗時に元ファイルが破損するリスクがあります。\n\t次回起動時に回復処理が試行されます。\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -tempdir <パス>\n\tエンコード用の一時ディレクトリを作成する場所 (-quick 指定時は使用しません)。\n\t(デフォルト: OS の一時ディレクトリ「%s」)\n", os.TempDir())
 	fmt.Fprintf(os.Stderr, "  -usetemp\n\t多数の動画ファイルを処理する場合に一時ファイルリストを使用します。\n\tメモリ使用量を抑えられますが、ディスクI/Oが増加します。\n\t(デフォルト: false - メモリ内リストを使用)\n")
 	fmt.Fprintf(os.Stderr, "  -log\n\tログを出力ディレクトリ内のファイル (GoTransAV1_Log_*.log) にも書き出します。\n\t(デフォルト: false)\n")
 	fmt.Fprintf(os.Stderr, "  -debug\n\t詳細なデバッグログ (ffmpegの出力など) を有効にします。\n\t(デフォルト: false)\n")
-	fmt.Fprintf(os.Stderr, "  -restart\n\t処理開始前に出力先のマーカーファイル (*.failed, *.timeout など) と\n\tサイズ 0 の動画ファイルを削除します。中断からの再開時に便利です。\n\t(デフォルト: false)\n")
-	fmt.Fprintf(os.Stderr, "  -force\n\t処理開始前に出力先ディレクトリを対話的に確認した後、\n\t完全に削除します。注意して使用してください。\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -restart\n\t処理開始前に出力先のマーカーファイル (*.failed, *.timeout など) と\n\tサイズ 0 の動画ファイルを削除します。中断からの再開時に便利です。\n\t(clean サブコマンドで削除のみを行うこともできます)\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -force\n\t処理開始前に出力先ディレクトリを対話的に確認した後、\n\t完全に削除します。注意して使用してください。\n\t(clean -force で削除のみを行うこともできます)\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -include <パターン>\n\t処理対象とするファイルのパターン (複数指定可)。指定した場合、いずれかに一致する\n\tファイルのみを処理します (動画・その他のファイルの両方に適用)。\n\tパターンは入力元からの相対パスと比較するグロブ (*, ?, [...]) で、大文字小文字は区別しません。\n\t「/」を含まないパターンはいずれかの階層の名前と、含むパターンはパスの先頭部分と比較します。\n\t(例: -include \"*.mkv\" -include \"tv/*\")\n")
+	fmt.Fprintf(os.Stderr, "  -exclude <パターン>\n\t処理しないファイル・ディレクトリのパターン (複数指定可, 書式は -include と同じ)。\n\tディレクトリに一致した場合は配下ごと除外します。(例: -exclude \"*.tmp\" -exclude \"tv/extras\")\n")
+	fmt.Fprintf(os.Stderr, "  -excludefile <パス>\n\t除外パターンを1行に1つずつ記述したファイル (空行と # で始まる行は無視)。\n")
+	fmt.Fprintf(os.Stderr, "  -nodefaultexclude\n\t既定の除外パターンを使用しません。既定では次のファイル・ディレクトリを除外します:\n\t%s\n\t(デフォルト: false)\n", strings.Join(transav1.DefaultExcludes, ", "))
+	fmt.Fprintf(os.Stderr, "  -collision <扱い>\n\t同じフォルダの入力が同じ出力名になる場合 (例: clip.mov と clip.MKV → clip%s) の扱い。\n\t衝突はファイルリストの作成時に検出してログと実行サマリーに表示します。\n\t  number: 2件目以降 (名前順) の出力名に番号を付ける (clip_2%s)\n\t  ext:    衝突した全ての出力名に元の拡張子を含める (clip_mov%s, clip_MKV%s)\n\t  fail:   変換を開始せずにエラー終了する\n\tstatus / verify にも同じ指定をしてください。\n\t(デフォルト: \"%s\")\n", transav1.OutputSuffix, transav1.OutputSuffix, transav1.OutputSuffix, transav1.OutputSuffix, defaultCollision)
+	fmt.Fprintf(os.Stderr, "  -sidecar <扱い>\n\t動画と同じフォルダにある、動画の名前に「.」か「-」が続く字幕・メタデータ・画像\n\t(例: movie.mkv に対する movie.srt, movie.jpn.ass, movie.nfo, movie-poster.jpg) の扱い。\n\t  rename: 動画の出力名に合わせて名前を変えてコピーする (movie_AV1.srt, movie_AV1-poster.jpg)\n\t  copy:   元の名前のままコピーする\n\t  mux:    テキスト字幕 (srt/ass/ssa/vtt) とカバー画像1枚 (jpg/png) を出力に多重化し、\n\t          それ以外は rename と同じ (エンコードに失敗した場合や元の動画をコピーした場合はサイドカーをコピーします)\n\t(デフォルト: \"%s\")\n", defaultSidecars)
+	fmt.Fprintf(os.Stderr, "  -streams <選び方>\n\t出力に含める入力のストリーム。\n\t  all:   全ての映像・音声・字幕・カバー画像 (出力のコンテナに格納できないものは除く)\n\t  audio: 最初の映像と全ての音声\n\t  lang:  最初の映像と、-langs の言語の音声・字幕 (一致する音声がなければ最初の音声)\n\t  first: 最初の映像と最初の音声 (従来の動作)\n\tffprobe がない場合は、最初の映像と全ての音声になります。verify にも同じ指定をしてください。\n\t(デフォルト: \"%s\")\n", defaultStreams)
+	fmt.Fprintf(os.Stderr, "  -langs <言語>\n\t-streams lang で残す音声・字幕の言語 (カンマ区切り, ストリームの language タグと比較, 例: \"jpn,eng\")。\n")
+	fmt.Fprintf(os.Stderr, "  -container <コンテナ>\n\t出力のコンテナ (出力ファイル名の拡張子)。\n\t  mp4:  MP4 (従来の動作)\n\t  mkv:  Matroska (DTS などの音声、PGS・ASS 字幕、フォントなどの添付ファイルもそのまま格納できる)\n\t  webm: WebM (音声は Opus / Vorbis、字幕は WebVTT に変換する)\n\t  auto: mp4 とし、mp4 にそのまま格納できないストリームがある入力のみ mkv にする (ffprobe が必要)\n\tstatus / verify にも同じ指定をしてください。\n\t(デフォルト: \"%s\")\n", defaultContainer)
+	fmt.Fprintf(os.Stderr, "  -acodec <コーデック>\n\t音声の扱い。auto: 出力のコンテナに格納できる音声 (mp4 では aac, mp3, ac3, eac3, flac, opus など) はコピーし、\n\tそれ以外は AAC (webm では Opus) に変換する / copy: 全てコピーする / エンコーダ名 (例: aac, libopus): 全て変換する\n\t(デフォルト: \"%s\")\n", transav1.DefaultAudioCodec)
+	fmt.Fprintf(os.Stderr, "  -scodec <コーデック>\n\t字幕の扱い。auto: 出力のコンテナに格納できる字幕はコピーし、それ以外のテキスト字幕 (srt, ass など) は\n\tコンテナの形式 (mp4: mov_text, mkv: srt, webm: webvtt) に変換し、画像の字幕 (PGS, DVD など) は除外する /\n\tcopy: 全てコピーする / none: 字幕を含めない / エンコーダ名: テキスト字幕をそのエンコーダで変換する\n\t(デフォルト: \"%s\")\n", transav1.DefaultSubtitleCodec)
+	fmt.Fprintf(os.Stderr, "  -nometadata\n\t入力のメタデータ (タイトルなど) とチャプターを出力に引き継ぎません。\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -sniff\n\t拡張子が未知のファイルを ffprobe で調べ、動画であればエンコードします (拡張子の誤りへの対応)。\n\t(デフォルト: false)\n")
+	fmt.Fprintf(os.Stderr, "  -dry-run\n\t変換を行わずに、実行した場合の処理内容 (エンコードする動画、コピーするファイル、\n\t出力済みでスキップする動画、-restart で削除するマーカー、-force で削除する出力先など) を表示します。\n\tファイルの変更と ffmpeg の実行は行いません (-log も無効になります)。\n\t(デフォルト: false)\n")
 	fmt.Fprintf(os.Stderr, "  -h, --help\n\tこのヘルプメッセージを表示します。\n")
 
-	fmt.Fprintln(os.Stderr, `
+	fmt.Fprint(os.Stderr, `
 注意事項:
   - ffmpeg および ffprobe (任意) がシステムにインストールされている必要があります。
     -ffmpegdir でパスを指定するか、環境変数PATHに登録してください。
@@ -122,88 +211,9 @@ func printUsage() {
 `)
 }
 
-// --- recoverQuickModeFiles 関数: QuickMode で中断された可能性のあるファイルを回復試行 ---
-func recoverQuickModeFiles(srcRoot, dstRoot string) {
-	logger.Println("--- QuickMode 回復処理開始 ---")
-	recoveredCount := 0
-	failedCount := 0
-
-	walkErr := filepath.WalkDir(dstRoot, func(markerPath string, d fs.DirEntry, err error) error {
-		if err != nil {
-			logger.Printf("警告 [QuickMode回復]: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", markerPath, err)
-			if d != nil && d.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		// ディレクトリや .origin 以外のファイルは無視
-		if d.IsDir() || !strings.HasSuffix(d.Name(), originSuffix) {
-			return nil
-		}
-
-		// .origin ファイルが見つかった
-		debugLogPrintf("[QuickMode回復]: マーカー発見: %s", markerPath)
-
-		// 1. 元のファイル名と相対パスを取得
-		originalBaseName := strings.TrimSuffix(d.Name(), originSuffix)
-		relPath, err := filepath.Rel(dstRoot, filepath.Dir(markerPath))
-		if err != nil {
-			logger.Printf("警告 [QuickMode回復]: マーカー '%s' の相対パス計算失敗: %v。回復スキップ。", markerPath, err)
-			return nil // このマーカーは処理できない
-		}
-
-		// 2. 対応するソースファイルパスを構築
-		originalSourcePath := filepath.Join(srcRoot, relPath, originalBaseName)
-		processingSourcePath := originalSourcePath + ".processing"
-
-		debugLogPrintf("[QuickMode回復]: 対応ソース確認: '%s' (処理中名: '%s')", originalSourcePath, processingSourcePath)
-
-		// 3. .processing ファイルが存在するか確認
-		if _, err := os.Stat(processingSourcePath); os.IsNotExist(err) {
-			// .processing が存在しない -> 正常終了済みか、マーカーだけ残った異常状態
-			logger.Printf("情報 [QuickMode回復]: 対応する処理中ファイル '%s' が見つかりません。マーカー '%s' を削除します。", filepath.Base(processingSourcePath), filepath.Base(markerPath))
-			if errDel := os.Remove(markerPath); errDel != nil {
-				logger.Printf("警告 [QuickMode回復]: マーカー削除失敗 (%s): %v", markerPath, errDel)
-			}
-			return nil // 次のファイルへ
-		} else if err != nil {
-			// Stat で他のエラー
-			logger.Printf("警告 [QuickMode回復]: 処理中ファイル '%s' の状態確認エラー: %v。回復スキップ。", processingSourcePath, err)
-			return nil
-		}
-
-		// 4. .processing ファイルを元の名前にリネーム試行
-		logger.Printf("情報 [QuickMode回復]: 処理中ファイル '%s' を '%s' にリネーム試行...", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath))
-		if err := os.Rename(processingSourcePath, originalSourcePath); err != nil {
-			logger.Printf("エラー [QuickMode回復]: リネーム失敗 (%s -> %s): %v。手動での確認が必要です！", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath), err)
-			failedCount++
-		} else {
-			// 5. リネーム成功 -> マーカーファイルを削除
-			logger.Printf("成功 [QuickMode回復]: リネーム完了。マーカー '%s' を削除します。", filepath.Base(markerPath))
-			if errDel := os.Remove(markerPath); errDel != nil {
-				logger.Printf("警告 [QuickMode回復]: リネーム成功後、マーカー削除失敗 (%s): %v", markerPath, errDel)
-				// リネームは成功したので recoveredCount は増やす
-			}
-			recoveredCount++
-		}
-		return nil // 次のファイルへ
-	})
-
-	if walkErr != nil {
-		logger.Printf("警告 [QuickMode回復]: ディレクトリ走査中に予期せぬエラー: %v", walkErr)
-	}
-
-	if recoveredCount > 0 || failedCount > 0 {
-		logger.Printf("--- QuickMode 回復処理終了 (成功: %d件, 要確認: %d件) ---", recoveredCount, failedCount)
-	} else {
-		logger.Println("--- QuickMode 回復処理終了 (対象ファイルなし) ---")
-	}
-}
-
 // --- main 関数 ---
 func main() {
-	startTime = time.Now()  // プログラム開始時刻を記録
-	flag.Usage = printUsage // Usage表示関数を設定
+	startTime = time.Now() // プログラム開始時刻を記録
 
 	// --- 引数がない場合の処理 ---
 	if len(os.Args) < 2 {
@@ -211,8 +221,23 @@ func main() {
 		os.Exit(1)
 	}
 
-	// --- コマンドライン引数の定義 ---
-	// flag 変数定義 (グローバル変数へのポインタを渡す)
+	// --- サブコマンドの判定 (commands.go) ---
+	// 先頭の引数がサブコマンド名でなければ convert とみなす (従来のフラグのみの呼び出し, GUI との互換)
+	cmd, args := selectCommand(os.Args[1:])
+
+	// --- コマンドライン引数の定義とパース ---
+	// サブコマンドごとに登録するフラグが異なるため、flag.CommandLine を作り直す
+	flag.CommandLine = flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flag.CommandLine.Usage = cmd.usage // Usage表示関数を設定
+	cmd.flags()
+	flag.CommandLine.Parse(args) // エラー時は flag.ExitOnError により終了する
+
+	os.Exit(cmd.run())
+}
+
+// registerConvertFlags: convert (と doctor) のフラグを登録する
+// flag 変数定義 (グローバル変数へのポインタを渡す)
+func registerConvertFlags() {
 	flag.StringVar(&sourceDir, "s", "", "入力元ディレクトリまたはファイル (必須)")
 	flag.StringVar(&destDir, "o", "", "出力先ディレクトリ (必須)")
 	flag.StringVar(&ffmpegDir, "ffmpegdir", defaultFfmpegDir, "ffmpeg/ffprobe 格納ディレクトリ")
@@ -221,81 +246,131 @@ func main() {
 	flag.StringVar(&cpuEncoder, "cpuenc", defaultCpuEnc, "フォールバックCPUエンコーダ名")
 	flag.StringVar(&hwEncoderOptions, "hwopt", defaultHwOpt, "HWエンコーダ用ffmpegオプション")
 	flag.StringVar(&cpuEncoderOptions, "cpuopt", defaultCpuOpt, "CPUエンコーダ用追加ffmpegオプション")
+	flag.Var(&hwEncoderArgs, "hwarg", "HWエンコーダに追加する引数 (1つずつ, 複数指定可)")
+	flag.Var(&cpuEncoderArgs, "cpuarg", "CPUエンコーダに追加する引数 (1つずつ, 複数指定可)")
+	registerEncoderChainFlags(&encoderChainFlags) // -encoder, -encopt, -enctimeout, -encretry (config.go)
+	flag.StringVar(&configPath, "config", "", "JSON 設定ファイル")
+	flag.BoolVar(&detectEncoders, "detect", true, "起動時に使用可能なエンコーダを検出する")
 	flag.IntVar(&timeoutSeconds, "timeout", defaultTimeout, "タイムアウト秒数 (0で無効)")
+	flag.IntVar(&hwJobs, "hwjobs", defaultHwJobs, "HWレーンの同時エンコード数")
+	flag.IntVar(&cpuJobs, "cpujobs", defaultCpuJobs, "CPUレーンの同時エンコード数")
+	flag.IntVar(&progressSeconds, "progress", defaultProgress, "進捗ログの出力間隔秒数 (0で無効)")
+	flag.StringVar(&eventsFormat, "events", "", "機械可読イベントの出力形式 (json)")
+	flag.StringVar(&av1SourceFlag, "av1src", defaultAV1Source, "入力が既に AV1 の場合の扱い (encode|skip|copy|remux)")
+	flag.Float64Var(&minSavingRatio, "minsaving", defaultMinSaving, "出力に求める最小のサイズ削減率 (0.2 で 20%)")
+	flag.StringVar(&largerFlag, "larger", defaultLarger, "削減率が -minsaving 未満の場合の扱い (original|retry|keep|off)")
+	flag.StringVar(&collisionFlag, "collision", defaultCollision, "同じフォルダの入力の出力名が衝突した場合の扱い (number|ext|fail)")
+	flag.StringVar(&sidecarFlag, "sidecar", defaultSidecars, "サイドカーファイル (字幕・画像など) の扱い (rename|copy|mux)")
+	registerStreamFlags()
+	flag.StringVar(&audioCodecFlag, "acodec", transav1.DefaultAudioCodec, "音声の扱い (auto|copy|エンコーダ名)")
+	flag.StringVar(&subtitleCodecFlag, "scodec", transav1.DefaultSubtitleCodec, "字幕の扱い (auto|copy|none|エンコーダ名)")
+	flag.BoolVar(&noMetadata, "nometadata", false, "入力のメタデータとチャプターを引き継がない")
+	flag.StringVar(&containerFlag, "container", defaultContainer, "出力のコンテナ (mp4|mkv|webm|auto)")
+	flag.StringVar(&sizeRetryOptions, "retryopt", defaultRetryOpt, "-larger retry 時の CPU エンコーダ用オプション")
+	flag.StringVar(&verifyFlag, "verify", defaultVerify, "エンコード後の出力検証 (none|probe|decode)")
+	flag.Float64Var(&verifyToleranceSeconds, "verifytol", defaultVerifyTol, "出力検証で許容する再生時間の差 (秒)")
 	flag.BoolVar(&quickModeFlag, "quick", false, "高速モード: 一時コピーを行わず直接エンコード")
 	flag.BoolVar(&logToFile, "log", false, "ログをファイルにも書き出す")
 	flag.BoolVar(&debugMode, "debug", false, "詳細ログ出力") // グローバル変数 debugMode に直接設定
 	flag.BoolVar(&restart, "restart", false, "マーカー/0バイト動画削除")
 	flag.BoolVar(&forceStart, "force", false, "出力Dirを強制削除 (確認あり)")
 	flag.BoolVar(&usingTempFileList, "usetemp", false, "一時ファイルリストを使用")
+	flag.BoolVar(&dryRun, "dry-run", false, "実行計画の表示のみ (ファイルの変更・ffmpeg の実行なし)")
+	registerFilterFlags() // -include, -exclude, -excludefile, -nodefaultexclude (config.go)
+	flag.BoolVar(&sniffFlag, "sniff", false, "拡張子が未知のファイルを ffprobe で調べ、動画であればエンコードする")
+	flag.StringVar(&tempDirFlag, "tempdir", "", "一時ディレクトリを作成する場所")
+}
 
-	// --- 引数のパース ---
-	flag.Parse()
+// runConvert: convert サブコマンド (動画の変換) を実行し、終了コードを返す
+func runConvert() int {
+	// --- イベント出力設定 (-events) ---
+	// 標準出力をイベント専用にするため、通常のログは標準エラー出力に切り替える
+	var onEvent func(transav1.Event)
+	if eventsFormat != "" {
+		if eventsFormat != "json" {
+			fmt.Fprintf(os.Stderr, "エラー: -events: 未対応のイベント形式: '%s' (json のみ指定可能)\n", eventsFormat)
+			os.Exit(1)
+		}
+		// 1行1オブジェクトの JSON (JSON Lines) で書き出す (呼び出しはエンジン側で直列化される)
+		enc := json.NewEncoder(os.Stdout)
+		onEvent = func(ev transav1.Event) {
+			if err := enc.Encode(ev); err != nil {
+				logger.Printf("警告: イベント出力に失敗: %v", err)
+			}
+		}
+		consoleOut = os.Stderr
+	}
 
 	// --- ロギング設定 ---
 	// logutils.go の setupLogging を呼び出し (debugMode を引数で渡す)
-	setupLogging(destDir, startTime, logToFile, debugMode)
+	// -dry-run では出力先にログファイルを作成しない
+	setupLogging(destDir, startTime, logToFile && !dryRun, debugMode)
 
 	// --- 必須引数のチェック ---
 	if sourceDir == "" || destDir == "" {
 		logger.Println("エラー: -s (入力元) と -o (出力先) は必須です。")
-		flag.Usage() // ヘルプを表示
+		flag.CommandLine.Usage() // ヘルプを表示
 		os.Exit(1)
 	}
 
 	// --- パスの正規化と検証 ---
-	var err error
-	sourceDir, err = filepath.Abs(filepath.Clean(sourceDir))
-	if err != nil {
-		logger.Fatalf("エラー: 入力元パス '%s' の正規化に失敗: %v", flag.Lookup("s").Value, err) // 元の入力値も表示
-	}
-	destDir, err = filepath.Abs(filepath.Clean(destDir))
-	if err != nil {
-		logger.Fatalf("エラー: 出力先パス '%s' の正規化に失敗: %v", flag.Lookup("o").Value, err) // 元の入力値も表示
-	}
-	logger.Printf("入力元 (正規化後): %s", sourceDir)
-	logger.Printf("出力先 (正規化後): %s", destDir)
-	if sourceDir == destDir {
-		logger.Fatalf("エラー: 入力元と出力先が同じディレクトリです。")
-	}
+	normalizePaths()
 
 	// --- ffmpeg/ffprobe パスの検索と設定 ---
-	ffmpegBase := "ffmpeg"
-	ffprobeBase := "ffprobe"
-	if runtime.GOOS == "windows" {
-		ffmpegBase += ".exe"
-		ffprobeBase += ".exe"
-	}
+	locateFFmpeg()
 
-	// ffmpeg のパス解決
-	ffmpegPath = filepath.Join(ffmpegDir, ffmpegBase) // 指定ディレクトリを優先
-	if _, err := exec.LookPath(ffmpegPath); err != nil {
-		ffmpegPathFromPath, errPath := exec.LookPath(ffmpegBase)
-		if errPath != nil {
-			logger.Fatalf("エラー: ffmpeg が見つかりません。-ffmpegdir で指定されたパス '%s' にもなく、環境変数PATHにもありません。", ffmpegDir)
-		}
-		logger.Printf("情報: ffmpeg を環境変数PATHから使用します: %s", ffmpegPathFromPath)
-		ffmpegPath = ffmpegPathFromPath
-	} else {
-		ffmpegPath, _ = filepath.Abs(ffmpegPath)
-		logger.Printf("情報: ffmpeg を指定ディレクトリから使用します: %s", ffmpegPath)
-	}
+	// --- 変換エンジンの作成 (エンコーダ・並列数などの検証を含む) ---
+	cfg := transav1.DefaultConfig()
+	cfg.FFmpegPath, cfg.FFprobePath, cfg.Priority = ffmpegPath, ffprobePath, ffmpegPriority
 
-	// ffprobe のパス解決 (任意)
-	ffprobePath = filepath.Join(ffmpegDir, ffprobeBase) // 指定ディレクトリを優先
-	if _, err := exec.LookPath(ffprobePath); err != nil {
-		ffprobePathFromPath, errPath := exec.LookPath(ffprobeBase)
-		if errPath != nil {
-			logger.Printf("警告: ffprobe が見つかりません (-ffmpegdir '%s' または PATH)。一部機能が制限される可能性があります。", ffmpegDir)
-			ffprobePath = ""
-		} else {
-			logger.Printf("情報: ffprobe を環境変数PATHから使用します: %s", ffprobePathFromPath)
-			ffprobePath = ffprobePathFromPath
+	// エンコーダチェーン (-encoder > 設定ファイル > -hwenc/-cpuenc)
+	fileCfg := loadConfigFlag()
+	encoders, encoderSource := resolveEncoderChain(encoderChainFlags, fileCfg)
+	if encoderSource != "-hwenc/-cpuenc" && legacyEncoderFlagsSet() {
+		logger.Printf("警告: エンコーダチェーンが %s で指定されているため、-hwenc / -hwopt / -cpuenc / -cpuopt は無視されます。", encoderSource)
+	}
+	if err := validateEncoderChain(encoders); err != nil {
+		logger.Fatalf("エラー: %v", err)
+	}
+	if detectEncoders && dryRun {
+		logger.Println("情報: -dry-run のため、エンコーダの検出 (ffmpeg の実行) は行いません。")
+	} else if detectEncoders {
+		// チェーンが明示されていない (全てデフォルト) 場合は、検出結果からチェーンを構成する (detect.go)
+		explicit := encoderSource != "-hwenc/-cpuenc" || legacyEncoderFlagsSet()
+		encoders = detectEncoderChain(encoders, explicit)
+		if !explicit {
+			encoderSource = "自動検出"
 		}
-	} else {
-		ffprobePath, _ = filepath.Abs(ffprobePath)
-		logger.Printf("情報: ffprobe を指定ディレクトリから使用します: %s", ffprobePath)
 	}
+	encoderLabels := make([]string, len(encoders))
+	for i, enc := range encoders {
+		encoderLabels[i] = enc.String()
+	}
+	logger.Printf("エンコーダチェーン (%s): %s", encoderSource, strings.Join(encoderLabels, " → "))
+	cfg.Encoders = encoders
+	cfg.Timeout = time.Duration(timeoutSeconds) * time.Second
+	cfg.HWJobs, cfg.CPUJobs = hwJobs, cpuJobs
+	cfg.QuickMode, cfg.UseTempFileList = quickModeFlag, usingTempFileList
+	cfg.AV1Source = transav1.AV1Policy(av1SourceFlag)
+	cfg.MinSaving = minSavingRatio
+	cfg.Larger = transav1.LargerPolicy(largerFlag)
+	cfg.Collision = transav1.CollisionPolicy(collisionFlag)
+	cfg.Sidecars = transav1.SidecarPolicy(sidecarFlag)
+	applyStreamFlags(&cfg)
+	cfg.AudioCodec, cfg.SubtitleCodec, cfg.NoMetadata = audioCodecFlag, subtitleCodecFlag, noMetadata
+	cfg.Container = transav1.Container(containerFlag)
+	cfg.RetryOptions = sizeRetryOptions
+	cfg.Verify = transav1.VerifyMode(verifyFlag)
+	cfg.VerifyTolerance = time.Duration(verifyToleranceSeconds * float64(time.Second))
+	cfg.ProgressInterval = time.Duration(progressSeconds) * time.Second
+	cfg.TempDir = tempDirFlag
+	applyFilterFlags(&cfg)
+	applyClassifyConfig(&cfg, fileCfg)
+	cfg.Logger = logger
+	if debugMode {
+		cfg.DebugLogger = debugLogger
+	}
+	cfg.OnEvent = onEvent
 
 	// --- 入力元がファイルかディレクトリか判定 ---
 	sourceInfo, err := os.Stat(sourceDir)
@@ -323,300 +398,188 @@ func main() {
 	}
 
 	// --- -force オプション処理 ---
+	planRemoveDest := false // -dry-run: 出力先の削除を計画に含める
 	if forceStart {
 		if isSingleFileMode {
 			logger.Println("警告: 単一ファイルモードでは -force オプションは無視されます。")
+		} else if destExists && dryRun {
+			planRemoveDest = true
 		} else if destExists { // 存在するディレクトリに対してのみ実行
-			logger.Printf("!!! 警告: -force オプションが指定されました。出力ディレクトリ '%s' を完全に削除します。", destDir)
-			fmt.Print("本当に実行しますか？ (yes/no): ")
-			reader := bufio.NewReader(os.Stdin)
-			input, err := reader.ReadString('\n')
-			if err != nil {
-				logger.Fatalf("エラー: 確認入力の読み取りに失敗しました: %v", err)
-			}
-			input = strings.TrimSpace(strings.ToLower(input))
-
-			if input == "yes" {
-				logger.Printf("出力ディレクトリ '%s' を削除しています...", destDir)
-				if err := os.RemoveAll(destDir); err != nil {
-					logger.Fatalf("エラー: 出力ディレクトリ削除失敗: %v", err)
-				}
-				logger.Println("出力ディレクトリを削除しました。")
-				destExists = false // 削除したので存在しない状態に
-			} else {
-				logger.Println("削除をキャンセルしました。処理を中断します。")
-				os.Exit(0)
-			}
+			removeDestDir(destDir)
+			destExists = false // 削除したので存在しない状態に
 		} else {
 			logger.Println("情報: -force オプションが指定されましたが、出力ディレクトリが存在しないためスキップします。")
 		}
 	}
 
-	// --- 出力ディレクトリ作成 (存在しない場合 or forceで削除された場合) ---
-	if !destExists {
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			logger.Fatalf("エラー: 出力ディレクトリ '%s' の作成に失敗: %v", destDir, err)
-		}
-		destExists = true // 作成したので存在する
-	}
-
-	// --- QuickMode 回復処理 (ディレクトリモードかつ出力先が存在する場合) ---
-	if !isSingleFileMode && destExists {
-		recoverQuickModeFiles(sourceDir, destDir)
-	}
-
 	// --- -restart オプション処理 (ディレクトリモードかつ出力先が存在する場合) ---
 	if restart {
 		if isSingleFileMode {
 			logger.Println("警告: 単一ファイルモードでは -restart オプションは無視されます。")
 		} else if destExists {
-			if err := removeRestartFiles(destDir); err != nil {
-				logger.Fatalf("エラー: -restart 処理中にエラーが発生: %v", err)
-			}
+			cfg.Restart = true
 		} else {
 			logger.Println("情報: -restart オプションが指定されましたが、出力ディレクトリが存在しないためスキップします。")
 		}
 	}
 
-	// --- 一時ディレクトリ作成 ---
-	tempDir, err := os.MkdirTemp("", tempDirPrefix)
+	converter, err := transav1.New(cfg)
 	if err != nil {
-		logger.Fatalf("エラー: 一時ディレクトリの作成に失敗: %v", err)
+		logger.Fatalf("エラー: %v", err)
 	}
-	logger.Printf("一時ディレクトリ: %s", tempDir)
-	defer func() {
-		debugLogPrintf("一時ディレクトリ削除: %s", tempDir)
-		if err := os.RemoveAll(tempDir); err != nil {
-			logger.Printf("警告: 一時ディレクトリ '%s' の削除に失敗: %v", tempDir, err)
-		}
-	}()
-
-	// --- メイン処理の分岐 ---
-	var allErrors []string // 処理中のエラーを格納するスライス
-
-	if isSingleFileMode {
-		// === 単一ファイル処理モード ===
-		logger.Println("--- 単一ファイル処理モード開始 ---")
-		inputFile := sourceDir
-
-		inputFilename := filepath.Base(inputFile)
-		inputExt := strings.ToLower(filepath.Ext(inputFilename))
 
-		if _, isVideo := videoExtensions[inputExt]; !isVideo {
-			logger.Fatalf("エラー: 入力ファイル '%s' はサポートされている動画拡張子ではありません。", inputFile)
-		}
-
-		outputBaseName := strings.TrimSuffix(inputFilename, filepath.Ext(inputFilename)) + outputSuffix
-		outputFile := filepath.Join(destDir, outputBaseName)
-
-		logger.Printf("処理対象: %s -> %s", inputFile, outputFile)
-
-		// processVideoFile に outputDir を渡すように変更 (QuickModeマーカー作成のため)
-		outputDir := filepath.Dir(outputFile)
-		if err := processVideoFile(inputFile, outputFile, outputDir, tempDir, ffmpegPriority, hwEncoder, cpuEncoder, hwEncoderOptions, cpuEncoderOptions, timeoutSeconds, quickModeFlag); err != nil {
-			allErrors = append(allErrors, fmt.Sprintf("%s: %v", inputFilename, err))
-		}
-		logger.Println("--- 単一ファイル処理モード終了 ---")
+	// --- 中断 (Ctrl+C / SIGTERM) の監視開始 ---
+	// 以降の ffmpeg/ffprobe はコンテキストの取り消しで停止し、各ジョブは作業状態を元に戻してから終了する
+	ctx, stopInterruptHandler := setupInterruptHandler()
+	defer stopInterruptHandler()
 
-	} else {
-		// === ディレクトリ処理モード ===
-		logger.Println("--- ディレクトリ処理モード開始 ---")
-
-		// --- ファイルリスト作成 ---
-		logger.Println("--- ファイルリスト作成開始 ---")
-		var videoFiles []string
-		var otherFiles []string // 動画以外のファイルを格納
-		fileCount := 0
-		walkErr := filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				logger.Printf("警告: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", path, err)
-				if d != nil && d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if d.IsDir() {
-				// ディレクトリ自体はリストに追加しないが、QuickMode回復処理のために存在は確認する
-				// 回復処理は WalkDir の前に行ったので、ここでは何もしない
-				return nil
-			}
-			fileCount++
-			if fileCount%1000 == 0 && fileCount > 0 {
-				logger.Printf("ファイルリスト作成中... %d 件スキャン済み", fileCount)
-			}
-			ext := strings.ToLower(filepath.Ext(path))
-			if _, isVideo := videoExtensions[ext]; isVideo {
-				videoFiles = append(videoFiles, path)
-			} else {
-				otherFiles = append(otherFiles, path)
-			}
-			return nil
-		})
-		if walkErr != nil {
-			logger.Fatalf("エラー: ファイルリスト作成中に予期せぬエラーが発生: %v", walkErr)
-		}
-		logger.Printf("ファイルリスト作成完了。 動画: %d件, その他: %d件 (総ファイル: %d件)", len(videoFiles), len(otherFiles), fileCount)
-
-		// --- 一時ファイルリスト書き出し (-usetemp 指定時) ---
-		if usingTempFileList && len(videoFiles) > 0 {
-			tempFileName := fmt.Sprintf("GoTransAV1_FileList_%s.txt", startTime.Format("20060102_150405"))
-			tempFileListPath = filepath.Join(tempDir, tempFileName)
-			logger.Printf("-usetemp 指定のため、動画ファイルリストを一時ファイルに書き出します: %s", tempFileListPath)
-			file, err := os.Create(tempFileListPath)
-			if err != nil {
-				logger.Printf("警告: 一時リスト作成失敗(%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
-				usingTempFileList = false
-			} else {
-				writer := bufio.NewWriter(file)
-				for _, vf := range videoFiles {
-					if _, err := writer.WriteString(vf + "\n"); err != nil {
-						file.Close()
-						logger.Printf("警告: 一時リスト書き込み失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
-						usingTempFileList = false
-						_ = os.Remove(tempFileListPath)
-						break
-					}
-				}
-				if usingTempFileList { // エラーなくループを終えた場合のみ
-					if err := writer.Flush(); err != nil {
-						file.Close()
-						logger.Printf("警告: 一時リストフラッシュ失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
-						usingTempFileList = false
-						_ = os.Remove(tempFileListPath)
-					} else if err := file.Close(); err != nil {
-						logger.Printf("警告: 一時リストクローズ失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
-						usingTempFileList = false
-						_ = os.Remove(tempFileListPath)
-					} else {
-						videoFiles = nil // メモリ上のリストは不要に
-						logger.Printf("一時リスト書き込み完了。")
-					}
-				} else { // ループ中にエラーが発生した場合
-					file.Close()                    // ファイルは閉じる
-					_ = os.Remove(tempFileListPath) // 作成した一時ファイルは削除
-				}
-			}
-		} else if usingTempFileList && len(videoFiles) == 0 {
-			logger.Println("-usetemp 指定ですが、処理対象の動画ファイルがないため一時リストは作成しません。")
-			usingTempFileList = false
-		} else if !usingTempFileList {
-			// usingTempFileList が false の場合のログ (デフォルト)
-			logger.Printf("メモリ上のリストを使用します (-usetemp 未指定または動画なし)。")
-		}
-
-		// --- その他のファイルコピー処理 ---
-		logger.Println("--- その他のファイルコピー処理開始 ---")
-		var otherCopyErrors []string
-		otherCount := len(otherFiles)
-		if otherCount > 0 {
-			logger.Printf("%d 件のその他のファイルをコピーします...", otherCount)
-			for i, otherFile := range otherFiles {
-				relPath, err := filepath.Rel(sourceDir, otherFile)
-				if err != nil {
-					errMsg := fmt.Sprintf("その他ファイル相対パス計算失敗 (%s): %v", otherFile, err)
-					logger.Printf("エラー (%d/%d): %s", i+1, otherCount, errMsg)
-					otherCopyErrors = append(otherCopyErrors, errMsg)
-					continue
-				}
-				otherOutputPath := filepath.Join(destDir, relPath)
-				// コピー前にログ出力
-				logger.Printf("コピー中 (%d/%d): %s -> %s", i+1, otherCount, filepath.Base(otherFile), otherOutputPath)
-				if err := copyOtherFile(otherFile, otherOutputPath); err != nil {
-					// copyOtherFile 内でスキップログは出さないので、エラーのみ記録
-					errMsg := fmt.Sprintf("その他ファイルコピー失敗(%s): %v", filepath.Base(otherFile), err)
-					logger.Printf("エラー (%d/%d): %s", i+1, otherCount, errMsg)
-					otherCopyErrors = append(otherCopyErrors, errMsg)
-				}
-			}
+	// --- -dry-run: 実行計画を表示して終了 ---
+	if dryRun {
+		var plan *transav1.Plan
+		if isSingleFileMode {
+			plan, err = converter.PlanFile(ctx, sourceDir, destDir)
 		} else {
-			logger.Println("コピー対象のその他のファイルはありません。")
+			plan, err = converter.PlanTree(ctx, sourceDir, destDir, planRemoveDest)
 		}
-		logger.Println("--- その他のファイルコピー処理終了 ---")
-		allErrors = append(allErrors, otherCopyErrors...)
-
-		// --- 動画エンコード処理 ---
-		logger.Println("--- 動画エンコード処理開始 ---")
-		var videoProcessingErrors []string
-		if usingTempFileList {
-			logger.Printf("一時リスト %s から動画パスを読み込んで処理します。", tempFileListPath)
-			file, err := os.Open(tempFileListPath)
-			if err != nil {
-				logger.Fatalf("エラー: 一時リスト '%s' の読み込みに失敗: %v", tempFileListPath, err)
-			}
-			defer file.Close()
-			scanner := bufio.NewScanner(file)
-			videoIndex := 0
-			// Note: 一時リスト使用時は総数が不明なため、(index/不明) と表示
-			for scanner.Scan() {
-				videoIndex++
-				filePath := strings.TrimSpace(scanner.Text())
-				if filePath == "" {
-					continue
-				}
-				logger.Printf("--- 動画エンコード (%d/不明): %s ---", videoIndex, filepath.Base(filePath))
-				outputPath, pathErr := getOutputPath(filePath, sourceDir, destDir)
-				if pathErr != nil {
-					errMsg := fmt.Sprintf("動画出力パス計算失敗 (%s): %v", filePath, pathErr)
-					logger.Printf("エラー: %s", errMsg)
-					videoProcessingErrors = append(videoProcessingErrors, errMsg)
-					continue
-				}
-				// processVideoFile に outputDir を渡す
-				outputDir := filepath.Dir(outputPath)
-				if err := processVideoFile(filePath, outputPath, outputDir, tempDir, ffmpegPriority, hwEncoder, cpuEncoder, hwEncoderOptions, cpuEncoderOptions, timeoutSeconds, quickModeFlag); err != nil {
-					videoProcessingErrors = append(videoProcessingErrors, fmt.Sprintf("%s: %v", filepath.Base(filePath), err))
-				}
-			}
-			if err := scanner.Err(); err != nil {
-				logger.Printf("エラー: 一時リストのスキャン中にエラーが発生: %v", err)
-				videoProcessingErrors = append(videoProcessingErrors, fmt.Sprintf("一時リストスキャンエラー: %v", err))
-			}
-		} else { // メモリ上のリストを使用
-			videoCount := len(videoFiles)
-			if videoCount > 0 {
-				logger.Printf("メモリ上のリストから %d 件の動画を処理します。", videoCount)
-				for i, vidFile := range videoFiles {
-					logger.Printf("--- 動画エンコード (%d/%d): %s ---", i+1, videoCount, filepath.Base(vidFile))
-					outputPath, pathErr := getOutputPath(vidFile, sourceDir, destDir)
-					if pathErr != nil {
-						errMsg := fmt.Sprintf("動画出力パス計算失敗 (%s): %v", vidFile, pathErr)
-						logger.Printf("エラー: %s", errMsg)
-						videoProcessingErrors = append(videoProcessingErrors, errMsg)
-						continue
-					}
-					// processVideoFile に outputDir を渡す
-					outputDir := filepath.Dir(outputPath)
-					if err := processVideoFile(vidFile, outputPath, outputDir, tempDir, ffmpegPriority, hwEncoder, cpuEncoder, hwEncoderOptions, cpuEncoderOptions, timeoutSeconds, quickModeFlag); err != nil {
-						videoProcessingErrors = append(videoProcessingErrors, fmt.Sprintf("%s: %v", filepath.Base(vidFile), err))
-					}
-				}
-			} else {
-				logger.Println("エンコード対象の動画ファイルはありません。")
-			}
+		if err != nil {
+			stopInterruptHandler()
+			logger.Fatalf("エラー: %v", err)
 		}
-		logger.Println("--- 動画エンコード処理終了 ---")
-		allErrors = append(allErrors, videoProcessingErrors...)
+		printPlan(plan)
+		return 0
+	}
 
-		logger.Println("--- ディレクトリ処理モード終了 ---")
+	// --- メイン処理の分岐 ---
+	// (出力ディレクトリの作成、ジャーナル、QuickMode 回復処理、一時ディレクトリは変換エンジンが扱う)
+	var report *transav1.Report
+	if isSingleFileMode {
+		report, err = converter.ConvertFile(ctx, sourceDir, destDir)
+	} else {
+		report, err = converter.ConvertTree(ctx, sourceDir, destDir)
+	}
+	if err != nil {
+		stopInterruptHandler()
+		logger.Fatalf("エラー: %v", err)
 	}
 
 	// --- 終了処理 ---
-	endTime := time.Now()
-	elapsedTime := endTime.Sub(startTime)
-	logger.Printf("総処理時間: %v", elapsedTime.Round(time.Second))
+	return finishReport(report)
+}
 
-	if len(allErrors) > 0 {
-		logger.Printf("--- 処理中に %d 件のエラーが発生しました ---", len(allErrors))
+// finishReport: 実行結果のエラー一覧を出力し、終了コードを返す (0: 成功, 1: エラーあり, 130: 中断)
+func finishReport(report *transav1.Report) int {
+	errs := report.Errors
+	exitCode := report.ExitCode()
+	if len(errs) > 0 {
+		logger.Printf("--- 処理中に %d 件のエラーが発生しました ---", len(errs))
 		limit := 20
-		for i, e := range allErrors {
+		for i, e := range errs {
 			if i >= limit {
-				logger.Printf("  ...他 %d 件のエラー (詳細はログファイルを確認してください)", len(allErrors)-limit)
+				logger.Printf("  ...他 %d 件のエラー (詳細はログファイルを確認してください)", len(errs)-limit)
 				break
 			}
 			logger.Printf("  [%d] %s", i+1, e)
 		}
-		os.Exit(1) // エラー終了コード
-	} else {
+	} else if exitCode == 0 {
 		logger.Println("全ての処理が正常に完了しました。")
 	}
+	return exitCode
+}
+
+// normalizePaths: -s / -o を絶対パスに正規化し、同じディレクトリでないことを確認する (-s は省略可能なコマンドもある)
+func normalizePaths() {
+	var err error
+	if sourceDir != "" {
+		sourceDir, err = filepath.Abs(filepath.Clean(sourceDir))
+		if err != nil {
+			logger.Fatalf("エラー: 入力元パス '%s' の正規化に失敗: %v", flag.Lookup("s").Value, err) // 元の入力値も表示
+		}
+		logger.Printf("入力元 (正規化後): %s", sourceDir)
+	}
+	destDir, err = filepath.Abs(filepath.Clean(destDir))
+	if err != nil {
+		logger.Fatalf("エラー: 出力先パス '%s' の正規化に失敗: %v", flag.Lookup("o").Value, err) // 元の入力値も表示
+	}
+	logger.Printf("出力先 (正規化後): %s", destDir)
+	if sourceDir == "" {
+		return
+	}
+	// シンボリックリンクを解決して入力元と出力先の重複を確認する
+	// (出力先が入力元の中にある場合は、変換エンジンが入力元の走査から出力先を除外する)
+	resolvedSrc, resolvedDst := transav1.ResolvePath(sourceDir), transav1.ResolvePath(destDir)
+	switch {
+	case resolvedSrc == resolvedDst:
+		logger.Fatalf("エラー: 入力元と出力先が同じディレクトリです。")
+	case transav1.IsSubPath(resolvedDst, resolvedSrc):
+		logger.Fatalf("エラー: 入力元 '%s' が出力先 '%s' の中にあります (出力先の掃除や -force で入力元が削除されるおそれがあります)。", sourceDir, destDir)
+	}
+}
+
+// locateFFmpeg: ffmpeg (必須) と ffprobe (任意) を検索し、ffmpegPath / ffprobePath に設定する
+// (-ffmpegdir を優先し、なければ環境変数PATH)
+func locateFFmpeg() {
+	var fromPath bool
+	var err error
+	ffmpegPath, fromPath, err = findTool(ffmpegDir, "ffmpeg")
+	if err != nil {
+		logger.Fatalf("エラー: ffmpeg が見つかりません。-ffmpegdir で指定されたパス '%s' にもなく、環境変数PATHにもありません。", ffmpegDir)
+	}
+	if fromPath {
+		logger.Printf("情報: ffmpeg を環境変数PATHから使用します: %s", ffmpegPath)
+	} else {
+		logger.Printf("情報: ffmpeg を指定ディレクトリから使用します: %s", ffmpegPath)
+	}
+
+	// ffprobe のパス解決 (任意)
+	ffprobePath, fromPath, err = findTool(ffmpegDir, "ffprobe")
+	if err != nil {
+		logger.Printf("警告: ffprobe が見つかりません (-ffmpegdir '%s' または PATH)。一部機能が制限される可能性があります。", ffmpegDir)
+		ffprobePath = ""
+	} else if fromPath {
+		logger.Printf("情報: ffprobe を環境変数PATHから使用します: %s", ffprobePath)
+	} else {
+		logger.Printf("情報: ffprobe を指定ディレクトリから使用します: %s", ffprobePath)
+	}
+}
+
+// removeDestDir: 対話的に確認した後、出力先ディレクトリを完全に削除する (-force)
+// 削除をキャンセルした場合は処理を中断して終了する
+func removeDestDir(dir string) {
+	logger.Printf("!!! 警告: -force オプションが指定されました。出力ディレクトリ '%s' を完全に削除します。", dir)
+	fmt.Fprint(consoleOut, "本当に実行しますか？ (yes/no): ")
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		logger.Fatalf("エラー: 確認入力の読み取りに失敗しました: %v", err)
+	}
+	input = strings.TrimSpace(strings.ToLower(input))
+
+	if input != "yes" {
+		logger.Println("削除をキャンセルしました。処理を中断します。")
+		os.Exit(0)
+	}
+	logger.Printf("出力ディレクトリ '%s' を削除しています...", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Fatalf("エラー: 出力ディレクトリ削除失敗: %v", err)
+	}
+	logger.Println("出力ディレクトリを削除しました。")
+}
+
+// findTool: ffmpeg/ffprobe の実行ファイルを -ffmpegdir で指定されたディレクトリ、環境変数PATH の順に検索する
+// name: 拡張子を除いた実行ファイル名 (Windows では .exe を付与する)
+// 戻り値 fromPath は環境変数PATHから見つかった場合に true
+func findTool(dir, name string) (path string, fromPath bool, err error) {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	path = filepath.Join(dir, name) // 指定ディレクトリを優先
+	if _, err := exec.LookPath(path); err == nil {
+		path, _ = filepath.Abs(path)
+		return path, false, nil
+	}
+	path, err = exec.LookPath(name)
+	if err != nil {
+		return "", false, err
+	}
+	return path, true, nil
 }
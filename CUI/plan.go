@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"TransAV1_CUI/transav1"
+)
+
+// --- -dry-run: 実行計画の表示 ---
+
+// printPlan: 実行計画を標準出力に表示する
+func printPlan(plan *transav1.Plan) {
+	fmt.Println("--- 実行計画 (-dry-run: ファイルの変更と ffmpeg の実行は行いません) ---")
+	fmt.Printf("入力元: %s\n出力先: %s\n", plan.Source, plan.Dest)
+	if plan.RemoveDest {
+		fmt.Printf("\n[出力先ディレクトリの削除 (-force)] %s (%d 件, %s)\n", plan.Dest, plan.RemoveFiles, transav1.FormatSize(plan.RemoveBytes))
+		fmt.Println("  変換の前に、確認の上で出力先ディレクトリを完全に削除します。")
+	}
+	if plan.Journal {
+		fmt.Println("(出力先のジャーナルを参照して判定しています)")
+	}
+
+	printPlanSection("出力名の衝突", plan.Collisions)
+	printPlanSection("QuickMode 回復処理", plan.Recover)
+	printPlanSection("-restart で削除・未処理に戻す", plan.Restart)
+	printPlanSection("エンコードする動画", plan.Encode)
+	printPlanSection("出力済みのためスキップする動画", plan.Skip)
+	printPlanSection("コピーするその他のファイル", plan.Copy)
+	printPlanSection("出力先に既に存在するためコピーしないファイル", plan.CopySkip)
+	printPlanSection("処理対象から除外するファイル・ディレクトリ", plan.Excluded)
+
+	fmt.Printf("\n合計: エンコード %d 件 (%s), スキップ %d 件, コピー %d 件 (%s), コピー不要 %d 件, 除外 %d 件\n",
+		len(plan.Encode), transav1.FormatSize(planSize(plan.Encode)), len(plan.Skip),
+		len(plan.Copy), transav1.FormatSize(planSize(plan.Copy)), len(plan.CopySkip), len(plan.Excluded))
+	if len(plan.Encode) > 0 {
+		fmt.Println("注意: AV1 ソースの判定と入力の読み取り確認は実行時に行われるため、エンコードする動画に含めています。")
+		if ct, _ := transav1.ParseContainer(containerFlag); ct == transav1.ContainerAuto {
+			fmt.Println("注意: -container auto では、入力のストリームにより出力が .mkv になることがあります。")
+		}
+	}
+}
+
+// printPlanSection: 実行計画の1区分を表示する (対象がない区分は表示しない)
+func printPlanSection(title string, items []transav1.PlanItem) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("\n[%s] %d 件\n", title, len(items))
+	for _, item := range items {
+		line := "  " + filepath.FromSlash(item.Source)
+		switch {
+		case item.Source == "":
+			line = "  " + filepath.FromSlash(item.Output)
+		case item.Output != "" && item.Output != item.Source:
+			line += " -> " + filepath.FromSlash(item.Output)
+		}
+		if item.Detail != "" {
+			line += " (" + item.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// planSize: 実行計画の入力ファイルの合計サイズを求める
+func planSize(items []transav1.PlanItem) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	return total
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"TransAV1_CUI/transav1"
+)
+
+// setupInterruptHandler: Ctrl+C / SIGTERM を受信したら取り消されるコンテキストを作成する
+// 1回目のシグナルでは実行中の ffmpeg を停止して後処理を行い、2回目のシグナルで即座に強制終了する
+// 戻り値の stop はシグナルの監視を終了する
+func setupInterruptHandler() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig, ok := <-sigCh
+		if !ok {
+			return
+		}
+		logger.Printf("警告: シグナル (%v) を受信しました。実行中の ffmpeg を停止し、後処理を行ってから終了します。", sig)
+		logger.Println("  (もう一度受信すると後処理を行わずに強制終了します)")
+		cancel()
+
+		sig, ok = <-sigCh
+		if !ok {
+			return
+		}
+		logger.Printf("エラー: シグナル (%v) を再度受信したため強制終了します。QuickMode の回復は次回起動時に行われます。", sig)
+		os.Exit(transav1.ExitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		close(sigCh)
+		cancel()
+	}
+}
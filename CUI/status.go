@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"TransAV1_CUI/transav1"
+)
+
+// --- status: 入力元と出力先を照合した進捗状況の表示 ---
+
+var (
+	statusJSON  bool // 結果を JSON で出力するか (-json)
+	statusFiles bool // 全ての動画の状態を一覧表示するか (-files)
+)
+
+// statusLabels: 状態の表示名
+var statusLabels = map[transav1.FileState]string{
+	transav1.FileDone:       "変換済み",
+	transav1.FileFailed:     "失敗",
+	transav1.FileTimeout:    "タイムアウト",
+	transav1.FileInProgress: "処理中・中断",
+	transav1.FilePending:    "未処理",
+	transav1.FileSkipped:    "スキップ",
+}
+
+// printStatusUsage: status のヘルプメッセージを表示する
+func printStatusUsage() {
+	printMaintenanceUsage("status -s <入力元ディレクトリ> -o <出力先ディレクトリ> [-json] [-files]", `説明 (Description):
+  変換を行わずに、入力元の各動画に対応する出力 (「`+transav1.OutputSuffix+`」形式、-container の指定に従う)、失敗マーカー、
+  ジャーナルを照合し、動画ごとの状態を集計して表示します (ファイルは変更しません)。
+    変換済み / 失敗 (*.failed, *.failed_NN など) / タイムアウト (*.timeout) /
+    処理中・中断 (*.processing, *.origin) / 未処理 / スキップ (AV1 ソースなど)
+  状態ごとの件数と入力の合計サイズ、変換済みの動画の出力サイズと削減できた容量を表示します。
+  -json を指定すると、集計と動画ごとの状態を JSON で標準出力に出力します。
+`)
+}
+
+// registerStatusFlags: status のフラグを登録する
+func registerStatusFlags() {
+	flag.StringVar(&sourceDir, "s", "", "入力元ディレクトリ (必須)")
+	flag.StringVar(&destDir, "o", "", "出力先ディレクトリ (必須)")
+	flag.BoolVar(&statusJSON, "json", false, "結果を JSON で出力する")
+	flag.BoolVar(&statusFiles, "files", false, "全ての動画の状態を一覧表示する (既定では失敗・タイムアウト・処理中のみ)")
+	flag.BoolVar(&debugMode, "debug", false, "詳細ログ出力")
+	registerFilterFlags() // 変換時と同じ絞り込みを指定すると、除外したファイルを数えない
+	flag.StringVar(&collisionFlag, "collision", defaultCollision, "出力名が衝突した場合の扱い (number|ext|fail, 変換時と揃える)")
+	flag.StringVar(&containerFlag, "container", defaultContainer, "出力のコンテナ (mp4|mkv|webm|auto, 変換時と揃える)")
+	flag.StringVar(&configPath, "config", "", "JSON 設定ファイル (拡張子ごとの扱い \"extensions\" を変換時と揃える)")
+}
+
+// runStatus: status サブコマンドを実行し、終了コードを返す
+func runStatus() int {
+	// 標準出力は集計結果専用にするため、ログ (警告など) は標準エラー出力に出力する
+	consoleOut = os.Stderr
+	setupLogging(destDir, startTime, false, debugMode)
+	requireFlags(true)
+	normalizePaths()
+
+	cfg := transav1.DefaultConfig()
+	applyFilterFlags(&cfg)
+	applyClassifyConfig(&cfg, loadConfigFlag())
+	cfg.Collision = transav1.CollisionPolicy(collisionFlag)
+	cfg.Container = transav1.Container(containerFlag)
+	cfg.Logger = logger
+	if debugMode {
+		cfg.DebugLogger = debugLogger
+	}
+	ctx, stopInterruptHandler := setupInterruptHandler()
+	defer stopInterruptHandler()
+	rep, err := transav1.TreeStatus(ctx, cfg, sourceDir, destDir)
+	if err != nil {
+		stopInterruptHandler()
+		logger.Fatalf("エラー: %v", err)
+	}
+
+	if statusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			logger.Printf("エラー: 結果の出力に失敗: %v", err)
+			return 1
+		}
+		return 0
+	}
+	printStatus(rep)
+	return 0
+}
+
+// printStatus: 進捗状況を表形式で出力する
+func printStatus(rep *transav1.StatusReport) {
+	width := displayWidth("合計")
+	for _, s := range transav1.FileStates {
+		width = max(width, displayWidth(statusLabels[s]))
+	}
+	row := func(label string, t transav1.StateTotal) {
+		pad := strings.Repeat(" ", width-displayWidth(label))
+		fmt.Printf("  %s%s  %6d 件  %10s\n", label, pad, t.Count, transav1.FormatSize(t.Bytes))
+	}
+
+	fmt.Printf("進捗状況: %s -> %s\n", rep.Source, rep.Dest)
+	if !rep.Journal {
+		fmt.Println("  (ジャーナルがないため、出力とマーカーファイルの有無から判定しています)")
+	}
+	for _, s := range transav1.FileStates {
+		row(statusLabels[s], rep.States[s])
+	}
+	row("合計", rep.Total)
+
+	done := rep.States[transav1.FileDone]
+	if rep.Total.Count > 0 {
+		processed := done.Count + rep.States[transav1.FileSkipped].Count // 処理が不要になった動画
+		fmt.Printf("\n進捗: %.1f%% (%d / %d 件)\n", float64(processed)*100/float64(rep.Total.Count), processed, rep.Total.Count)
+	}
+	if done.Bytes > 0 {
+		fmt.Printf("変換済みの動画: 入力 %s -> 出力 %s (削減: %s, %.1f%%)\n",
+			transav1.FormatSize(done.Bytes), transav1.FormatSize(rep.OutputBytes), transav1.FormatSize(rep.SavedBytes), float64(rep.SavedBytes)*100/float64(done.Bytes))
+	}
+
+	// --- 動画ごとの状態 (既定では対処が必要なもののみ) ---
+	var listed []transav1.FileStatus
+	for _, f := range rep.Files {
+		if statusFiles || f.State == transav1.FileFailed || f.State == transav1.FileTimeout || f.State == transav1.FileInProgress {
+			listed = append(listed, f)
+		}
+	}
+	if len(listed) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, f := range listed {
+		state := statusLabels[f.State]
+		if f.Marker != "" {
+			state += " " + f.Marker
+		}
+		line := fmt.Sprintf("  [%s] %s", state, filepath.FromSlash(f.Source))
+		if f.Detail != "" {
+			line += ": " + f.Detail
+		}
+		fmt.Println(line)
+	}
+}
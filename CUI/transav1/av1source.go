@@ -0,0 +1,117 @@
+package transav1
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AV1Policy: 入力の映像が既に AV1 の場合の扱い (-av1src)
+type AV1Policy string
+
+const (
+	AV1Encode AV1Policy = "encode" // 通常どおり再エンコードする (従来の動作)
+	AV1Skip   AV1Policy = "skip"   // 何もしない (出力先に何も作成しない)
+	AV1Copy   AV1Policy = "copy"   // その他のファイルと同様に元のファイル名のままコピーする
+	AV1Remux  AV1Policy = "remux"  // 再エンコードせずに出力のコンテナ (Config.Container) へ再多重化する
+)
+
+// ParseAV1Policy: -av1src の指定値を解釈する (大文字小文字は区別しない)
+func ParseAV1Policy(s string) (AV1Policy, error) {
+	switch p := AV1Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case AV1Encode, AV1Skip, AV1Copy, AV1Remux:
+		return p, nil
+	}
+	return "", fmt.Errorf("不明な AV1 ソースの扱い: '%s' (encode, skip, copy, remux のいずれか)", s)
+}
+
+// isAV1Source: ffprobe の結果から、入力の映像が既に AV1 かどうかを判定する
+func isAV1Source(info *mediaInfo) bool {
+	if info == nil {
+		return false
+	}
+	v := info.videoStream()
+	return v != nil && v.CodecName == "av1"
+}
+
+// handleAV1Source: 入力が AV1 の場合に -av1src の指定に従って処理する
+// 戻り値 handled が true の場合、エンコードは不要 (処理済み)
+// 再多重化 (AV1Remux) の場合は job.remux を設定して handled = false を返し、エンコードと同じ準備
+// (一時ディレクトリへのコピーまたは Quick モードのリネーム) の後に remuxAV1Source で処理する
+func (r *run) handleAV1Source(job *videoJob, policy AV1Policy) (handled bool, err error) {
+	if policy == AV1Encode || !isAV1Source(job.sourceInfo) {
+		return false, nil
+	}
+	inputFile := job.inputFile
+
+	switch policy {
+	case AV1Skip:
+		r.logger.Printf("スキップ (AV1 ソース): %s", filepath.Base(inputFile))
+		job.skipped = true
+		r.journal.record(journalEntry{Source: inputFile, Output: job.outputFile, State: stateSkipped, Note: "AV1 ソースのためスキップ"})
+		r.summary.add(summaryAV1Skipped, inputFile)
+		return true, nil
+
+	case AV1Copy:
+		copyPath := filepath.Join(job.outputDir, filepath.Base(inputFile))
+		r.logger.Printf("コピー (AV1 ソース): %s", filepath.Base(inputFile))
+		if err := r.copyOtherFile(inputFile, copyPath); err != nil {
+			return false, err
+		}
+		job.skipped, job.placed = true, copyPath
+		var outputSize int64
+		if info, err := os.Stat(copyPath); err == nil {
+			outputSize = info.Size()
+		}
+		r.journal.record(journalEntry{Source: inputFile, Output: copyPath, State: stateDone, InputSize: job.inputSize, OutputSize: outputSize, Note: "AV1 ソースのためコピー"})
+		r.summary.add(summaryAV1Copied, inputFile)
+		return true, nil
+	}
+
+	job.remux = true
+	return false, nil
+}
+
+// remuxAV1Source: 準備済みのジョブの AV1 ソースを、再エンコードせずに出力のコンテナへ再多重化する (AV1Remux)
+// エンコードと同様に一時出力へ書き出し、検証 (-verify) してから finishEncodeSuccess で最終パスへ配置する
+// 失敗した場合は finishEncodeFailure で失敗マーカーを作成する (エンコーダチェーンの次の段では再試行しない)
+func (r *run) remuxAV1Source(job *videoJob) error {
+	r.logger.Printf("再多重化 (AV1 ソース): %s -> %s", filepath.Base(job.inputFile), filepath.Base(job.outputFile))
+
+	ctx, cancel := r.timeoutContext(r.cfg.Timeout)
+	job.attempts++
+	// 映像は -c:v copy、音声・字幕は Config.Streams などの指定に従う (サイドカーも多重化する)
+	job.streams = r.mapStreams(job.sourceInfo, job.outputFile, true, false, job.sidecars)
+	job.muxing = job.streams.sidecars
+	job.usedEncoder, job.usedOptions = "copy", JoinOptions(job.streams.args)
+	job.note = "AV1 ソースのため再多重化"
+	r.progress.encodeStarted(job)
+	result := r.executeFFmpeg(ctx, job.currentInputFile, job.tempOutputPath, "copy", nil, job.streams, func(p ffmpegProgress) {
+		r.progress.update(job, "copy", p)
+		r.events.progress(job, "copy", p)
+	})
+	cancel()
+	job.lastResult = result
+
+	if result.err == nil && result.exitCode == 0 {
+		if verifyErr := r.verifyOutput(job, job.tempOutputPath); verifyErr != nil {
+			r.logger.Printf("エラー: 再多重化の出力の検証失敗: %v", verifyErr)
+			result = ffmpegResult{err: fmt.Errorf("出力の検証失敗: %w", verifyErr), exitCode: 0, verifyFailed: true}
+			job.lastResult = result
+		} else {
+			if _, err := r.finishEncodeSuccess(job); err != nil {
+				return err
+			}
+			r.summary.add(summaryAV1Remuxed, job.inputFile)
+			return nil
+		}
+	}
+
+	if r.interrupted() {
+		r.rollbackInterruptedJob(job)
+		return ErrInterrupted
+	}
+	r.logger.Printf("再多重化失敗 (ExitCode: %d, TimedOut: %t): %v", result.exitCode, result.timedOut, result.err)
+	return r.finishEncodeFailure(job, result)
+}
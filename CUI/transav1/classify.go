@@ -0,0 +1,161 @@
+package transav1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// --- 入力元のファイルの分類 (Config.Extensions / Config.Sniff) ---
+// 既定では videoExtensions の拡張子をエンコードし、それ以外はそのままコピーする。
+// Config.Extensions で拡張子ごとの扱いを上書きでき、Config.Sniff を指定すると
+// 拡張子が未知のファイルを ffprobe で調べ、動画であればエンコードする (拡張子の誤りへの対応)。
+
+// FileClass: 入力元のファイルの扱い
+type FileClass string
+
+const (
+	ClassEncode FileClass = "encode"        // AV1 にエンコードする (動画)
+	ClassCopy   FileClass = "copy"          // そのままコピーする
+	ClassIgnore FileClass = "ignore"        // 処理しない (コピーもしない)
+	ClassImage  FileClass = "convert-image" // 静止画を AVIF に変換する (失敗した場合はそのままコピーする)
+)
+
+// ImageSuffix: 静止画の変換 (convert-image) の出力ファイル名のサフィックス (例: photo.jpg -> photo_AV1.avif)
+const ImageSuffix = "_AV1.avif"
+
+// ParseFileClass: 拡張子ごとの扱いの指定値を解釈する (大文字小文字は区別しない)
+func ParseFileClass(s string) (FileClass, error) {
+	switch c := FileClass(strings.ToLower(strings.TrimSpace(s))); c {
+	case ClassEncode, ClassCopy, ClassIgnore, ClassImage:
+		return c, nil
+	}
+	return "", fmt.Errorf("不明なファイルの扱い: '%s' (encode, copy, ignore, convert-image のいずれか)", s)
+}
+
+// classifier: 拡張子からファイルの扱いを決める
+type classifier struct {
+	classes map[string]FileClass // 拡張子 (小文字, "." 付き) ごとの扱い
+}
+
+// newClassifier: 既定の分類に Config.Extensions の指定を反映した classifier を作成する
+func newClassifier(cfg Config) (*classifier, error) {
+	c := &classifier{classes: make(map[string]FileClass)}
+	for ext := range videoExtensions {
+		c.classes[ext] = ClassEncode
+	}
+	for ext := range imageExtensions {
+		c.classes[ext] = ClassCopy
+	}
+	for ext, class := range cfg.Extensions {
+		norm := strings.ToLower(strings.TrimSpace(ext))
+		if norm != "" && !strings.HasPrefix(norm, ".") {
+			norm = "." + norm
+		}
+		if len(norm) < 2 || strings.ContainsAny(norm[1:], `./\`) {
+			return nil, fmt.Errorf("拡張子 '%s' の指定が正しくありません (例: \".vob\")", ext)
+		}
+		parsed, err := ParseFileClass(string(class))
+		if err != nil {
+			return nil, fmt.Errorf("拡張子 '%s': %w", ext, err)
+		}
+		c.classes[norm] = parsed
+	}
+	return c, nil
+}
+
+// classOf: 拡張子からファイルの扱いを返す (known: 既定の分類または Config.Extensions に含まれる拡張子か)
+// 未知の拡張子はコピーする。変換済みの出力の名前 (「名前_AV1.mp4」) のファイルはエンコードせずにコピーする
+func (c *classifier) classOf(path string) (class FileClass, known bool) {
+	if isOutputName(path) {
+		return ClassCopy, true
+	}
+	if c == nil {
+		if IsVideoFile(path) {
+			return ClassEncode, true
+		}
+		return ClassCopy, false
+	}
+	class, known = c.classes[strings.ToLower(filepath.Ext(path))]
+	if !known {
+		return ClassCopy, false
+	}
+	return class, true
+}
+
+// classify: 入力元のファイルの扱いを決める
+// Config.Sniff の場合、拡張子が未知のファイルは ffprobe で調べ、エンコードできる動画であれば ClassEncode とする
+func (r *run) classify(path string) FileClass {
+	class, known := r.classes.classOf(path)
+	if known || !r.sniff {
+		return class
+	}
+	info, err := r.probeMedia(r.ctx, path)
+	if err != nil || validateMediaInfo(info) != nil {
+		r.debugf("内容の判定: 動画ではありません (%s)", path)
+		return class
+	}
+	r.logger.Printf("情報: 拡張子が未知のファイルを内容から動画と判定しました: %s (形式: %s)", path, info.Format.FormatName)
+	return ClassEncode
+}
+
+// imageOutputPath: 静止画の変換 (convert-image) の出力パスを求める
+func imageOutputPath(outputFile string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ImageSuffix
+}
+
+// convertImage: 静止画を AVIF に変換する (Config.ImageEncoder / ImageOptions, 出力が既に存在する場合は何もしない)
+// 書きかけの出力が残らないよう、一時ファイルに書き出してから出力パスへリネームする
+func (r *run) convertImage(inputFile, outputFile string) error {
+	if r.fileExists(outputFile) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("出力ディレクトリ '%s' 作成エラー: %w", filepath.Dir(outputFile), err)
+	}
+	options, err := SplitOptions(r.cfg.ImageOptions) // New で検証済み
+	if err != nil {
+		return err
+	}
+	tempOutput := outputFile + ".tmp"
+	args := []string{"-hide_banner", "-nostdin", "-v", "error", "-i", inputFile, "-frames:v", "1", "-c:v", r.cfg.ImageEncoder}
+	args = append(args, options...)
+	args = append(args, "-f", "avif", "-y", tempOutput)
+
+	ctx, cancel := r.timeoutContext(r.cfg.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.cfg.FFmpegPath, args...)
+	setOSSpecificAttrs(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	r.debugf("画像変換: %s %s", r.cfg.FFmpegPath, strings.Join(args, " "))
+	if err := r.startProcess(cmd, r.cfg.Priority); err != nil {
+		return fmt.Errorf("画像変換の開始エラー: %w", err)
+	}
+	err = cmd.Wait()
+	if err == nil {
+		if info, statErr := os.Stat(tempOutput); statErr != nil || info.Size() == 0 {
+			err = fmt.Errorf("出力が作成されませんでした")
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tempOutput)
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("画像変換タイムアウト (%v経過)", r.cfg.Timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("画像変換失敗 (%s): %s", r.cfg.ImageEncoder, msg)
+	}
+	if err := os.Rename(tempOutput, outputFile); err != nil {
+		_ = os.Remove(tempOutput)
+		return fmt.Errorf("変換した画像のリネーム失敗 (%s): %w", outputFile, err)
+	}
+	return nil
+}
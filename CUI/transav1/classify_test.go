@@ -0,0 +1,68 @@
+package transav1
+
+import "testing"
+
+func TestClassOf(t *testing.T) {
+	extensions := map[string]FileClass{
+		".vob":  ClassEncode,
+		"TS":    ClassCopy, // 「.」なし・大文字も可
+		".tmp":  ClassIgnore,
+		".jpg":  ClassImage,
+		" .Iso": "IGNORE",
+	}
+	c, err := newClassifier(Config{Extensions: extensions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path      string
+		wantClass FileClass
+		wantKnown bool
+	}{
+		{"movie.mkv", ClassEncode, true},
+		{"dir/MOVIE.MP4", ClassEncode, true},
+		{"photo.png", ClassCopy, true},
+		{"readme.txt", ClassCopy, false},
+		{"noext", ClassCopy, false},
+		{"disc.vob", ClassEncode, true},
+		{"rec.ts", ClassCopy, true},
+		{"cache.tmp", ClassIgnore, true},
+		{"photo.JPG", ClassImage, true},
+		{"disc.iso", ClassIgnore, true},
+		{"movie_AV1.mp4", ClassCopy, true}, // 変換済みの出力はエンコードしない
+		{"movie_AV1.mkv", ClassCopy, true},
+		{"movie_av1.webm", ClassCopy, true},
+	}
+	for _, tt := range tests {
+		class, known := c.classOf(tt.path)
+		if class != tt.wantClass || known != tt.wantKnown {
+			t.Errorf("classOf(%q) = (%s, %v), want (%s, %v)", tt.path, class, known, tt.wantClass, tt.wantKnown)
+		}
+	}
+
+	// classifier がない場合は既定の動画の拡張子のみエンコードする
+	var none *classifier
+	for _, tt := range []struct {
+		path      string
+		wantClass FileClass
+	}{
+		{"movie.mkv", ClassEncode},
+		{"disc.vob", ClassCopy},
+		{"movie_AV1.mp4", ClassCopy},
+	} {
+		if class, _ := none.classOf(tt.path); class != tt.wantClass {
+			t.Errorf("(nil).classOf(%q) = %s, want %s", tt.path, class, tt.wantClass)
+		}
+	}
+}
+
+func TestNewClassifierInvalid(t *testing.T) {
+	for _, ext := range []string{"", ".", ".tar.gz", "a/b", `.a\b`} {
+		if _, err := newClassifier(Config{Extensions: map[string]FileClass{ext: ClassCopy}}); err == nil {
+			t.Errorf("newClassifier(%q) = nil, want error", ext)
+		}
+	}
+	if _, err := newClassifier(Config{Extensions: map[string]FileClass{".vob": "transcode"}}); err == nil {
+		t.Error("newClassifier(不明な扱い) = nil, want error")
+	}
+}
@@ -0,0 +1,275 @@
+package transav1
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- 出力名の衝突 (Config.Collision) ---
+// 出力名は入力の拡張子を除いた名前に出力のサフィックス (OutputSuffixFor) を付けるため、同じディレクトリの
+// clip.mov と clip.MKV はどちらも clip_AV1.mp4 になる。衝突は入力元のディレクトリごとに
+// 兄弟のファイルから決定的に解決するため、convert / -dry-run / status / verify で同じ出力名になる。
+
+// CollisionPolicy: 出力名が衝突した場合の扱い (-collision)
+type CollisionPolicy string
+
+const (
+	CollisionNumber CollisionPolicy = "number" // 2件目以降 (名前順) の出力名に番号を付ける (clip_AV1.mp4, clip_2_AV1.mp4)
+	CollisionExt    CollisionPolicy = "ext"    // 衝突した全ての出力名に元の拡張子を含める (clip_mov_AV1.mp4, clip_MKV_AV1.mp4)
+	CollisionFail   CollisionPolicy = "fail"   // 衝突がある場合は変換を開始しない
+)
+
+// ParseCollisionPolicy: -collision の指定値を解釈する (大文字小文字は区別しない)
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch p := CollisionPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case CollisionNumber, CollisionExt, CollisionFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("不明な扱い: '%s' (number, ext, fail のいずれか)", s)
+}
+
+// outputCollision: 同じ出力名になる入力の組
+type outputCollision struct {
+	dir    string   // 入力元のディレクトリ
+	output string   // 衝突した出力名 (変更前)
+	inputs []string // 入力のファイル名 (名前順)
+	// recorded: ジャーナル上で変更前の出力名を使用している他の入力 (以前の実行の出力, 入力元からの相対パス)
+	recorded []string
+	outputs  []string // 解決後の出力名 (inputs と同じ順, CollisionFail の場合は変更前のまま)
+}
+
+// String: ログ表示用 (例: "clip.MKV -> clip_AV1.mp4, clip.mov -> clip_2_AV1.mp4")
+func (oc outputCollision) String() string {
+	parts := make([]string, len(oc.inputs))
+	for i, input := range oc.inputs {
+		parts[i] = input + " -> " + oc.outputs[i]
+	}
+	if len(oc.recorded) > 0 {
+		return strings.Join(parts, ", ") + " (以前の実行の出力: " + strings.Join(oc.recorded, ", ") + ")"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// members: 衝突した入力と、変更前の出力名を使用している他の入力 (エラー表示用)
+func (oc outputCollision) members() string {
+	return strings.Join(append(append([]string(nil), oc.inputs...), oc.recorded...), ", ")
+}
+
+// outputNames: 入力元のディレクトリごとの出力名の解決結果とサイドカーの対応 (ディレクトリを最初に参照した時に求める)
+type outputNames struct {
+	mu   sync.Mutex
+	dirs map[string]*dirOutputNames
+}
+
+// dirOutputNames: 1ディレクトリ分の出力名の解決結果
+type dirOutputNames struct {
+	renamed    map[string]string // 入力のファイル名 -> 衝突により変更した出力名 (変更したもののみ)
+	collisions []outputCollision
+	sidecars   map[string]string // サイドカーのファイル名 -> 対応する動画の入力のファイル名 (sidecar.go)
+}
+
+// dirNames: 入力のディレクトリの出力名の解決結果を返す (fresh: 今回求めたか)
+func (r *run) dirNames(srcRoot, dir string) (names *dirOutputNames, fresh bool) {
+	r.names.mu.Lock()
+	defer r.names.mu.Unlock()
+	if names, ok := r.names.dirs[dir]; ok {
+		return names, false
+	}
+	if r.names.dirs == nil {
+		r.names.dirs = make(map[string]*dirOutputNames)
+	}
+	names = r.resolveDirNames(srcRoot, dir)
+	r.names.dirs[dir] = names
+	return names, true
+}
+
+// resolveDirNames: ディレクトリ内のエンコード対象の入力から出力名の衝突を探し、Config.Collision に従って解決する
+func (r *run) resolveDirNames(srcRoot, dir string) *dirOutputNames {
+	names := &dirOutputNames{renamed: make(map[string]string), sidecars: make(map[string]string)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		r.debugf("出力名の衝突確認: ディレクトリ '%s' を読み取れません: %v", dir, err)
+		return names
+	}
+
+	// 拡張子を除いた名前 (大文字小文字は区別しない) ごとに入力をまとめる
+	groups := make(map[string][]string)
+	var stems, others []string // others: 動画以外のファイル (サイドカーの候補)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), processingSuffix) // QuickMode でエンコード中の入力は元の名前で扱う
+		path := filepath.Join(dir, name)
+		if r.filter.excluded(srcRoot, path, false) {
+			continue
+		}
+		if class := r.classify(path); class != ClassEncode {
+			if class != ClassIgnore {
+				others = append(others, name)
+			}
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		if _, ok := groups[stem]; !ok {
+			stems = append(stems, stem)
+		}
+		if !containsString(groups[stem], name) { // 「名前」と「名前.processing」が両方ある場合
+			groups[stem] = append(groups[stem], name)
+		}
+	}
+	sort.Strings(stems)
+	for _, stem := range stems {
+		sort.Strings(groups[stem]) // 入力元の走査と同じ順
+	}
+	for _, name := range others {
+		if video, ok := matchSidecar(name, groups); ok {
+			names.sidecars[name] = video
+		}
+	}
+
+	// 以前の実行で決まった出力名 (ジャーナルの記録) は変更しない
+	// 入力元にない入力の出力が残っていれば、その出力名は使用中として扱う
+	assigned := make(map[string]string)        // 入力のファイル名 -> 記録された出力名 (拡張子を除いた名前)
+	owners := make(map[string]string)          // 記録された出力名 (小文字) -> その出力名を使用している入力 (入力元からの相対パス)
+	taken := make(map[string]bool, len(stems)) // 使用中の出力名 (拡張子を除いた名前, 小文字)
+	for _, e := range r.recordedOutputs(dir) {
+		stem, _ := outputStem(path.Base(e.Output))
+		key := strings.ToLower(stem)
+		if _, used := owners[key]; used {
+			continue // 同じ出力名の記録が複数ある場合は、先に採用した記録の入力が使用する
+		}
+		source := r.journal.sourcePath(e)
+		name := filepath.Base(source)
+		switch {
+		case filepath.Dir(source) == dir && containsString(groups[strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))], name):
+			assigned[name] = stem
+		case !r.fileExists(r.journal.outputPath(e)):
+			continue // 入力元にない入力の出力が残っていなければ、出力名は再び使用できる
+		}
+		owners[key] = e.Source
+		taken[key] = true
+	}
+	for _, stem := range stems {
+		taken[stem] = true
+	}
+	// unique: 使用されていない名前を求める (使用中なら番号を付ける)
+	unique := func(stem string, n int) string {
+		candidate := stem
+		if n > 1 {
+			candidate = stem + "_" + strconv.Itoa(n)
+		}
+		for taken[strings.ToLower(candidate)] {
+			n++
+			candidate = stem + "_" + strconv.Itoa(n)
+		}
+		taken[strings.ToLower(candidate)] = true
+		return candidate
+	}
+
+	for _, stem := range stems {
+		inputs := groups[stem]
+		var others []string // 変更前の出力名を使用している他の入力
+		if owner, ok := owners[stem]; ok && !containsString(inputs, path.Base(owner)) {
+			others = append(others, owner)
+		}
+		if len(inputs) < 2 && len(others) == 0 {
+			// 衝突していなくても、以前の実行で変更した出力名はそのまま使用する
+			if outStem, ok := assigned[inputs[0]]; ok && r.cfg.Collision != CollisionFail && !strings.EqualFold(outStem, stem) {
+				names.renamed[inputs[0]] = outStem + r.outputSuffix()
+			}
+			continue
+		}
+		oc := outputCollision{dir: dir, inputs: inputs, recorded: others, outputs: make([]string, len(inputs))}
+		// 変更前の出力名は、以前の実行で他の入力が使用していなければ、記録のない1件目の入力が使用する
+		baseFree := len(others) == 0
+		for _, input := range inputs {
+			if outStem, ok := assigned[input]; ok && strings.EqualFold(outStem, strings.TrimSuffix(input, filepath.Ext(input))) {
+				baseFree = false
+			}
+		}
+		for i, input := range inputs {
+			inputStem := strings.TrimSuffix(input, filepath.Ext(input))
+			if i == 0 {
+				oc.output = inputStem + r.outputSuffix()
+			}
+			outStem, ok := assigned[input]
+			switch {
+			case r.cfg.Collision == CollisionFail:
+				outStem = inputStem
+			case ok: // 以前の実行で決まった出力名
+			case r.cfg.Collision == CollisionExt:
+				outStem = unique(inputStem+"_"+strings.TrimPrefix(filepath.Ext(input), "."), 1)
+			case baseFree: // CollisionNumber: 1件目は変更しない (従来どおりの出力名)
+				outStem, baseFree = inputStem, false
+			default: // CollisionNumber
+				outStem = unique(inputStem, 2)
+			}
+			oc.outputs[i] = outStem + r.outputSuffix()
+			if outStem != inputStem {
+				names.renamed[input] = oc.outputs[i]
+			}
+		}
+		names.collisions = append(names.collisions, oc)
+	}
+	return names
+}
+
+// recordedOutputs: ディレクトリの入力についてジャーナルに記録された出力のうち、出力名のものを返す
+// (完了した出力を先にし、同じ出力名の記録が複数ある場合は完了した入力の記録を採用する)
+func (r *run) recordedOutputs(dir string) []journalEntry {
+	var list []journalEntry
+	for _, e := range r.journal.outputsFor(dir) {
+		if isOutputName(e.Output) {
+			list = append(list, e)
+		}
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].State == stateDone && list[b].State != stateDone })
+	return list
+}
+
+// collision: 入力のファイル名が含まれる衝突を返す
+func (n *dirOutputNames) collision(name string) (outputCollision, bool) {
+	for _, oc := range n.collisions {
+		if containsString(oc.inputs, name) {
+			return oc, true
+		}
+	}
+	return outputCollision{}, false
+}
+
+// outputPath: 入力ファイルの出力パスを求める (出力名の衝突を Config.Collision に従って解決する)
+// CollisionFail で衝突している場合はエラーを返す
+func (r *run) outputPath(inputFile, srcRoot, dstRoot string) (string, error) {
+	outputFile, err := getOutputPath(inputFile, srcRoot, dstRoot, r.outputSuffix())
+	if err != nil {
+		return "", err
+	}
+	names, _ := r.dirNames(srcRoot, filepath.Dir(inputFile))
+	if r.cfg.Collision == CollisionFail {
+		if oc, ok := names.collision(filepath.Base(inputFile)); ok {
+			return "", fmt.Errorf("出力名 '%s' が衝突しています (%s)", oc.output, oc.members())
+		}
+		return outputFile, nil
+	}
+	if renamed, ok := names.renamed[filepath.Base(inputFile)]; ok {
+		return filepath.Join(filepath.Dir(outputFile), renamed), nil
+	}
+	return outputFile, nil
+}
+
+// containsString: スライスに文字列が含まれるか
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
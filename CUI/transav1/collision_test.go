@@ -0,0 +1,199 @@
+package transav1
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRun: テスト用に、ffmpeg を使用しない Converter と実行状態を作成する (ジャーナルは dst に作成する)
+func newTestRun(t *testing.T, cfg Config, src, dst string) *run {
+	t.Helper()
+	c, err := newMaintenanceConverter(cfg)
+	if err != nil {
+		t.Fatalf("newMaintenanceConverter: %v", err)
+	}
+	r, err := c.openRun(context.Background(), src, dst, true)
+	if err != nil {
+		t.Fatalf("openRun: %v", err)
+	}
+	t.Cleanup(r.close)
+	return r
+}
+
+// writeFiles: dir にファイルを作成する (内容は名前)
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveDirNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		collision CollisionPolicy
+		inputs    []string
+		done      map[string]string // 以前の実行で完了した入力 -> 出力 (入力元にない入力も可)
+		outputs   []string          // 出力先に存在するファイル
+		want      map[string]string // 入力 -> 出力のファイル名
+		conflicts int               // 衝突として報告される件数
+	}{
+		{
+			name:      "衝突なし",
+			collision: CollisionNumber,
+			inputs:    []string{"a.mp4", "b.mkv"},
+			want:      map[string]string{"a.mp4": "a_AV1.mp4", "b.mkv": "b_AV1.mp4"},
+		},
+		{
+			name:      "number: 2件目以降に番号",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mov", "clip.MKV"},
+			want:      map[string]string{"clip.MKV": "clip_AV1.mp4", "clip.mov": "clip_2_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "number: 他の入力の名前を避ける",
+			collision: CollisionNumber,
+			inputs:    []string{"a.mov", "a.mkv", "a_2.mp4"},
+			want:      map[string]string{"a.mkv": "a_AV1.mp4", "a.mov": "a_3_AV1.mp4", "a_2.mp4": "a_2_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "ext: 全ての出力名に拡張子",
+			collision: CollisionExt,
+			inputs:    []string{"clip.mov", "clip.MKV"},
+			want:      map[string]string{"clip.MKV": "clip_MKV_AV1.mp4", "clip.mov": "clip_mov_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "fail: 出力名を変更しない",
+			collision: CollisionFail,
+			inputs:    []string{"clip.mov", "clip.MKV"},
+			conflicts: 1,
+		},
+		{
+			name:      "number: 以前の実行の出力名を維持し、後から追加された入力に番号",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mov", "clip.MKV"},
+			done:      map[string]string{"clip.mov": "clip_AV1.mp4"},
+			outputs:   []string{"clip_AV1.mp4"},
+			want:      map[string]string{"clip.mov": "clip_AV1.mp4", "clip.MKV": "clip_2_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "ext: 以前の実行の出力名を維持",
+			collision: CollisionExt,
+			inputs:    []string{"clip.mov", "clip.MKV"},
+			done:      map[string]string{"clip.mov": "clip_AV1.mp4"},
+			outputs:   []string{"clip_AV1.mp4"},
+			want:      map[string]string{"clip.mov": "clip_AV1.mp4", "clip.MKV": "clip_MKV_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "衝突が解消しても番号付きの出力名を維持",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mov"},
+			done:      map[string]string{"clip.mov": "clip_2_AV1.mp4"},
+			outputs:   []string{"clip_2_AV1.mp4"},
+			want:      map[string]string{"clip.mov": "clip_2_AV1.mp4"},
+		},
+		{
+			name:      "入力元にない入力の出力が残っていれば使用中",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mkv"},
+			done:      map[string]string{"clip.mov": "clip_AV1.mp4"},
+			outputs:   []string{"clip_AV1.mp4"},
+			want:      map[string]string{"clip.mkv": "clip_2_AV1.mp4"},
+			conflicts: 1,
+		},
+		{
+			name:      "入力元にない入力の出力が残っていなければ再使用",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mkv"},
+			done:      map[string]string{"clip.mov": "clip_AV1.mp4"},
+			want:      map[string]string{"clip.mkv": "clip_AV1.mp4"},
+		},
+		{
+			name:      "他の入力が記録した番号付きの出力名を避ける",
+			collision: CollisionNumber,
+			inputs:    []string{"clip.mov", "clip_2.mp4"},
+			done:      map[string]string{"clip.mov": "clip_2_AV1.mp4"},
+			outputs:   []string{"clip_2_AV1.mp4"},
+			want:      map[string]string{"clip.mov": "clip_2_AV1.mp4", "clip_2.mp4": "clip_2_2_AV1.mp4"},
+			conflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			writeFiles(t, src, tt.inputs...)
+			writeFiles(t, dst, tt.outputs...)
+			cfg := DefaultConfig()
+			cfg.Collision = tt.collision
+			if len(tt.done) > 0 {
+				r := newTestRun(t, cfg, src, dst)
+				for input, output := range tt.done {
+					r.journal.record(journalEntry{Source: filepath.Join(src, input), Output: filepath.Join(dst, output), State: stateDone})
+				}
+				r.close()
+			}
+
+			r := newTestRun(t, cfg, src, dst)
+			names, _ := r.dirNames(src, src)
+			if len(names.collisions) != tt.conflicts {
+				t.Errorf("衝突 %d 件, want %d 件: %v", len(names.collisions), tt.conflicts, names.collisions)
+			}
+			for _, input := range tt.inputs {
+				got, err := r.outputPath(filepath.Join(src, input), src, dst)
+				if tt.collision == CollisionFail {
+					if err == nil {
+						t.Errorf("%s: CollisionFail で衝突がエラーになりません", input)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("outputPath(%s): %v", input, err)
+				}
+				if filepath.Base(got) != tt.want[input] {
+					t.Errorf("%s -> %s, want %s", input, filepath.Base(got), tt.want[input])
+				}
+			}
+		})
+	}
+}
+
+// 出力名が入れ替わった場合も、別の入力の完了した出力を自分の出力として取り込まない
+func TestCheckExistingOutputOwnedByOtherSource(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, "clip.mov", "clip.MKV")
+	writeFiles(t, dst, "clip_AV1.mp4")
+	r := newTestRun(t, DefaultConfig(), src, dst)
+	output := filepath.Join(dst, "clip_AV1.mp4")
+	r.journal.record(journalEntry{Source: filepath.Join(src, "clip.mov"), Output: output, State: stateDone})
+
+	job := &videoJob{inputFile: filepath.Join(src, "clip.MKV"), outputFile: output}
+	skip, err := r.checkExistingOutput(job)
+	if err == nil || skip {
+		t.Fatalf("checkExistingOutput = (%v, %v), want error", skip, err)
+	}
+	if _, ok := r.journal.lookup(job.inputFile); ok {
+		t.Error("別の入力の出力を完了として記録しました")
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("別の入力の出力が削除されました: %v", err)
+	}
+
+	// 記録どおりの入力であればスキップする
+	job = &videoJob{inputFile: filepath.Join(src, "clip.mov"), outputFile: output}
+	if skip, err := r.checkExistingOutput(job); err != nil || !skip {
+		t.Errorf("checkExistingOutput = (%v, %v), want skip", skip, err)
+	}
+}
@@ -0,0 +1,141 @@
+package transav1
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// --- 出力のコンテナ (Config.Container) ---
+// 出力ファイル名は、入力の拡張子を除いた名前に OutputTag とコンテナの拡張子を付ける (例: movie.mkv -> movie_AV1.mp4)。
+// ContainerAuto では mp4 を既定とし、入力に mp4 にそのまま格納できないストリーム (PGS・ASS 字幕、DTS 音声、フォントなど) が
+// ある場合は、入力の解析 (ffprobe) 後にその動画の出力を mkv に切り替える。
+
+// Container: 出力のコンテナ (-container)
+type Container string
+
+const (
+	ContainerMP4  Container = "mp4"  // MP4 (従来の動作)
+	ContainerMKV  Container = "mkv"  // Matroska (ほぼ全ての音声・字幕と添付ファイルを格納できる)
+	ContainerWebM Container = "webm" // WebM (音声は Opus / Vorbis、字幕は WebVTT のみ)
+	ContainerAuto Container = "auto" // mp4 に格納できないストリームがある入力のみ mkv にする
+)
+
+// OutputTag: 出力ファイル名に付ける識別子 (この後にコンテナの拡張子が続く)
+const OutputTag = "_AV1"
+
+// ParseContainer: -container の指定値を解釈する (大文字小文字は区別しない)
+func ParseContainer(s string) (Container, error) {
+	switch ct := Container(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "."))); ct {
+	case ContainerMP4, ContainerMKV, ContainerWebM, ContainerAuto:
+		return ct, nil
+	}
+	return "", fmt.Errorf("不明なコンテナ: '%s' (mp4, mkv, webm, auto のいずれか)", s)
+}
+
+// OutputSuffixFor: コンテナの出力ファイル名のサフィックスを返す (ContainerAuto は既定の mp4, 例: "_AV1.mkv")
+func OutputSuffixFor(ct Container) string {
+	if ct == ContainerAuto || ct == "" {
+		ct = ContainerMP4
+	}
+	return OutputTag + "." + string(ct)
+}
+
+// containerFormat: 出力のコンテナに格納できるストリーム
+type containerFormat struct {
+	name          string
+	audio         map[string]bool // コピーで格納できる音声のコーデック
+	anyAudio      bool            // 全ての音声をコピーで格納できる
+	fallbackAudio string          // 格納できない音声の変換に使用するエンコーダ
+	subtitles     map[string]bool // コピーで格納できる字幕のコーデック
+	textSubtitle  string          // テキスト字幕の変換に使用するエンコーダ (空: 変換しない)
+	pictures      map[string]bool // カバー画像として格納できる画像のコーデック
+	attachments   bool            // 添付ファイル (字幕のフォントなど) を格納できるか
+}
+
+// containerFormats: コンテナごとに格納できるストリーム
+var containerFormats = map[Container]containerFormat{
+	ContainerMP4: {
+		name:          "mp4",
+		audio:         codecSet("aac", "mp3", "mp2", "ac3", "eac3", "alac", "flac", "opus"),
+		fallbackAudio: "aac",
+		subtitles:     codecSet("mov_text"),
+		textSubtitle:  "mov_text",
+		pictures:      codecSet("mjpeg", "png"),
+	},
+	ContainerMKV: {
+		name:          "mkv",
+		anyAudio:      true,
+		fallbackAudio: "aac",
+		subtitles:     codecSet("subrip", "ass", "ssa", "webvtt", "hdmv_pgs_subtitle", "dvd_subtitle", "dvb_subtitle"),
+		textSubtitle:  "srt",
+		pictures:      codecSet("mjpeg", "png"),
+		attachments:   true,
+	},
+	ContainerWebM: {
+		name:          "webm",
+		audio:         codecSet("opus", "vorbis"),
+		fallbackAudio: "libopus",
+		subtitles:     codecSet("webvtt"),
+		textSubtitle:  "webvtt",
+	},
+}
+
+// copiesAudio: 音声のコーデックをコピーで格納できるか
+func (ct containerFormat) copiesAudio(codec string) bool {
+	return ct.anyAudio || ct.audio[codec]
+}
+
+// codecSet: コーデック名の集合を作成する
+func codecSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// containerFor: 出力パスの拡張子からコンテナを求める (未知の拡張子は mp4 として扱う)
+func containerFor(outputPath string) containerFormat {
+	if ct, ok := containerFormats[Container(strings.ToLower(strings.TrimPrefix(filepath.Ext(outputPath), ".")))]; ok {
+		return ct
+	}
+	return containerFormats[ContainerMP4]
+}
+
+// withContainer: 出力パスの拡張子をコンテナの拡張子に置き換える
+func withContainer(outputFile string, ct Container) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "." + string(ct)
+}
+
+// outputSuffix: Config.Container の出力ファイル名のサフィックス
+func (c *Converter) outputSuffix() string {
+	return OutputSuffixFor(c.cfg.Container)
+}
+
+// existingOutput: ContainerAuto で出力 (mp4) がなく、mkv に切り替えた出力があればそのパスを返す (それ以外は outputFile のまま)
+// ジャーナルがない出力先でも、変換済みの出力を確認できるようにする
+func (r *run) existingOutput(outputFile string) string {
+	if r.cfg.Container != ContainerAuto || r.fileExists(outputFile) {
+		return outputFile
+	}
+	if alt := withContainer(outputFile, ContainerMKV); r.fileExists(alt) {
+		return alt
+	}
+	return outputFile
+}
+
+// chooseContainer: ContainerAuto の場合、入力のストリームを mp4 にそのまま格納できなければ出力を mkv に切り替える
+// (入力の解析後、出力を作成する前に呼び出す)
+func (r *run) chooseContainer(job *videoJob) {
+	if r.cfg.Container != ContainerAuto || job.sourceInfo == nil {
+		return
+	}
+	mp4 := withContainer(job.outputFile, ContainerMP4)
+	if m := r.mapStreams(job.sourceInfo, mp4, false, false, nil); len(m.incompatible) > 0 {
+		job.outputFile = withContainer(job.outputFile, ContainerMKV)
+		r.logger.Printf("情報: mp4 にそのまま格納できないストリームがあるため、出力を mkv にします (%s): %s", strings.Join(m.incompatible, ", "), filepath.Base(job.outputFile))
+		return
+	}
+	job.outputFile = mp4
+}
@@ -0,0 +1,97 @@
+package transav1
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseContainer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Container
+		wantErr bool
+	}{
+		{in: "mp4", want: ContainerMP4},
+		{in: "MKV", want: ContainerMKV},
+		{in: ".webm", want: ContainerWebM},
+		{in: " Auto ", want: ContainerAuto},
+		{in: "avi", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseContainer(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseContainer(%q) = (%q, %v), want %q (wantErr %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestChooseContainer(t *testing.T) {
+	video := probeStream{Index: 0, CodecType: "video", CodecName: "h264"}
+	tests := []struct {
+		name      string
+		container Container
+		streams   []probeStream // nil: ffprobe の結果なし
+		output    string
+		want      string
+	}{
+		{
+			name:      "mp4 に格納できる",
+			container: ContainerAuto,
+			streams:   []probeStream{video, {Index: 1, CodecType: "audio", CodecName: "aac"}},
+			output:    "movie_AV1.mp4",
+			want:      "movie_AV1.mp4",
+		},
+		{
+			name:      "DTS 音声は mkv",
+			container: ContainerAuto,
+			streams:   []probeStream{video, {Index: 1, CodecType: "audio", CodecName: "dts"}},
+			output:    "movie_AV1.mp4",
+			want:      "movie_AV1.mkv",
+		},
+		{
+			name:      "PGS 字幕は mkv",
+			container: ContainerAuto,
+			streams:   []probeStream{video, {Index: 1, CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle"}},
+			output:    "movie_AV1.mp4",
+			want:      "movie_AV1.mkv",
+		},
+		{
+			name:      "以前に mkv にした出力でも再判定する",
+			container: ContainerAuto,
+			streams:   []probeStream{video},
+			output:    "movie_AV1.mkv",
+			want:      "movie_AV1.mp4",
+		},
+		{
+			name:      "ffprobe の結果がなければ変更しない",
+			container: ContainerAuto,
+			output:    "movie_AV1.mp4",
+			want:      "movie_AV1.mp4",
+		},
+		{
+			name:      "auto 以外は変更しない",
+			container: ContainerMP4,
+			streams:   []probeStream{video, {Index: 1, CodecType: "audio", CodecName: "dts"}},
+			output:    "movie_AV1.mp4",
+			want:      "movie_AV1.mp4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Container = tt.container
+			src, dst := t.TempDir(), t.TempDir()
+			r := newTestRun(t, cfg, src, dst)
+
+			job := &videoJob{inputFile: filepath.Join(src, "movie.mkv"), outputDir: dst, outputFile: filepath.Join(dst, tt.output)}
+			if tt.streams != nil {
+				job.sourceInfo = &mediaInfo{Streams: tt.streams}
+			}
+			r.chooseContainer(job)
+			if got := filepath.Base(job.outputFile); got != tt.want {
+				t.Errorf("出力 %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
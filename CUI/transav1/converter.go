@@ -0,0 +1,729 @@
+// Package transav1 は、動画ファイルを AV1 に変換するエンジンを提供する。
+//
+// ffmpeg を低優先度で実行し、エンコーダチェーン (例: av1_nvenc → av1_qsv → libsvtav1) の先頭から順に試行して、
+// 失敗時には次のエンコーダにフォールバックする。
+// ディレクトリ単位の変換 (ConvertTree) では動画以外のファイルのコピー、ジャーナルによる再開、
+// QuickMode の回復処理も行う。コマンドライン版 (TransAV1_CUI) はこのパッケージの薄いラッパーである。
+//
+//	cfg := transav1.DefaultConfig()
+//	cfg.FFmpegPath = "/usr/bin/ffmpeg"
+//	cfg.Logger = log.Default()
+//	conv, err := transav1.New(cfg)
+//	if err != nil { ... }
+//	report, err := conv.ConvertTree(ctx, "/videos", "/videos_av1")
+package transav1
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- デフォルト値 ---
+const (
+	DefaultPriority         = "BelowNormal"
+	DefaultHWEncoder        = "av1_nvenc"
+	DefaultCPUEncoder       = "libsvtav1"
+	DefaultHWOptions        = "-cq 25 -preset p5"
+	DefaultCPUOptions       = "-crf 28 -preset 7"
+	DefaultTimeout          = 7200 * time.Second
+	DefaultHWJobs           = 1 // HWレーンの同時エンコード数 (NVENC などのエンジン数に合わせる)
+	DefaultCPUJobs          = 1 // CPUレーンの同時エンコード数
+	DefaultProgressInterval = 30 * time.Second
+	DefaultAV1Source        = AV1Remux       // 入力が既に AV1 の場合の扱い
+	DefaultMinSaving        = 0.0            // 出力に求める最小のサイズ削減率 (0: 入力より大きくなければよい)
+	DefaultLarger           = LargerOriginal // 出力が十分に小さくならなかった場合の扱い
+	DefaultRetryOptions     = "-crf 38 -preset 6"
+	DefaultVerify           = VerifyProbe     // エンコード後の出力検証の方法
+	DefaultVerifyTolerance  = 2 * time.Second // 出力検証で許容する再生時間の差
+	DefaultImageEncoder     = "libaom-av1"    // 静止画の変換 (convert-image) に使用するエンコーダ
+	DefaultImageOptions     = "-crf 30 -still-picture 1"
+	DefaultCollision        = CollisionNumber // 出力名が衝突した場合の扱い
+	DefaultSidecars         = SidecarRename   // サイドカーファイルの扱い
+	DefaultStreams          = StreamsAll      // 出力に含めるストリームの選び方
+	DefaultContainer        = ContainerMP4    // 出力のコンテナ
+	DefaultAudioCodec       = CodecAuto       // 音声の扱い
+	DefaultSubtitleCodec    = CodecAuto       // 字幕の扱い
+)
+
+// tempDirPrefix: 一時ディレクトリ名の接頭辞
+const tempDirPrefix = "go_transav1_"
+
+// originSuffix: QuickMode 回復用マーカーのサフィックス
+const originSuffix = ".origin"
+
+// processingSuffix: QuickMode でエンコード中の入力ファイルに付与するサフィックス
+const processingSuffix = ".processing"
+
+// Config: 変換エンジンの設定
+type Config struct {
+	FFmpegPath  string // ffmpeg のパス (必須)
+	FFprobePath string // ffprobe のパス (空の場合、入力・出力の検証や AV1 ソースの判定は行わない)
+	Priority    string // ffmpeg プロセスの優先度 (idle, BelowNormal, Normal, AboveNormal)
+
+	// Encoders: 順に試行するエンコーダチェーン (失敗すると次の段にフォールバックする)
+	// ハードウェアエンコーダの段は HW レーン、それ以外の段は CPU レーンで実行される
+	Encoders []Encoder
+
+	Timeout time.Duration // ffmpeg 各処理のタイムアウト (0 で無効, Encoder.Timeout で段ごとに上書き可能)
+	HWJobs  int           // HWレーンの同時エンコード数
+	CPUJobs int           // CPUレーンの同時エンコード数
+
+	QuickMode       bool // 一時コピーを行わず入力元ファイルを直接エンコードする
+	Restart         bool // ConvertTree の開始前に失敗マーカーと 0 バイトの出力を削除する
+	UseTempFileList bool // 動画ファイルのリストをメモリではなく一時ファイルに保持する
+
+	// ConvertTree で処理するファイルの絞り込み (入力元ルートからの相対パスと比較するグロブ, filter.go)
+	Include           []string // 空でなければ、いずれかに一致するファイルのみを処理する
+	Exclude           []string // いずれかに一致するファイル・ディレクトリを処理しない
+	NoDefaultExcludes bool     // DefaultExcludes (OS が作成するファイルなど) を除外しない
+
+	// 入力元のファイルの分類 (classify.go)
+	Extensions   map[string]FileClass // 拡張子ごとの扱い (既定の分類を上書きする, 例: ".vob": ClassEncode, ".ts": ClassCopy)
+	Sniff        bool                 // 拡張子が未知のファイルを ffprobe で調べ、動画であればエンコードする
+	ImageEncoder string               // 静止画の変換 (ClassImage) に使用するエンコーダ
+	ImageOptions string               // 静止画の変換に使用するエンコーダオプション
+
+	Collision CollisionPolicy // 同じディレクトリの入力が同じ出力名になる場合の扱い (collision.go)
+	Sidecars  SidecarPolicy   // 動画の字幕・メタデータ・ポスターなどのサイドカーファイルの扱い (sidecar.go)
+	Container Container       // 出力のコンテナ (出力ファイル名の拡張子, container.go)
+
+	// 出力に含めるストリーム (streams.go)
+	Streams       StreamPolicy // 入力のストリームの選び方
+	Languages     []string     // Streams が StreamsLanguage の場合に残す音声・字幕の言語 (例: "jpn", "eng")
+	AudioCodec    string       // 音声の扱い (CodecAuto, CodecCopy, またはエンコーダ名)
+	SubtitleCodec string       // 字幕の扱い (CodecAuto, CodecCopy, CodecNone, またはエンコーダ名)
+	NoMetadata    bool         // 入力のメタデータ (タイトルなど) とチャプターを出力に引き継がない
+
+	AV1Source       AV1Policy     // 入力の映像が既に AV1 の場合の扱い
+	MinSaving       float64       // 出力に求める、入力に対するサイズの最小削減率 (1 未満)
+	Larger          LargerPolicy  // 削減率が MinSaving 未満だった場合の扱い
+	RetryOptions    string        // Larger が LargerRetry の場合に CPU エンコーダで使用するオプション
+	Verify          VerifyMode    // エンコード後の出力検証の方法
+	VerifyTolerance time.Duration // 出力検証で許容する、入力と出力の再生時間の差
+
+	ProgressInterval time.Duration // 進捗ログの出力間隔 (0 で無効)
+	TempDir          string        // 一時ディレクトリを作成する場所 (空の場合は OS の既定)
+
+	Logger      *log.Logger // 通常ログの出力先 (nil の場合は出力しない)
+	DebugLogger *log.Logger // デバッグログの出力先 (nil の場合はデバッグログ無効)
+
+	// OnEvent: 処理の進行に応じて呼び出されるコールバック (nil 可)
+	// 複数のエンコードワーカーから呼び出されるが、呼び出しは直列化される
+	OnEvent func(Event)
+}
+
+// DefaultConfig: デフォルト値を設定した Config を返す (FFmpegPath は呼び出し側で設定すること)
+func DefaultConfig() Config {
+	return Config{
+		Priority:         DefaultPriority,
+		Encoders:         DefaultEncoders(),
+		Timeout:          DefaultTimeout,
+		HWJobs:           DefaultHWJobs,
+		CPUJobs:          DefaultCPUJobs,
+		AV1Source:        DefaultAV1Source,
+		MinSaving:        DefaultMinSaving,
+		Larger:           DefaultLarger,
+		RetryOptions:     DefaultRetryOptions,
+		Verify:           DefaultVerify,
+		VerifyTolerance:  DefaultVerifyTolerance,
+		ProgressInterval: DefaultProgressInterval,
+		ImageEncoder:     DefaultImageEncoder,
+		ImageOptions:     DefaultImageOptions,
+		Collision:        DefaultCollision,
+		Sidecars:         DefaultSidecars,
+		Container:        DefaultContainer,
+		Streams:          DefaultStreams,
+		AudioCodec:       DefaultAudioCodec,
+		SubtitleCodec:    DefaultSubtitleCodec,
+	}
+}
+
+// Converter: 設定を検証済みの変換エンジン
+// ConvertFile / ConvertTree の呼び出しごとに独立した実行状態を持つ
+type Converter struct {
+	cfg         Config
+	filter      *pathFilter // 入力元の走査対象の絞り込み
+	classes     *classifier // 入力元のファイルの分類
+	logger      *log.Logger
+	debugLogger *log.Logger
+}
+
+// New: 設定を検証して Converter を作成する
+func New(cfg Config) (*Converter, error) {
+	if cfg.FFmpegPath == "" {
+		return nil, errors.New("ffmpeg のパスが指定されていません")
+	}
+	// オプションの検証には、使用する ffmpeg の値を取らないオプションの一覧を使う (取得できない場合は組み込みの一覧)
+	flags, flagsErr := listFlagOptions(context.Background(), cfg.FFmpegPath)
+	if flagsErr != nil {
+		flags = flagOptions
+	}
+	hasHW, hasCPU, err := validateEncoders(cfg.Encoders, flags)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Encoders = append([]Encoder(nil), cfg.Encoders...) // 呼び出し側のスライスの変更の影響を受けないようにする
+	if hasHW && cfg.HWJobs < 1 {
+		return nil, fmt.Errorf("HWレーンの同時エンコード数には 1 以上を指定してください (指定値: %d)", cfg.HWJobs)
+	}
+	if hasCPU && cfg.CPUJobs < 1 {
+		return nil, fmt.Errorf("CPUレーンの同時エンコード数には 1 以上を指定してください (指定値: %d)", cfg.CPUJobs)
+	}
+	if cfg.AV1Source, err = ParseAV1Policy(string(cfg.AV1Source)); err != nil {
+		return nil, err
+	}
+	retryArgs, err := SplitOptions(cfg.RetryOptions)
+	if err == nil {
+		err = validateOptions(retryArgs, flags)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("再エンコード用オプション: %w", err)
+	}
+	if cfg.MinSaving >= 1 {
+		return nil, fmt.Errorf("最小削減率には 1 未満を指定してください (指定値: %g)", cfg.MinSaving)
+	}
+	if cfg.Larger, err = ParseLargerPolicy(string(cfg.Larger)); err != nil {
+		return nil, err
+	}
+	if cfg.Verify, err = ParseVerifyMode(string(cfg.Verify)); err != nil {
+		return nil, err
+	}
+	if cfg.Collision, err = ParseCollisionPolicy(string(cfg.Collision)); err != nil {
+		return nil, err
+	}
+	if cfg.Sidecars, err = ParseSidecarPolicy(string(cfg.Sidecars)); err != nil {
+		return nil, err
+	}
+	if cfg.Container, err = ParseContainer(string(cfg.Container)); err != nil {
+		return nil, err
+	}
+	if cfg.Streams, err = ParseStreamPolicy(string(cfg.Streams)); err != nil {
+		return nil, err
+	}
+	cfg.Languages = normalizeLanguages(cfg.Languages)
+	if cfg.Streams == StreamsLanguage && len(cfg.Languages) == 0 {
+		return nil, errors.New("ストリームを言語で選ぶ (lang) 場合は、残す言語を指定してください")
+	}
+	if cfg.AudioCodec, err = parseCodecChoice(cfg.AudioCodec, "音声", false); err != nil {
+		return nil, err
+	}
+	if cfg.SubtitleCodec, err = parseCodecChoice(cfg.SubtitleCodec, "字幕", true); err != nil {
+		return nil, err
+	}
+	if cfg.VerifyTolerance < 0 {
+		return nil, fmt.Errorf("再生時間の許容差には 0 以上を指定してください (指定値: %v)", cfg.VerifyTolerance)
+	}
+	filter, err := newPathFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := newClassifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	imageArgs, err := SplitOptions(cfg.ImageOptions)
+	if err == nil {
+		err = validateOptions(imageArgs, flags)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("画像変換用オプション: %w", err)
+	}
+	if cfg.ImageEncoder == "" {
+		cfg.ImageEncoder = DefaultImageEncoder
+	}
+
+	c := &Converter{cfg: cfg, filter: filter, classes: classes, logger: cfg.Logger, debugLogger: cfg.DebugLogger}
+	if c.logger == nil {
+		c.logger = log.New(io.Discard, "", 0)
+	}
+	if flagsErr != nil {
+		c.debugf("値を取らない ffmpeg オプションの一覧を取得できないため、組み込みの一覧でオプションを検証しました: %v", flagsErr)
+	}
+	if len(cfg.Languages) > 0 && cfg.Streams != StreamsLanguage {
+		c.logger.Printf("警告: ストリームの選び方が %s のため、言語の指定 (%s) は使用されません。", cfg.Streams, strings.Join(cfg.Languages, ","))
+	}
+	if cfg.FFprobePath == "" {
+		if cfg.Streams != StreamsFirst {
+			c.logger.Printf("警告: ffprobe がないため、出力に含めるストリームは最初の映像と全ての音声のみになります (%s)。", cfg.Streams)
+		}
+		if cfg.Sniff {
+			c.logger.Println("警告: ffprobe がないため、拡張子が未知のファイルの内容による判定 (-sniff) は行われません。")
+		}
+		if cfg.AV1Source != AV1Encode {
+			c.logger.Printf("警告: ffprobe がないため、AV1 ソースの判定 (%s) は行われません。", cfg.AV1Source)
+		}
+		if cfg.Verify != VerifyNone {
+			c.logger.Printf("警告: ffprobe がないため、エンコード後の出力検証 (%s) は行われません。", cfg.Verify)
+		}
+	}
+	return c, nil
+}
+
+// Config: Converter の設定 (New で正規化済み) を返す
+func (c *Converter) Config() Config {
+	return c.cfg
+}
+
+// debugEnabled: デバッグログが有効かどうか
+func (c *Converter) debugEnabled() bool {
+	return c.debugLogger != nil && c.debugLogger.Writer() != io.Discard
+}
+
+// debugf: デバッグログを出力する (デバッグログ無効時は何もしない)
+func (c *Converter) debugf(format string, v ...interface{}) {
+	if c.debugEnabled() {
+		// Output(2, ...) で呼び出し元の情報を正しく表示させる
+		c.debugLogger.Output(2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Report: ConvertFile / ConvertTree の実行結果
+type Report struct {
+	Succeeded int // 変換 (再多重化・コピーを含む) に成功した動画の数
+	Skipped   int // 出力が既に存在したなどの理由でスキップした動画の数
+	Failed    int // 失敗した動画の数
+	// InterruptedFiles: 中断により処理を取りやめた動画の数 (Failed には含めない。次回の実行で処理される)
+	InterruptedFiles int
+	// Errors: 動画の失敗とその他のファイルのコピー失敗などのエラーメッセージ
+	Errors []string
+	// Summary: 成功・失敗以外の特記事項 (キーは run_finished イベントの summary と同じ, 値は入力ファイル)
+	Summary     map[string][]string
+	Interrupted bool          // ctx の取り消しにより中断したか
+	Elapsed     time.Duration // 処理時間
+}
+
+// ExitCode: 実行結果に対応する終了コードを返す (0: 成功, 1: エラーあり, ExitInterrupted: 中断)
+func (rep *Report) ExitCode() int {
+	switch {
+	case rep.Interrupted:
+		return ExitInterrupted
+	case len(rep.Errors) > 0:
+		return 1
+	}
+	return 0
+}
+
+// run: ConvertFile / ConvertTree の1回分の実行状態
+type run struct {
+	*Converter
+	ctx       context.Context // 実行全体のコンテキスト (取り消されると実行中の ffmpeg を停止する)
+	startTime time.Time
+	tempDir   string // 一時ディレクトリ (ジョブごとのサブディレクトリを作成)
+	journal   *runJournal
+	progress  *progressTracker
+	events    *eventEmitter
+	summary   *runSummary
+	errors    errorList   // 処理中のエラー (エンコードワーカーと共有)
+	sniff     bool        // 拡張子が未知のファイルの内容を ffprobe で調べるか (Config.Sniff, classify.go)
+	nestedDst string      // 入力元の中にある出力先 (入力元の走査パスの形式, 走査で除外する, 空の場合はなし)
+	names     outputNames // 出力名の衝突の解決結果 (collision.go)
+}
+
+// newRun: ジャーナルを開き、一時ディレクトリを作成して実行状態を準備する
+// srcRoot: ジャーナルの相対パスの基準となる入力元ルート
+// dstRoot: 出力先ルート (ジャーナルの作成場所)
+func (c *Converter) newRun(ctx context.Context, srcRoot, dstRoot string) (*run, error) {
+	r, err := c.openRun(ctx, srcRoot, dstRoot, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// --- 一時ディレクトリ作成 ---
+	tempDir, err := os.MkdirTemp(c.cfg.TempDir, tempDirPrefix)
+	if err != nil {
+		r.journal.close()
+		return nil, fmt.Errorf("一時ディレクトリの作成に失敗: %w", err)
+	}
+	r.tempDir = tempDir
+	c.logger.Printf("一時ディレクトリ: %s", tempDir)
+	return r, nil
+}
+
+// openRun: ジャーナルを開いて実行状態を作成する (一時ディレクトリは作成しない, 保守処理は直接これを使う)
+// createJournal: ジャーナルがない場合に作成するか
+func (c *Converter) openRun(ctx context.Context, srcRoot, dstRoot string, createJournal bool) (*run, error) {
+	r := &run{
+		Converter: c,
+		ctx:       ctx,
+		startTime: time.Now(),
+		progress:  newProgressTracker(c.cfg.ProgressInterval, c.logger),
+		summary:   newRunSummary(),
+		sniff:     c.cfg.Sniff && c.cfg.FFprobePath != "",
+	}
+	r.events = newEventEmitter(c.cfg.OnEvent, r.progress)
+
+	// --- 出力先が入力元の中にある場合: 出力・ログ・マーカーを再び入力として扱わないよう、走査から除外する ---
+	if resolvedSrc, resolvedDst := ResolvePath(srcRoot), ResolvePath(dstRoot); IsSubPath(resolvedSrc, resolvedDst) {
+		rel, _ := filepath.Rel(resolvedSrc, resolvedDst)
+		r.nestedDst = filepath.Join(srcRoot, rel)
+		c.logger.Printf("警告: 出力先が入力元の中にあります。入力元の走査では出力先 '%s' を除外します。", r.nestedDst)
+	}
+
+	// --- ジャーナルを開く (出力先ルートの GoTransAV1_Journal.jsonl) ---
+	journal, err := openJournal(srcRoot, dstRoot, c.logger, createJournal)
+	if err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// isNestedDst: 入力元の走査で見つかったディレクトリが、入力元の中にある出力先か判定する
+func (r *run) isNestedDst(path string, d fs.DirEntry) bool {
+	return r.nestedDst != "" && d.IsDir() && path == r.nestedDst
+}
+
+// close: 一時ディレクトリを削除し、ジャーナルを閉じる
+func (r *run) close() {
+	if r.tempDir != "" {
+		r.debugf("一時ディレクトリ削除: %s", r.tempDir)
+		if err := os.RemoveAll(r.tempDir); err != nil {
+			r.logger.Printf("警告: 一時ディレクトリ '%s' の削除に失敗: %v", r.tempDir, err)
+		}
+	}
+	r.journal.close()
+}
+
+// timeoutContext: ffmpeg 1回分の実行コンテキストを作成する (timeout が 0 以下の場合は中断のみ)
+func (r *run) timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(r.ctx, timeout)
+	}
+	return context.WithCancel(r.ctx)
+}
+
+// finish: 実行サマリーをログに出力し、run_finished イベントを送出して実行結果を返す
+func (r *run) finish() *Report {
+	elapsed := time.Since(r.startTime)
+	r.logger.Printf("総処理時間: %v", elapsed.Round(time.Second))
+	r.summary.print(r.logger)
+
+	succeeded, skipped, failed, interrupted := r.events.counts()
+	rep := &Report{
+		Succeeded: succeeded, Skipped: skipped, Failed: failed, InterruptedFiles: interrupted,
+		Errors:      r.errors.list(),
+		Summary:     r.summary.snapshot(),
+		Interrupted: r.interrupted(),
+		Elapsed:     elapsed,
+	}
+	if rep.Interrupted {
+		r.logger.Println("--- 処理は中断されました (未処理の動画は次回の実行で処理されます) ---")
+	}
+	r.events.runFinished(elapsed, len(rep.Errors), rep.ExitCode(), r.summary.counts())
+	return rep
+}
+
+// ConvertFile: 1つの動画ファイルを変換し、outputDir に出力する
+// outputDir は事前に存在している必要がある。ジャーナルは outputDir に作成される。
+func (c *Converter) ConvertFile(ctx context.Context, inputFile, outputDir string) (*Report, error) {
+	inputFilename := filepath.Base(inputFile)
+	if isOutputName(inputFilename) {
+		return nil, fmt.Errorf("入力ファイル '%s' は変換済みの出力 (「%s」など) です", inputFile, c.outputSuffix())
+	}
+	if class, _ := c.classes.classOf(inputFilename); class != ClassEncode && !c.cfg.Sniff {
+		return nil, fmt.Errorf("入力ファイル '%s' はエンコード対象の拡張子ではありません", inputFile)
+	}
+	srcDir := filepath.Dir(inputFile)
+	r, err := c.newRun(ctx, srcDir, outputDir)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+	// 出力名は ConvertTree と同じく、ジャーナルに記録された以前の実行の出力名と同じフォルダの入力から決める
+	outputFile, err := r.outputPath(inputFile, srcDir, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("動画出力パス計算失敗 (%s): %w", inputFile, err)
+	}
+	r.events.runStarted(c.cfg, inputFile, outputDir, true)
+
+	c.logger.Println("--- 単一ファイル処理モード開始 ---")
+	c.logger.Printf("処理対象: %s -> %s", inputFile, outputFile)
+
+	// 単一ファイルでも HW→CPU の再キューはワーカープール経由で行う
+	r.progress.setTotal(1)
+	pool := r.newEncodePool()
+	sidecars := r.muxSidecars(inputFile, srcDir)
+	pool.submit(&videoJob{index: 1, total: 1, inputFile: inputFile, outputFile: outputFile, outputDir: filepath.Dir(outputFile), sidecars: sidecars, sidecarFiles: sidecars})
+	pool.wait()
+	c.logger.Println("--- 単一ファイル処理モード終了 ---")
+
+	return r.finish(), nil
+}
+
+// ConvertTree: srcDir 以下の動画を変換して dstDir の対応するサブディレクトリに出力し、
+// その他のファイルはそのままコピーする (動画のエンコードより前に行う)
+// dstDir が存在しない場合は作成する。ctx が取り消された場合は実行中の ffmpeg を停止し、
+// 作業状態を元に戻してから Report.Interrupted を true にして返る。
+func (c *Converter) ConvertTree(ctx context.Context, srcDir, dstDir string) (*Report, error) {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, fmt.Errorf("出力ディレクトリ '%s' の作成に失敗: %w", dstDir, err)
+	}
+	r, err := c.newRun(ctx, srcDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	// --- QuickMode 回復処理 ---
+	r.recoverQuickModeFiles(srcDir, dstDir)
+
+	// --- Restart 処理 ---
+	if c.cfg.Restart {
+		if _, err := r.removeRestartFiles(dstDir); err != nil {
+			return nil, fmt.Errorf("-restart 処理中にエラーが発生: %w", err)
+		}
+	}
+
+	r.events.runStarted(c.cfg, srcDir, dstDir, false)
+	c.logger.Println("--- ディレクトリ処理モード開始 ---")
+
+	// --- ファイルリスト作成 ---
+	c.logger.Println("--- ファイルリスト作成開始 ---")
+	var videoFiles []string
+	var otherFiles []string // 動画以外のファイルを格納
+	fileCount := 0
+	excludedCount := 0  // パターン・拡張子の設定 (ignore) により除外したファイル・ディレクトリ
+	collisionCount := 0 // 出力名が衝突した入力の組
+	walkErr := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.logger.Printf("警告: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if r.interrupted() {
+			return filepath.SkipAll // 中断要求を受けたらリスト作成を打ち切る
+		}
+		if r.isNestedDst(path, d) {
+			return filepath.SkipDir
+		}
+		if c.filter.excluded(srcDir, path, d.IsDir()) {
+			// 除外したディレクトリは配下ごと走査しない (動画・その他のファイル・一時ファイルリストのいずれにも含めない)
+			r.debugf("除外: %s", path)
+			excludedCount++
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			// ディレクトリ自体はリストに追加しない (QuickMode 回復処理は WalkDir の前に行った)
+			return nil
+		}
+		fileCount++
+		if fileCount%1000 == 0 && fileCount > 0 {
+			c.logger.Printf("ファイルリスト作成中... %d 件スキャン済み", fileCount)
+		}
+		switch r.classify(path) {
+		case ClassEncode:
+			videoFiles = append(videoFiles, path)
+			if names, fresh := r.dirNames(srcDir, filepath.Dir(path)); fresh {
+				for _, oc := range names.collisions {
+					collisionCount++
+					if c.cfg.Collision == CollisionFail {
+						c.logger.Printf("エラー: 出力名 '%s' が衝突しています: %s (%s)", oc.output, oc.members(), oc.dir)
+						continue
+					}
+					c.logger.Printf("警告: 出力名 '%s' が衝突するため、出力名を変更します (-collision %s): %s (%s)", oc.output, c.cfg.Collision, oc, oc.dir)
+					for i, input := range oc.inputs {
+						if oc.outputs[i] != oc.output {
+							r.summary.add(summaryRenamed, filepath.Join(oc.dir, input)+" -> "+oc.outputs[i])
+						}
+					}
+				}
+			}
+		case ClassIgnore:
+			r.debugf("除外 (拡張子の設定: %s): %s", ClassIgnore, path)
+			excludedCount++
+		default: // コピー・画像の変換
+			otherFiles = append(otherFiles, path)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("ファイルリスト作成中に予期せぬエラーが発生: %w", walkErr)
+	}
+	c.logger.Printf("ファイルリスト作成完了。 動画: %d件, その他: %d件 (総ファイル: %d件)", len(videoFiles), len(otherFiles), fileCount)
+	if collisionCount > 0 && c.cfg.Collision == CollisionFail {
+		return nil, fmt.Errorf("出力名の衝突が %d 件あるため、変換を開始しません (-collision number または ext で出力名を変更できます)", collisionCount)
+	}
+	if excludedCount > 0 {
+		c.logger.Printf("情報: 除外パターン・拡張子の設定により %d 件のファイル・ディレクトリを処理対象から除外しました。", excludedCount)
+	}
+
+	// --- 一時ファイルリスト書き出し (UseTempFileList 指定時) ---
+	tempFileListPath := ""
+	if c.cfg.UseTempFileList && len(videoFiles) > 0 {
+		tempFileListPath = r.writeTempFileList(videoFiles)
+		if tempFileListPath != "" {
+			videoFiles = nil // メモリ上のリストは不要に
+		}
+	} else if c.cfg.UseTempFileList {
+		c.logger.Println("-usetemp 指定ですが、処理対象の動画ファイルがないため一時リストは作成しません。")
+	} else {
+		c.logger.Printf("メモリ上のリストを使用します (-usetemp 未指定または動画なし)。")
+	}
+
+	// --- その他のファイルコピー処理 ---
+	c.logger.Println("--- その他のファイルコピー処理開始 ---")
+	var otherCopyErrors []string
+	otherCount := len(otherFiles)
+	if otherCount > 0 {
+		c.logger.Printf("%d 件のその他のファイルをコピーします...", otherCount)
+		for i, otherFile := range otherFiles {
+			if r.interrupted() {
+				c.logger.Printf("中断: 残り %d 件のその他のファイルのコピーを取りやめます。", otherCount-i)
+				break
+			}
+			relPath, err := filepath.Rel(srcDir, otherFile)
+			if err != nil {
+				errMsg := fmt.Sprintf("その他ファイル相対パス計算失敗 (%s): %v", otherFile, err)
+				c.logger.Printf("エラー (%d/%d): %s", i+1, otherCount, errMsg)
+				otherCopyErrors = append(otherCopyErrors, errMsg)
+				continue
+			}
+			otherOutputPath := filepath.Join(dstDir, relPath)
+			if c.cfg.Sidecars != SidecarCopy {
+				if _, _, ok := r.sidecarOutput(otherFile, srcDir, dstDir); ok {
+					// 動画の処理後に、動画を配置した名前に合わせてコピーする (copySidecars)
+					r.debugf("サイドカー (動画の処理後にコピー): %s", otherFile)
+					continue
+				}
+			}
+			if class, _ := c.classes.classOf(otherFile); class == ClassImage {
+				imagePath := imageOutputPath(otherOutputPath)
+				c.logger.Printf("画像変換中 (%d/%d): %s -> %s", i+1, otherCount, filepath.Base(otherFile), imagePath)
+				err := r.convertImage(otherFile, imagePath)
+				if err == nil || r.interrupted() {
+					continue
+				}
+				// 変換できない画像は失わないよう、元のファイルをそのままコピーする
+				c.logger.Printf("警告 (%d/%d): %v。元のファイルをそのままコピーします。", i+1, otherCount, err)
+				r.summary.add(summaryImageCopied, otherFile)
+			}
+			// コピー前にログ出力
+			c.logger.Printf("コピー中 (%d/%d): %s -> %s", i+1, otherCount, filepath.Base(otherFile), otherOutputPath)
+			if err := r.copyOtherFile(otherFile, otherOutputPath); err != nil {
+				// copyOtherFile 内でスキップログは出さないので、エラーのみ記録
+				errMsg := fmt.Sprintf("その他ファイルコピー失敗(%s): %v", filepath.Base(otherFile), err)
+				c.logger.Printf("エラー (%d/%d): %s", i+1, otherCount, errMsg)
+				otherCopyErrors = append(otherCopyErrors, errMsg)
+			}
+		}
+	} else {
+		c.logger.Println("コピー対象のその他のファイルはありません。")
+	}
+	c.logger.Println("--- その他のファイルコピー処理終了 ---")
+	r.errors.add(otherCopyErrors...)
+
+	// --- 動画エンコード処理 ---
+	c.logger.Println("--- 動画エンコード処理開始 ---")
+	var videoProcessingErrors []string
+	// submitVideo: 出力パスを計算してジョブをワーカープールに投入する (total 0 は総数不明)
+	var pool *encodePool
+	submitVideo := func(index, total int, vidFile string) {
+		if r.interrupted() {
+			return // 中断要求後は新しいジョブを投入しない
+		}
+		outputPath, pathErr := r.outputPath(vidFile, srcDir, dstDir)
+		if pathErr != nil {
+			errMsg := fmt.Sprintf("動画出力パス計算失敗 (%s): %v", vidFile, pathErr)
+			c.logger.Printf("エラー: %s", errMsg)
+			videoProcessingErrors = append(videoProcessingErrors, errMsg)
+			r.events.pathFailed(vidFile, index, total, pathErr)
+			return
+		}
+		pool.submit(&videoJob{
+			index: index, total: total, inputFile: vidFile, outputFile: outputPath, outputDir: filepath.Dir(outputPath),
+			sidecars: r.muxSidecars(vidFile, srcDir), sidecarFiles: r.videoSidecars(vidFile, srcDir),
+		})
+	}
+	if tempFileListPath != "" {
+		c.logger.Printf("一時リスト %s から動画パスを読み込んで処理します。", tempFileListPath)
+		file, err := os.Open(tempFileListPath)
+		if err != nil {
+			return nil, fmt.Errorf("一時リスト '%s' の読み込みに失敗: %w", tempFileListPath, err)
+		}
+		defer file.Close()
+		pool = r.newEncodePool()
+		scanner := bufio.NewScanner(file)
+		videoIndex := 0
+		// Note: 一時リスト使用時は総数が不明なため、(index/不明) と表示
+		for scanner.Scan() {
+			filePath := strings.TrimSpace(scanner.Text())
+			if filePath == "" {
+				continue
+			}
+			videoIndex++
+			submitVideo(videoIndex, 0, filePath)
+		}
+		if err := scanner.Err(); err != nil {
+			c.logger.Printf("エラー: 一時リストのスキャン中にエラーが発生: %v", err)
+			videoProcessingErrors = append(videoProcessingErrors, fmt.Sprintf("一時リストスキャンエラー: %v", err))
+		}
+		pool.wait()
+	} else { // メモリ上のリストを使用
+		videoCount := len(videoFiles)
+		if videoCount > 0 {
+			c.logger.Printf("メモリ上のリストから %d 件の動画を処理します。", videoCount)
+			r.progress.setTotal(videoCount)
+			pool = r.newEncodePool()
+			for i, vidFile := range videoFiles {
+				submitVideo(i+1, videoCount, vidFile)
+			}
+			pool.wait()
+		} else {
+			c.logger.Println("エンコード対象の動画ファイルはありません。")
+		}
+	}
+	c.logger.Println("--- 動画エンコード処理終了 ---")
+	r.errors.add(videoProcessingErrors...)
+
+	c.logger.Println("--- ディレクトリ処理モード終了 ---")
+	return r.finish(), nil
+}
+
+// writeTempFileList: 動画ファイルのリストを一時ディレクトリ内のファイルに書き出す
+// 失敗した場合は警告を出力して空文字を返す (呼び出し側はメモリ上のリストを使用する)
+func (r *run) writeTempFileList(videoFiles []string) string {
+	tempFileName := fmt.Sprintf("GoTransAV1_FileList_%s.txt", r.startTime.Format("20060102_150405"))
+	tempFileListPath := filepath.Join(r.tempDir, tempFileName)
+	r.logger.Printf("-usetemp 指定のため、動画ファイルリストを一時ファイルに書き出します: %s", tempFileListPath)
+	file, err := os.Create(tempFileListPath)
+	if err != nil {
+		r.logger.Printf("警告: 一時リスト作成失敗(%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
+		return ""
+	}
+	writer := bufio.NewWriter(file)
+	for _, vf := range videoFiles {
+		if _, err := writer.WriteString(vf + "\n"); err != nil {
+			file.Close()
+			r.logger.Printf("警告: 一時リスト書き込み失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
+			_ = os.Remove(tempFileListPath)
+			return ""
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		r.logger.Printf("警告: 一時リストフラッシュ失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
+		_ = os.Remove(tempFileListPath)
+		return ""
+	}
+	if err := file.Close(); err != nil {
+		r.logger.Printf("警告: 一時リストクローズ失敗 (%s): %v。メモリ上のリストを使用します。", tempFileListPath, err)
+		_ = os.Remove(tempFileListPath)
+		return ""
+	}
+	r.logger.Printf("一時リスト書き込み完了。")
+	return tempFileListPath
+}
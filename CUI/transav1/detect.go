@@ -0,0 +1,134 @@
+package transav1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// encoderTestTimeout: エンコーダの動作確認 (テストエンコード) 1回あたりのタイムアウト
+const encoderTestTimeout = 30 * time.Second
+
+// KnownAV1Encoders: 自動検出の対象となる AV1 エンコーダとその標準オプションを返す (チェーンを構成する優先順)
+func KnownAV1Encoders() []Encoder {
+	return []Encoder{
+		{Name: "av1_nvenc", Options: DefaultHWOptions},
+		{Name: "av1_qsv", Options: "-global_quality 25 -preset medium"},
+		{Name: "av1_amf", Options: "-quality balanced"},
+		{Name: "av1_vaapi", Options: "-vaapi_device /dev/dri/renderD128 -vf format=nv12,hwupload"},
+		{Name: "libsvtav1", Options: DefaultCPUOptions},
+		{Name: "libaom-av1", Options: "-crf 30 -b:v 0 -cpu-used 6 -row-mt 1"},
+		{Name: "librav1e", Options: "-qp 80 -speed 6"},
+	}
+}
+
+// EncoderStatus: エンコーダの検出結果
+type EncoderStatus struct {
+	Encoder Encoder
+	Usable  bool   // テストエンコードまで成功したか
+	Reason  string // 使用できない理由 (Usable が false の場合)
+}
+
+// ListFFmpegEncoders: ffmpeg -encoders の出力から、ビルドに含まれるエンコーダ名の集合を返す
+func ListFFmpegEncoders(ctx context.Context, ffmpegPath string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, encoderTestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-encoders")
+	setOSSpecificAttrs(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg -encoders の実行に失敗: %w", err)
+	}
+
+	// 出力形式: ヘッダ (凡例) の後、"------" 行に続いて " V....D av1_nvenc   NVIDIA NVENC av1 encoder" の形式で並ぶ
+	encoders := make(map[string]bool)
+	inList := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if !inList {
+			inList = len(fields) == 1 && strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 && len(fields[0]) == 6 {
+			encoders[fields[1]] = true
+		}
+	}
+	if len(encoders) == 0 {
+		return nil, fmt.Errorf("ffmpeg -encoders の出力からエンコーダ一覧を取得できません")
+	}
+	return encoders, nil
+}
+
+// TestEncoder: 合成映像 (lavfi) を数フレームだけエンコードし、エンコーダとオプションが実際に使用できるか確認する
+// (ビルドに含まれていても、GPU やドライバがない場合はここで失敗する)
+func TestEncoder(ctx context.Context, ffmpegPath string, enc Encoder) error {
+	ctx, cancel := context.WithTimeout(ctx, encoderTestTimeout)
+	defer cancel()
+
+	encArgs, err := enc.Arguments()
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"-hide_banner",
+		"-v", "error",
+		"-f", "lavfi", "-i", "testsrc2=size=320x240:rate=25:duration=1",
+		"-frames:v", "5",
+		"-an",
+		"-c:v", enc.Name,
+	}
+	args = append(args, encArgs...)
+	args = append(args, "-f", "null", "-")
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	setOSSpecificAttrs(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("テストエンコードがタイムアウトしました (%v)", encoderTestTimeout)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// ffmpeg のエラー出力は複数行になることが多いため、最後の行 (最終的な失敗理由) を返す
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" {
+			return fmt.Errorf("テストエンコード失敗: %s", msg)
+		}
+		return fmt.Errorf("テストエンコード失敗: %w", err)
+	}
+	return nil
+}
+
+// DetectEncoders: 候補のエンコーダがそれぞれ使用できるかを、ビルドへの組み込み (-encoders) と
+// テストエンコードで確認して返す (結果は候補と同じ順)
+// エンコーダ一覧を取得できなかった場合はエラーを返す
+func DetectEncoders(ctx context.Context, ffmpegPath string, candidates []Encoder) ([]EncoderStatus, error) {
+	available, err := ListFFmpegEncoders(ctx, ffmpegPath)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]EncoderStatus, 0, len(candidates))
+	for _, enc := range candidates {
+		status := EncoderStatus{Encoder: enc}
+		if !available[enc.Name] {
+			status.Reason = "ffmpeg のビルドに含まれていません"
+		} else if err := TestEncoder(ctx, ffmpegPath, enc); err != nil {
+			status.Reason = err.Error()
+		} else {
+			status.Usable = true
+		}
+		statuses = append(statuses, status)
+		if ctx.Err() != nil {
+			return statuses, ctx.Err()
+		}
+	}
+	return statuses, nil
+}
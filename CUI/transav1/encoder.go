@@ -0,0 +1,155 @@
+package transav1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Encoder: エンコーダチェーンの1段 (Config.Encoders)
+// 動画はチェーンの先頭から順に試行され、失敗すると次の段にフォールバックする
+type Encoder struct {
+	Name    string // ffmpeg の映像エンコーダ名 (例: "av1_nvenc", "libsvtav1")
+	Options string // エンコーダ用の追加 ffmpeg オプション (例: "-cq 25 -preset p5", SplitOptions の規則で分割する)
+
+	// Args: Options の後に追加する引数 (分割・引用符の解釈を行わずに1要素を1引数として渡す)
+	Args []string
+
+	// Timeout: この段の ffmpeg 1回分のタイムアウト (0: Config.Timeout を使用, 負の値: タイムアウトなし)
+	Timeout time.Duration
+
+	// RetryOnTimeout: タイムアウトした場合にも次の段で再試行するか
+	// (false の場合、タイムアウトした動画は次の段を試行せずに失敗とする)
+	RetryOnTimeout bool
+}
+
+// hwEncoderSuffixes: ハードウェアエンコーダを示すエンコーダ名の接尾辞
+var hwEncoderSuffixes = []string{"_nvenc", "_qsv", "_amf", "_vaapi", "_videotoolbox", "_mf", "_v4l2m2m", "_vulkan", "_d3d12va"}
+
+// Hardware: ハードウェアエンコーダかどうか (エンコーダ名から判定する)
+// ハードウェアエンコーダは HW レーン (Config.HWJobs)、それ以外は CPU レーン (Config.CPUJobs) で実行される
+func (e Encoder) Hardware() bool {
+	name := strings.ToLower(e.Name)
+	for _, suffix := range hwEncoderSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// String: ログ表示用の "名前 (オプション)" 文字列を返す
+func (e Encoder) String() string {
+	if e.Options == "" && len(e.Args) == 0 {
+		return e.Name
+	}
+	return fmt.Sprintf("%s (%s)", e.Name, e.OptionsString())
+}
+
+// OptionsString: Options と Args を合わせた、ログ・ジャーナル記録用のオプション文字列を返す
+func (e Encoder) OptionsString() string {
+	if len(e.Args) == 0 {
+		return e.Options
+	}
+	args, err := e.Arguments()
+	if err != nil {
+		return e.Options
+	}
+	return JoinOptions(args)
+}
+
+// lane: この段を実行するレーン
+func (e Encoder) lane() encodeLane {
+	if e.Hardware() {
+		return laneHW
+	}
+	return laneCPU
+}
+
+// DefaultEncoders: デフォルトのエンコーダチェーン (HW: DefaultHWEncoder → CPU: DefaultCPUEncoder) を返す
+func DefaultEncoders() []Encoder {
+	return []Encoder{
+		{Name: DefaultHWEncoder, Options: DefaultHWOptions},
+		{Name: DefaultCPUEncoder, Options: DefaultCPUOptions},
+	}
+}
+
+// EncoderNames: チェーンのエンコーダ名を順に返す (ログ・イベント用)
+func EncoderNames(chain []Encoder) []string {
+	names := make([]string, len(chain))
+	for i, enc := range chain {
+		names[i] = enc.Name
+	}
+	return names
+}
+
+// Validate: エンコーダ名とオプションを検証する (オプションの分割と ValidateOptions による予約済み引数の確認)
+func (e Encoder) Validate() error {
+	return e.validate(flagOptions)
+}
+
+// validate: flags を値を取らないオプションの一覧として Validate の検証を行う
+func (e Encoder) validate(flags map[string]bool) error {
+	if strings.TrimSpace(e.Name) == "" {
+		return fmt.Errorf("エンコーダ名が空です")
+	}
+	args, err := e.Arguments()
+	if err == nil {
+		err = validateOptions(args, flags)
+	}
+	if err != nil {
+		return fmt.Errorf("エンコーダ %s のオプション: %w", e.Name, err)
+	}
+	return nil
+}
+
+// validateEncoders: エンコーダチェーンを検証し、各レーンに段があるかを返す
+// flags: 値を取らない ffmpeg オプションの一覧 (listFlagOptions)
+func validateEncoders(chain []Encoder, flags map[string]bool) (hasHW, hasCPU bool, err error) {
+	if len(chain) == 0 {
+		return false, false, fmt.Errorf("エンコーダが指定されていません")
+	}
+	for i, enc := range chain {
+		if err := enc.validate(flags); err != nil {
+			return false, false, fmt.Errorf("エンコーダチェーンの %d 段目: %w", i+1, err)
+		}
+		if enc.Hardware() {
+			hasHW = true
+		} else {
+			hasCPU = true
+		}
+	}
+	return hasHW, hasCPU, nil
+}
+
+// encoderTimeout: 段のタイムアウトを返す (0 以下はタイムアウトなし)
+func (r *run) encoderTimeout(enc Encoder) time.Duration {
+	switch {
+	case enc.Timeout > 0:
+		return enc.Timeout
+	case enc.Timeout < 0:
+		return 0
+	}
+	return r.cfg.Timeout
+}
+
+// retryStage: 出力サイズの基準未達による再エンコード (LargerRetry) に使用する段を返す
+// (チェーン中の最初の CPU エンコーダ, ない場合は -1)
+func (r *run) retryStage() int {
+	for i, enc := range r.cfg.Encoders {
+		if !enc.Hardware() {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstEncoder: 指定レーンで最初に使用されるエンコーダ名を返す (なければ空文字列, イベント用)
+func firstEncoder(chain []Encoder, lane encodeLane) string {
+	for _, enc := range chain {
+		if enc.lane() == lane {
+			return enc.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,303 @@
+package transav1
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// --- イベント種別 (フロントエンド向けの安定した名前) ---
+const (
+	EventRunStarted      = "run_started"      // 処理開始
+	EventFileQueued      = "file_queued"      // 動画をエンコードキューに投入
+	EventEncodeStarted   = "encode_started"   // ffmpeg 実行開始 (再試行ごとに発生)
+	EventProgress        = "progress"         // エンコード進捗
+	EventEncoderFallback = "encoder_fallback" // エンコード失敗によりチェーンの次のエンコーダで再試行
+	EventFileSucceeded   = "file_succeeded"   // 動画処理成功 (既存スキップを含む)
+	EventFileFailed      = "file_failed"      // 動画処理失敗 (中断による取りやめを含む)
+	EventRunFinished     = "run_finished"     // 処理終了
+)
+
+// EventNames: 全イベント種別の名前 (送出されうる順)
+var EventNames = []string{EventRunStarted, EventFileQueued, EventEncodeStarted, EventProgress, EventEncoderFallback, EventFileSucceeded, EventFileFailed, EventRunFinished}
+
+// progressEventInterval: progress イベントの最小送出間隔 (ファイルごと)
+const progressEventInterval = time.Second
+
+// Event: Config.OnEvent に渡されるイベント
+// 実体は *RunStartedEvent などのポインタで、JSON に変換するとフロントエンド向けの1行の形式になる
+type Event interface {
+	EventName() string
+}
+
+// EventHeader: 全イベント共通のフィールド
+type EventHeader struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+}
+
+// EventName: イベント種別の名前 (EventRunStarted など) を返す
+func (h EventHeader) EventName() string {
+	return h.Event
+}
+
+// RunStartedEvent: run_started イベント
+type RunStartedEvent struct {
+	EventHeader
+	Source     string   `json:"source"`
+	Dest       string   `json:"dest"`
+	SingleFile bool     `json:"single_file"`
+	HWEncoder  string   `json:"hw_encoder"`  // チェーン中の最初のハードウェアエンコーダ (なければ空)
+	CPUEncoder string   `json:"cpu_encoder"` // チェーン中の最初の CPU エンコーダ (なければ空)
+	Encoders   []string `json:"encoders"`    // エンコーダチェーン (試行順)
+	HWJobs     int      `json:"hw_jobs"`
+	CPUJobs    int      `json:"cpu_jobs"`
+	QuickMode  bool     `json:"quick_mode"`
+}
+
+// FileEvent: 動画ファイル単位のイベント (file_queued, encode_started, file_succeeded, file_failed)
+type FileEvent struct {
+	EventHeader
+	Source   string `json:"source"`
+	Output   string `json:"output"`
+	Index    int    `json:"index"`
+	Total    int    `json:"total"` // 0: 不明
+	Encoder  string `json:"encoder,omitempty"`
+	Lane     string `json:"lane,omitempty"`    // "hw" / "cpu"
+	Attempt  int    `json:"attempt,omitempty"` // ffmpeg の実行回数 (1 始まり)
+	Skipped  bool   `json:"skipped,omitempty"` // 出力が既に存在したためスキップ
+	Error    string `json:"error,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"` // ffmpeg の終了コード (内部コード -1〜-4 を含む)
+	TimedOut bool   `json:"timed_out,omitempty"`
+	// Interrupted: 中断 (Ctrl+C など) により処理を取りやめた (file_failed のみ。次回の実行で再処理される)
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// ProgressEvent: progress イベント
+type ProgressEvent struct {
+	EventHeader
+	Source      string   `json:"source"`
+	Encoder     string   `json:"encoder"`
+	OutTimeSec  float64  `json:"out_time_sec"`
+	DurationSec float64  `json:"duration_sec"`    // 0: 不明
+	Percent     *float64 `json:"percent"`         // 再生時間不明の場合は null
+	Speed       float64  `json:"speed"`           // 0: 不明
+	Frame       int64    `json:"frame"`           // 出力済みフレーム数
+	TotalSize   int64    `json:"total_size"`      // 出力済みバイト数
+	ETASec      *float64 `json:"eta_sec"`         // 算出できない場合は null
+	Finished    int      `json:"finished_files"`  // 完了ファイル数
+	TotalFiles  int      `json:"total_files"`     // 0: 不明
+	OverallPct  *float64 `json:"overall_percent"` // 算出できない場合は null
+	OverallETA  *float64 `json:"overall_eta_sec"` // 算出できない場合は null
+}
+
+// EncoderFallbackEvent: encoder_fallback イベント
+type EncoderFallbackEvent struct {
+	EventHeader
+	Source      string `json:"source"`
+	FromEncoder string `json:"from_encoder"`
+	ToEncoder   string `json:"to_encoder"`
+	Error       string `json:"error"`
+	ExitCode    int    `json:"exit_code"`
+}
+
+// RunFinishedEvent: run_finished イベント
+type RunFinishedEvent struct {
+	EventHeader
+	ElapsedSec  float64 `json:"elapsed_sec"`
+	Succeeded   int     `json:"succeeded"`
+	Skipped     int     `json:"skipped"`
+	Failed      int     `json:"failed"`      // 失敗した動画の数 (中断により処理を取りやめた動画は含めない)
+	Interrupted int     `json:"interrupted"` // 中断により処理を取りやめた動画の数
+	Errors      int     `json:"errors"`      // コピー失敗などを含む全エラー件数
+	ExitCode    int     `json:"exit_code"`
+	// Summary: 実行サマリーの項目ごとの件数 (例: "av1_remuxed": 3, 該当なしの場合は省略)
+	Summary map[string]int `json:"summary,omitempty"`
+}
+
+// eventEmitter: Config.OnEvent にイベントを送出し、動画ごとの最終結果を集計する
+// 複数のエンコードワーカーから同時に呼び出される (OnEvent の呼び出しは直列化する)
+type eventEmitter struct {
+	mu          sync.Mutex
+	onEvent     func(Event)             // nil の場合は集計のみ行う
+	tracker     *progressTracker        // progress イベントの全体進捗の取得元
+	lastSent    map[*videoJob]time.Time // progress イベントの間引き用
+	succeeded   int
+	skipped     int
+	failed      int
+	interrupted int
+}
+
+// newEventEmitter: イベントの送出先を作成する
+func newEventEmitter(onEvent func(Event), progress *progressTracker) *eventEmitter {
+	return &eventEmitter{onEvent: onEvent, tracker: progress, lastSent: make(map[*videoJob]time.Time)}
+}
+
+// emitLocked: イベントを送出する (e.mu を保持した状態で呼び出すこと)
+func (e *eventEmitter) emitLocked(ev Event) {
+	if e.onEvent != nil {
+		e.onEvent(ev)
+	}
+}
+
+// counts: 成功・スキップ・失敗・中断した動画の数を返す
+func (e *eventEmitter) counts() (succeeded, skipped, failed, interrupted int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.succeeded, e.skipped, e.failed, e.interrupted
+}
+
+// header: 共通フィールドを生成する
+func header(event string) EventHeader {
+	return EventHeader{Event: event, Time: time.Now()}
+}
+
+// laneLabel: レーンのイベント用名称
+func laneLabel(lane encodeLane) string {
+	if lane == laneHW {
+		return "hw"
+	}
+	return "cpu"
+}
+
+// newFileEvent: ジョブの共通フィールドを埋めたファイルイベントを生成する
+func newFileEvent(event string, job *videoJob) *FileEvent {
+	return &FileEvent{EventHeader: header(event), Source: job.inputFile, Output: job.outputFile, Index: job.index, Total: job.total}
+}
+
+// runStarted: run_started イベントを出力する
+func (e *eventEmitter) runStarted(cfg Config, source, dest string, singleFile bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emitLocked(&RunStartedEvent{
+		EventHeader: header(EventRunStarted),
+		Source:      source, Dest: dest, SingleFile: singleFile,
+		HWEncoder: firstEncoder(cfg.Encoders, laneHW), CPUEncoder: firstEncoder(cfg.Encoders, laneCPU), Encoders: EncoderNames(cfg.Encoders),
+		HWJobs: cfg.HWJobs, CPUJobs: cfg.CPUJobs,
+		QuickMode: cfg.QuickMode,
+	})
+}
+
+// fileQueued: file_queued イベントを出力する
+func (e *eventEmitter) fileQueued(job *videoJob) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emitLocked(newFileEvent(EventFileQueued, job))
+}
+
+// encodeStarted: encode_started イベントを出力する
+func (e *eventEmitter) encodeStarted(job *videoJob, lane encodeLane, encoder string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ev := newFileEvent(EventEncodeStarted, job)
+	ev.Encoder, ev.Lane, ev.Attempt = encoder, laneLabel(lane), job.attempts
+	e.emitLocked(ev)
+}
+
+// progress: progress イベントを出力する (ファイルごとに progressEventInterval で間引く)
+func (e *eventEmitter) progress(job *videoJob, encoder string, p ffmpegProgress) {
+	if e.onEvent == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !p.done && time.Since(e.lastSent[job]) < progressEventInterval {
+		return
+	}
+	e.lastSent[job] = time.Now()
+
+	ev := &ProgressEvent{
+		EventHeader: header(EventProgress),
+		Source:      job.inputFile, Encoder: encoder,
+		OutTimeSec: p.outTime.Seconds(), DurationSec: job.sourceDuration.Seconds(),
+		Speed: p.speed, Frame: p.frame, TotalSize: p.totalSize,
+	}
+	if job.sourceDuration > 0 {
+		percent := min(float64(p.outTime)/float64(job.sourceDuration)*100, 100)
+		ev.Percent = &percent
+		if p.speed > 0 {
+			eta := max((job.sourceDuration-p.outTime).Seconds()/p.speed, 0)
+			ev.ETASec = &eta
+		}
+	}
+	overall := e.tracker.snapshot()
+	ev.Finished, ev.TotalFiles = overall.finished, overall.total
+	if overall.percent >= 0 {
+		ev.OverallPct = &overall.percent
+	}
+	if overall.eta >= 0 {
+		eta := overall.eta.Seconds()
+		ev.OverallETA = &eta
+	}
+	e.emitLocked(ev)
+}
+
+// encoderFallback: encoder_fallback イベントを出力する
+func (e *eventEmitter) encoderFallback(job *videoJob, from, to string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ev := &EncoderFallbackEvent{EventHeader: header(EventEncoderFallback), Source: job.inputFile, FromEncoder: from, ToEncoder: to, ExitCode: job.lastResult.exitCode}
+	if job.lastResult.err != nil {
+		ev.Error = job.lastResult.err.Error()
+	}
+	e.emitLocked(ev)
+}
+
+// fileFinished: ジョブの最終結果に応じて file_succeeded / file_failed イベントを出力する
+// 中断 (ErrInterrupted) は interrupted を付けた file_failed とし、失敗としては数えない
+func (e *eventEmitter) fileFinished(job *videoJob, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.lastSent, job)
+
+	if err == nil {
+		ev := newFileEvent(EventFileSucceeded, job)
+		ev.Encoder, ev.Attempt, ev.Skipped = job.usedEncoder, job.attempts, job.skipped
+		if job.skipped {
+			e.skipped++
+		} else {
+			e.succeeded++
+		}
+		e.emitLocked(ev)
+		return
+	}
+
+	if errors.Is(err, ErrInterrupted) {
+		e.interrupted++
+		ev := newFileEvent(EventFileFailed, job)
+		ev.Encoder, ev.Attempt, ev.Error, ev.Interrupted = job.usedEncoder, job.attempts, err.Error(), true
+		e.emitLocked(ev)
+		return
+	}
+
+	e.failed++
+	ev := newFileEvent(EventFileFailed, job)
+	ev.Encoder, ev.Attempt, ev.Error = job.usedEncoder, job.attempts, err.Error()
+	if job.attempts > 0 {
+		exitCode := job.lastResult.exitCode
+		ev.ExitCode, ev.TimedOut = &exitCode, job.lastResult.timedOut
+	}
+	e.emitLocked(ev)
+}
+
+// pathFailed: ジョブ作成前 (出力パス計算など) に失敗した動画の file_failed イベントを出力する
+func (e *eventEmitter) pathFailed(source string, index, total int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failed++
+	ev := &FileEvent{EventHeader: header(EventFileFailed), Source: source, Index: index, Total: total, Error: err.Error()}
+	e.emitLocked(ev)
+}
+
+// runFinished: run_finished イベントを出力する
+func (e *eventEmitter) runFinished(elapsed time.Duration, errorCount int, exitCode int, summary map[string]int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emitLocked(&RunFinishedEvent{
+		EventHeader: header(EventRunFinished),
+		ElapsedSec:  elapsed.Seconds(),
+		Succeeded:   e.succeeded, Skipped: e.skipped, Failed: e.failed, Interrupted: e.interrupted,
+		Errors: errorCount, ExitCode: exitCode,
+		Summary: summary,
+	})
+}
@@ -0,0 +1,39 @@
+package transav1
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// 中断したジョブは interrupted を付けた file_failed として出力し、失敗として数えない
+func TestFileFinished(t *testing.T) {
+	tests := []struct {
+		skipped         bool
+		err             error
+		wantEvent       string
+		wantInterrupted bool
+	}{
+		{wantEvent: EventFileSucceeded},
+		{skipped: true, wantEvent: EventFileSucceeded},
+		{err: errors.New("ffmpeg 処理失敗"), wantEvent: EventFileFailed},
+		{err: ErrInterrupted, wantEvent: EventFileFailed, wantInterrupted: true},
+		{err: fmt.Errorf("再多重化: %w", ErrInterrupted), wantEvent: EventFileFailed, wantInterrupted: true},
+	}
+	var events []Event
+	e := newEventEmitter(func(ev Event) { events = append(events, ev) }, nil)
+	for _, tt := range tests {
+		e.fileFinished(&videoJob{inputFile: "a.mp4", skipped: tt.skipped}, tt.err)
+		ev := events[len(events)-1]
+		if got := ev.EventName(); got != tt.wantEvent {
+			t.Errorf("fileFinished(skipped=%v, err=%v): %s, want %s", tt.skipped, tt.err, got, tt.wantEvent)
+		}
+		if got := ev.(*FileEvent).Interrupted; got != tt.wantInterrupted {
+			t.Errorf("fileFinished(skipped=%v, err=%v): interrupted %v, want %v", tt.skipped, tt.err, got, tt.wantInterrupted)
+		}
+	}
+	succeeded, skipped, failed, interrupted := e.counts()
+	if succeeded != 1 || skipped != 1 || failed != 1 || interrupted != 2 {
+		t.Errorf("counts() = %d, %d, %d, %d, want 1, 1, 1, 2", succeeded, skipped, failed, interrupted)
+	}
+}
@@ -0,0 +1,713 @@
+package transav1
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ffmpegResult: ffmpeg の実行結果を格納する構造体
+type ffmpegResult struct {
+	err      error // 発生したエラー
+	timedOut bool  // タイムアウトしたかどうか
+	exitCode int   // ffmpeg プロセスの終了コード (-1: 不明, -2: タイムアウト, -3: 実行時エラー, -4: 中断)
+	// verifyFailed: ffmpeg は正常終了したが、出力の検証 (verifyOutput) に失敗した
+	verifyFailed bool
+}
+
+// failureMarkerSuffix: ffmpeg の失敗結果に対応するマーカーのサフィックスを返す
+func failureMarkerSuffix(result ffmpegResult) string {
+	switch {
+	case result.verifyFailed:
+		return VerifySuffix
+	case result.timedOut:
+		return ".timeout"
+	case result.exitCode > 0:
+		// ffmpeg が明確なエラーコードで終了した場合
+		return fmt.Sprintf(".failed_%d", result.exitCode)
+	case result.exitCode != 0:
+		// その他の失敗 (実行時エラーなど)
+		return ".failed"
+	}
+	return ".error"
+}
+
+// markerError: 失敗マーカーを伴うエラー (processVideoFile がマーカー作成とジャーナル記録を行う)
+type markerError struct {
+	suffix string // マーカーのサフィックス (例: ".failed_1")
+	detail string // マーカーファイルに書き込む内容
+	err    error
+}
+
+func (e *markerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *markerError) Unwrap() error {
+	return e.err
+}
+
+// executeFFmpeg: ffmpeg プロセスを実行し、結果を返す
+// ctx: タイムアウト・中断制御のためのコンテキスト
+// inputPath: 入力ファイルパス
+// outputPath: 出力ファイルパス (QuickMode時は最終パス、TempMode時は一時パス)
+// encoder: 使用するエンコーダ名 (例: "av1_nvenc", "libsvtav1")
+// encoderArgs: エンコーダ固有の引数 (SplitOptions で分割済み, 例: ["-cq", "25", "-preset", "p5"])
+// streams: 出力に含めるストリームと多重化するサイドカー (mapStreams)
+// onProgress: -progress 出力を1ブロック受信するごとに呼び出されるコールバック (nil 可)
+func (r *run) executeFFmpeg(ctx context.Context, inputPath string, outputPath string, encoder string, encoderArgs []string, streams streamMapping, onProgress func(ffmpegProgress)) ffmpegResult {
+	result := ffmpegResult{exitCode: -1} // 終了コードの初期値は不明(-1)
+
+	// ffmpeg コマンドの基本パス (Config.FFmpegPath)
+	baseCmd := r.cfg.FFmpegPath
+
+	// ffmpeg に渡す引数リストを構築
+	args := []string{
+		"-hide_banner",        // バナー情報を非表示に
+		"-nostats",            // 定期的な進捗状況の出力を抑制 (ログが見やすくなる)
+		"-progress", "pipe:1", // 進捗は key=value 形式で標準出力に出力させ、解析する
+		"-i", inputPath, // 入力ファイル指定
+	}
+	// 多重化するサイドカー (字幕・カバー画像) を入力 1 以降に追加する
+	for _, sidecar := range streams.sidecars {
+		args = append(args, "-i", sidecar)
+	}
+	args = append(args,
+		"-c:v", encoder, // 映像エンコーダ指定 (カバー画像は streams.args でコピーを指定する)
+		"-y", // 出力ファイルを常に上書き
+		// ここにストリームの選択 (音声・字幕のコーデックを含む)、エンコーダ固有オプション、ログレベルが追加される
+	)
+	args = append(args, streams.args...)
+
+	// エンコーダ固有オプションを追加 (引用符を含む文字列は呼び出し側で SplitOptions により分割済み)
+	if len(encoderArgs) > 0 {
+		args = append(args, encoderArgs...)
+		r.debugf("エンコーダ (%s) 固有オプション追加: %q", encoder, encoderArgs)
+	}
+
+	// ログレベルを設定 (デバッグログの有無に応じて変更)
+	if r.debugEnabled() {
+		// デバッグモード時は詳細なエラー情報が見たいので 'error' レベル
+		args = append(args, "-loglevel", "error")
+	} else {
+		// 通常時は致命的なエラーのみ表示する 'fatal' レベルでログを最小限に
+		args = append(args, "-loglevel", "fatal")
+	}
+
+	// 最後に出力ファイルパスを追加
+	args = append(args, outputPath)
+
+	// --- コマンド構築 ---
+	// 優先度は nice 等の外部コマンドを経由せず、startProcess で設定する (priority_<os>.go)
+	cmd := exec.CommandContext(ctx, baseCmd, args...)
+	setOSSpecificAttrs(cmd) // OS 固有の属性を設定 (例: Windows でウィンドウ非表示)
+
+	// --- 標準エラー出力のパイプ設定 ---
+	// ffmpeg は進捗やエラーを標準エラー出力 (stderr) に出すことが多い
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		result.err = fmt.Errorf("ffmpeg (%s) stderr パイプ作成エラー: %w", encoder, err)
+		return result
+	}
+	// 標準出力 (stdout) も念のためキャプチャ (loglevel fatal ならほぼ出ないはず)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		result.err = fmt.Errorf("ffmpeg (%s) stdout パイプ作成エラー: %w", encoder, err)
+		return result
+	}
+
+	// --- ffmpeg プロセス実行開始 ---
+	started := time.Now()
+	r.logger.Printf("ffmpeg 実行開始 (%s): %s", encoder, filepath.Base(outputPath))      // 通常ログはシンプルに
+	r.debugf("コマンド (%s): %s %s", encoder, cmd.Path, strings.Join(cmd.Args[1:], " ")) // デバッグ用にコマンド全体表示
+
+	// 優先度設定失敗は警告ログのみ (startProcess 内でログ出力される)
+	if err := r.startProcess(cmd, r.cfg.Priority); err != nil {
+		result.err = fmt.Errorf("ffmpeg (%s) プロセス開始エラー: %w", encoder, err)
+		return result
+	}
+
+	// --- 標準出力/エラー出力の非同期読み取り ---
+	var ffmpegOutput strings.Builder // ffmpeg の出力を貯めるバッファ
+	var outputMu sync.Mutex          // stderr/stdout の両ゴルーチンから追記されるため排他制御する
+	stderrScanner := bufio.NewScanner(stderrPipe)
+	stdoutScanner := bufio.NewScanner(stdoutPipe)
+	stderrChan := make(chan struct{}) // stderr 読み取り完了通知用チャネル
+	stdoutChan := make(chan struct{}) // stdout 読み取り完了通知用チャネル
+
+	// stderr 読み取りゴルーチン
+	go func() {
+		defer close(stderrChan) // ゴルーチン終了時にチャネルを閉じる
+		for stderrScanner.Scan() {
+			line := stderrScanner.Text()
+			outputMu.Lock()
+			ffmpegOutput.WriteString(line + "\n") // バッファに追記
+			outputMu.Unlock()
+			// デバッグモード時、またはエラーっぽい行のみログに出力
+			if r.debugEnabled() || strings.Contains(strings.ToLower(line), "error") {
+				r.logger.Printf("ffmpeg stderr (%s): %s", encoder, line)
+			}
+		}
+		if err := stderrScanner.Err(); err != nil {
+			// スキャン中にエラーが発生した場合
+			r.logger.Printf("警告: ffmpeg (%s) stderr の読み取り中にエラー: %v", encoder, err)
+		}
+	}()
+
+	// stdout 読み取りゴルーチン (-progress pipe:1 の進捗情報もここに出力される)
+	go func() {
+		defer close(stdoutChan) // ゴルーチン終了時にチャネルを閉じる
+		var progress ffmpegProgress
+		for stdoutScanner.Scan() {
+			line := stdoutScanner.Text()
+			if isProgressLine(line) {
+				// 進捗行はバッファに残さず解析のみ行う (progress= 行で1ブロック完了)
+				if progress.apply(line) && onProgress != nil {
+					onProgress(progress)
+				}
+				continue
+			}
+			outputMu.Lock()
+			ffmpegOutput.WriteString(line + "\n") // バッファに追記
+			outputMu.Unlock()
+			// 標準出力はデバッグモード時のみログに出力
+			if r.debugEnabled() {
+				r.debugf("ffmpeg stdout (%s): %s", encoder, line)
+			}
+		}
+		if err := stdoutScanner.Err(); err != nil {
+			// スキャン中にエラーが発生した場合
+			r.logger.Printf("警告: ffmpeg (%s) stdout の読み取り中にエラー: %v", encoder, err)
+		}
+	}()
+
+	// --- 出力読み取りゴルーチンの完全終了を待つ ---
+	// cmd.Wait() はパイプを閉じるため、読み取りが完了してから呼び出す必要がある
+	// (プロセス終了でパイプが EOF になり、ゴルーチン内のループが終了してチャネルが閉じられる)
+	<-stderrChan
+	<-stdoutChan
+
+	// --- プロセス終了待機 ---
+	// cmd.Wait() はプロセスが終了するまでブロックする
+	err = cmd.Wait()
+
+	// --- 実行結果の判定 ---
+	// 1. タイムアウト (コンテキストキャンセル) を確認
+	if ctx.Err() == context.DeadlineExceeded {
+		result.err = fmt.Errorf("ffmpeg (%s) タイムアウト (%v経過)", encoder, time.Since(started).Round(time.Second))
+		result.timedOut = true
+		result.exitCode = -2 // タイムアウトを示す内部コード
+		// 念のためプロセスを Kill (既に終了している可能性もある)
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill() // エラーは無視
+		}
+		r.logger.Printf("エラー: %v", result.err) // タイムアウトはエラーとしてログ出力
+	} else if ctx.Err() == context.Canceled {
+		// 1-2. 中断要求 (Ctrl+C / SIGTERM) によりプロセスが停止された
+		result.err = fmt.Errorf("ffmpeg (%s) 中断", encoder)
+		result.exitCode = -4 // 中断を示す内部コード
+		r.logger.Printf("ffmpeg (%s) を中断しました: %s", encoder, filepath.Base(outputPath))
+	} else if err != nil {
+		// 2. Wait() がタイムアウト以外のエラーを返した場合
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// プロセスは終了したが、ゼロ以外の終了コード
+			result.exitCode = exitErr.ExitCode()
+			// エラーメッセージには終了コードと ffmpeg の出力を付与
+			errMsg := fmt.Sprintf("ffmpeg (%s) 失敗 (終了コード: %d)", encoder, result.exitCode)
+			outputStr := strings.TrimSpace(ffmpegOutput.String())
+			if outputStr != "" {
+				errMsg += fmt.Sprintf("\n--- ffmpeg 出力 ---\n%s\n--- 出力終了 ---", outputStr)
+			}
+			result.err = errors.New(errMsg)    // エラー内容をセット
+			r.logger.Printf("エラー: %s", errMsg) // エラーログを出力
+		} else {
+			// その他の実行時エラー (コマンドが見つからないなど)
+			result.exitCode = -3 // 実行時エラーを示す内部コード
+			result.err = fmt.Errorf("ffmpeg (%s) 実行時エラー: %w", encoder, err)
+			r.logger.Printf("エラー: %v", result.err) // エラーログを出力
+		}
+	} else {
+		// 3. 正常終了 (err == nil)
+		result.exitCode = 0
+		r.debugf("ffmpeg (%s) 正常終了 (終了コード: 0)", encoder)
+		// 正常終了時でも、デバッグモードなら出力をログに残す
+		outputStr := strings.TrimSpace(ffmpegOutput.String())
+		if r.debugEnabled() && outputStr != "" {
+			r.debugf("ffmpeg (%s) 正常終了時の出力:\n--- ffmpeg 出力 ---\n%s\n--- 出力終了 ---", encoder, outputStr)
+		}
+	}
+
+	return result
+}
+
+// checkExistingOutput: ジャーナルを参照して、出力済みとしてスキップできるか判定する
+// - ジャーナル上で完了しており、出力ファイルが記録どおり存在すればスキップ
+// - ジャーナル上で未完了 (中断・失敗など) の出力ファイルは不完全とみなして削除し、再エンコードする
+// - ジャーナルに記録がない既存の出力 (ジャーナル導入前の出力など) は完了として取り込み、スキップ
+// - ジャーナル上で別の入力の出力として完了している出力は、取り込みも削除もせずにエラーとする
+func (r *run) checkExistingOutput(job *videoJob) (skip bool, err error) {
+	job.outputFile = r.existingOutput(job.outputFile) // -container auto で mkv に切り替えた出力
+	outputInfo, statErr := os.Stat(job.outputFile)
+	outputExists := statErr == nil && !outputInfo.IsDir()
+	if statErr != nil && !os.IsNotExist(statErr) {
+		r.logger.Printf("警告: ファイル状態確認エラー (%s): %v", job.outputFile, statErr)
+	}
+	if owner, ok := r.journal.outputOwner(job.outputFile, job.inputFile); ok && outputExists {
+		return false, fmt.Errorf("出力ファイル '%s' はジャーナル上で別の入力 (%s) の出力です。上書きしません", filepath.Base(job.outputFile), owner.Source)
+	}
+
+	entry, known := r.journal.lookup(job.inputFile)
+	switch {
+	case known && entry.State == stateDone && r.journal.outputPath(entry) != job.outputFile:
+		// AV1 ソースのコピーなど、記録上の出力が通常の出力パスと異なる場合はそちらを確認する
+		if info, err := os.Stat(r.journal.outputPath(entry)); err == nil && (entry.OutputSize == 0 || info.Size() == entry.OutputSize) {
+			r.logger.Printf("スキップ (処理済み): %s", filepath.Base(r.journal.outputPath(entry)))
+			job.placed = r.journal.outputPath(entry)
+			return true, nil
+		}
+		r.logger.Printf("警告: ジャーナル上は処理済みですが、出力ファイルが見つかりません。再処理します: %s", filepath.Base(r.journal.outputPath(entry)))
+	case known && entry.State == stateDone:
+		if outputExists && (entry.OutputSize == 0 || outputInfo.Size() == entry.OutputSize) {
+			r.logger.Printf("スキップ (変換済み): %s", filepath.Base(job.outputFile))
+			job.placed, job.muxed = job.outputFile, job.sidecars // 変換済みの出力には多重化済みとみなす
+			return true, nil
+		}
+		if outputExists {
+			r.logger.Printf("警告: ジャーナル上は変換済みですが、出力サイズが記録と異なります (%d != %d)。再エンコードします: %s", outputInfo.Size(), entry.OutputSize, filepath.Base(job.outputFile))
+		} else {
+			r.logger.Printf("警告: ジャーナル上は変換済みですが、出力ファイルが見つかりません。再エンコードします: %s", filepath.Base(job.outputFile))
+		}
+	case known:
+		if outputExists {
+			r.logger.Printf("情報: 前回の処理が完了していない出力ファイル (状態: %s) を削除して再エンコードします: %s", entry.State, filepath.Base(job.outputFile))
+		}
+	case outputExists && outputInfo.Size() > 0:
+		r.logger.Printf("スキップ (出力ファイル既存): %s", filepath.Base(job.outputFile))
+		r.journal.record(journalEntry{Source: job.inputFile, Output: job.outputFile, State: stateDone, OutputSize: outputInfo.Size(), Note: "既存の出力を取り込み"})
+		job.placed, job.muxed = job.outputFile, job.sidecars
+		return true, nil
+	case outputExists:
+		r.logger.Printf("情報: サイズ 0 の出力ファイルを削除して再エンコードします: %s", filepath.Base(job.outputFile))
+	}
+
+	if outputExists {
+		if err := os.Remove(job.outputFile); err != nil {
+			r.logger.Printf("警告: 不完全な出力ファイルの削除失敗 (%s): %v", job.outputFile, err)
+		}
+	}
+	return false, nil
+}
+
+// prepareVideoJob: エンコード前の準備 (既存チェック、出力ディレクトリ作成、Quick/Temp モード分岐)
+// 準備した作業状態は job に保存され、HW レーンから CPU レーンへ再キューされても引き継がれる
+// 戻り値 skip が true の場合、出力ファイルが既に存在する (または AV1 ソースを処理済み) ためエンコード不要
+func (r *run) prepareVideoJob(job *videoJob) (skip bool, err error) {
+	// --- 事前チェック ---
+	// 変換済みかどうかはジャーナルを参照して判定する
+	if skip, err := r.checkExistingOutput(job); err != nil {
+		return false, err
+	} else if skip {
+		job.skipped = true
+		return true, nil // 変換済みの場合は正常終了扱い
+	}
+
+	// 出力ディレクトリ作成 - MkdirAll は存在してもエラーにならない
+	if err := os.MkdirAll(job.outputDir, 0755); err != nil {
+		// 出力ディレクトリが作成できない場合は致命的エラー
+		return false, fmt.Errorf("出力ディレクトリ '%s' の作成エラー: %w", job.outputDir, err)
+	}
+
+	inputFile := job.inputFile
+
+	// --- 入力の事前検証 (ffprobe) ---
+	// 一時コピーや QuickMode のリネームより前に行い、読み取れない入力ではエンコードを試行しない
+	info, err := r.probeInput(r.ctx, inputFile)
+	if err != nil {
+		return false, err
+	}
+	if info != nil {
+		firstProbe := job.sourceInfo == nil // 再エンコード (-larger retry) 時は進捗の集計に二重登録しない
+		job.sourceInfo = info
+		job.sourceDuration = info.duration()
+		if firstProbe {
+			r.progress.jobProbed(job)
+		}
+		r.debugf("入力検証 OK: %s (再生時間: %s)", filepath.Base(inputFile), formatClock(job.sourceDuration))
+	}
+
+	if info, err := os.Stat(inputFile); err == nil {
+		job.inputSize = info.Size()
+	}
+
+	// --- 出力のコンテナ (-container auto) ---
+	r.chooseContainer(job)
+
+	// --- 既に AV1 の入力 (-av1src) ---
+	if handled, err := r.handleAV1Source(job, r.cfg.AV1Source); handled || err != nil {
+		return handled, err
+	}
+
+	// --- ジャーナルに処理開始を記録 ---
+	// QuickMode ではソースのリネーム前に記録し、中断時の回復処理の対象とする
+	job.startedAt = time.Now()
+	r.journal.record(journalEntry{Source: inputFile, Output: job.outputFile, State: stateEncoding, QuickMode: r.cfg.QuickMode, StartedAt: job.startedAt, InputSize: job.inputSize})
+
+	if r.cfg.QuickMode {
+		// === Quick モード ===
+		// 1. .origin マーカーファイルを作成 (出力先ディレクトリに)
+		job.quickModeOriginMarker = filepath.Join(job.outputDir, filepath.Base(inputFile)+originSuffix)
+		r.debugf("Quick Mode: .origin マーカー作成試行: %s", job.quickModeOriginMarker)
+		markerFile, err := os.Create(job.quickModeOriginMarker)
+		if err != nil {
+			// マーカー作成失敗は警告に留めるが、回復処理は機能しない可能性がある
+			r.logger.Printf("警告 [Quick Mode]: .origin マーカー作成失敗 (%s): %v。回復処理が機能しない可能性があります。", job.quickModeOriginMarker, err)
+			job.quickModeOriginMarker = "" // マーカーパスをクリア
+		} else {
+			markerFile.Close() // 0バイトファイルなので即クローズ
+			r.debugf("Quick Mode: .origin マーカー作成成功")
+		}
+
+		// 2. ソースファイルをリネームして ffmpeg の入力とする
+		job.renamedSourcePath = inputFile + processingSuffix // リネーム後のパス
+		r.logger.Printf("Quick Mode: ソースファイルを処理中名にリネーム: %s -> %s", filepath.Base(inputFile), filepath.Base(job.renamedSourcePath))
+		if err := os.Rename(inputFile, job.renamedSourcePath); err != nil {
+			// リネーム失敗は致命的エラー
+			// 作成したマーカーファイルがあれば削除する
+			if job.quickModeOriginMarker != "" {
+				_ = os.Remove(job.quickModeOriginMarker)
+			}
+			return false, fmt.Errorf("Quick Mode ソースファイルリネーム失敗 (%s -> %s): %w", inputFile, job.renamedSourcePath, err)
+		}
+		job.currentInputFile = job.renamedSourcePath // ffmpeg への入力はリネーム後のファイル
+		job.tempOutputPath = job.outputFile          // Quick Mode では一時出力ファイルは使わず、直接最終出力パスに出力
+		r.debugf("Quick Mode: ffmpeg 入力: %s, ffmpeg 出力: %s", job.currentInputFile, job.tempOutputPath)
+	} else {
+		// === Temp モード (デフォルト) ===
+		// ソースファイルをジョブ専用の一時サブディレクトリにコピーして ffmpeg の入力とする
+		// (並列実行時に同名ファイルが衝突しないよう、ジョブごとにディレクトリを分ける)
+		r.logger.Printf("Temp Mode: 一時ディレクトリにファイルをコピーします")
+		jobTempDir, err := os.MkdirTemp(r.tempDir, "job_")
+		if err != nil {
+			return false, fmt.Errorf("ジョブ用一時ディレクトリ作成失敗 (%s): %w", r.tempDir, err)
+		}
+		job.jobTempDir = jobTempDir
+		// 一時ディレクトリ内の入力ファイルパス
+		job.currentInputFile = filepath.Join(jobTempDir, filepath.Base(inputFile))
+		// 一時ディレクトリ内の一時出力ファイルパス (ユニークな名前を付与)
+		tempOutputFileName := fmt.Sprintf("%s_%d%s",
+			strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(filepath.Base(inputFile))),
+			time.Now().UnixNano(),                  // ナノ秒タイムスタンプで衝突回避
+			OutputTag+filepath.Ext(job.outputFile)) // 出力と同じコンテナ (ffmpeg は拡張子から形式を決める)
+		job.tempOutputPath = filepath.Join(jobTempDir, tempOutputFileName)
+		r.debugf("Temp Mode: ffmpeg 入力: %s, ffmpeg 出力: %s", job.currentInputFile, job.tempOutputPath)
+
+		// ファイルコピー実行 (fileutils.go)
+		r.logger.Printf("一時コピー中: %s -> %s", filepath.Base(inputFile), filepath.Base(job.currentInputFile))
+		if err := r.copyFileManually(inputFile, job.currentInputFile); err != nil {
+			// コピー失敗時はジョブ用一時ディレクトリごと削除
+			r.cleanupVideoJob(job)
+			return false, fmt.Errorf("一時コピー失敗 (%s -> %s): %w", inputFile, job.currentInputFile, err)
+		}
+		r.debugf("一時コピー完了: %s", job.currentInputFile)
+	}
+
+	job.prepared = true
+	return false, nil
+}
+
+// cleanupVideoJob: ジョブ用の一時サブディレクトリを削除する (Temp モードのみ)
+func (r *run) cleanupVideoJob(job *videoJob) {
+	if job.jobTempDir == "" {
+		return
+	}
+	r.debugf("ジョブ用一時ディレクトリ削除: %s", job.jobTempDir)
+	if err := os.RemoveAll(job.jobTempDir); err != nil {
+		r.logger.Printf("警告: ジョブ用一時ディレクトリ '%s' の削除に失敗: %v", job.jobTempDir, err)
+	}
+	job.jobTempDir = ""
+}
+
+// processVideoFile: 1つの動画ファイルをエンコーダチェーンの現在の段 (job.stage) で処理するメインロジック
+// job: 処理対象のジョブ (未準備なら prepareVideoJob で準備する)
+// 戻り値 requeue が true の場合、エンコードに失敗したため次の段 (job.stage は更新済み) で再試行すべきことを示す
+// (この場合ジョブの作業状態は維持され、エラーは nil)
+// 出力サイズの基準未達で再エンコードする場合も requeue が true となる (ジョブは未準備状態に戻る)
+func (r *run) processVideoFile(job *videoJob) (requeue bool, err error) {
+	inputFile := job.inputFile
+	outputFile := job.outputFile
+
+	// --- 中断要求の確認 ---
+	// (前の段から再キューされた準備済みのジョブも、ここで作業状態を元に戻す)
+	if r.interrupted() {
+		r.rollbackInterruptedJob(job)
+		return false, ErrInterrupted
+	}
+
+	// --- 入力ファイルの準備 (初回のみ) ---
+	if !job.prepared {
+		r.logger.Printf("動画処理開始: %s", filepath.Base(inputFile))
+		skip, err := r.prepareVideoJob(job)
+		if err != nil && r.interrupted() {
+			// 中断による ffprobe の停止などは読み取り不能・失敗として扱わない
+			r.rollbackInterruptedJob(job)
+			return false, ErrInterrupted
+		}
+		var unreadable *unreadableError
+		var marked *markerError
+		switch {
+		case errors.As(err, &unreadable):
+			// 読み取り不能: .unreadable マーカーに検証エラーを書き込み、エンコードは試行しない
+			r.logger.Printf("スキップ (入力読み取り不能): %s: %v", filepath.Base(inputFile), unreadable.err)
+			r.createMarkerFile(outputFile+unreadableSuffix, fmt.Sprintf("Probe: %v", unreadable.err))
+			r.journal.record(journalEntry{Source: inputFile, Output: outputFile, State: stateFailed, Marker: unreadableSuffix, Error: err.Error()})
+			return false, err
+		case errors.As(err, &marked):
+			r.createMarkerFile(outputFile+marked.suffix, marked.detail)
+			r.journal.record(journalEntry{
+				Source: inputFile, Output: outputFile, State: stateFailed,
+				Encoder: job.usedEncoder, Options: job.usedOptions, Attempts: job.attempts,
+				Marker: marked.suffix, Error: err.Error(), StartedAt: job.startedAt, InputSize: job.inputSize,
+			})
+			return false, err
+		case err != nil:
+			r.journal.record(journalEntry{Source: inputFile, Output: outputFile, State: stateFailed, QuickMode: r.cfg.QuickMode, Error: err.Error(), StartedAt: job.startedAt, InputSize: job.inputSize})
+			return false, err
+		}
+		if skip {
+			return false, nil
+		}
+		if r.interrupted() {
+			r.rollbackInterruptedJob(job)
+			return false, ErrInterrupted
+		}
+	}
+
+	// --- 既に AV1 の入力の再多重化 (-av1src remux) ---
+	if job.remux {
+		return false, r.remuxAV1Source(job)
+	}
+
+	// --- エンコード処理本体 ---
+	enc := r.cfg.Encoders[job.stage]
+	usedEncoder := enc.Name // 実際に使用されたエンコーダ名
+	laneName := "CPU"
+	if enc.Hardware() {
+		laneName = "HW"
+	}
+	// エンコーダ固有の引数 (New で検証済みのため、分割に失敗することはない)
+	encoderArgs, _ := enc.Arguments()
+	if job.sizeRetry {
+		encoderArgs, _ = SplitOptions(r.cfg.RetryOptions) // 出力サイズの基準未達による再エンコード
+	}
+	usedOptions := JoinOptions(encoderArgs) // 実際に使用されたオプション (ログ・ジャーナル用)
+
+	r.logger.Printf("%sエンコーダ (%s) で試行 [%d/%d段目]: %s", laneName, usedEncoder, job.stage+1, len(r.cfg.Encoders), filepath.Base(inputFile))
+	job.attempts++
+	job.usedEncoder = usedEncoder
+	job.usedOptions = usedOptions
+	r.events.encodeStarted(job, enc.lane(), usedEncoder)
+
+	// タイムアウト用コンテキスト設定 (ffmpeg の各実行ごと, 段ごとの指定を優先)
+	timeout := r.encoderTimeout(enc)
+	ctx, cancel := r.timeoutContext(timeout)
+	if timeout > 0 {
+		r.debugf("タイムアウト設定 (%s): %v", usedEncoder, timeout)
+	} else {
+		r.debugf("タイムアウト無効 (%s)", usedEncoder)
+	}
+	// 出力に含めるストリーム (映像フィルタはカバー画像のストリームコピーと両立しないため、カバー画像を除く)
+	job.streams = r.mapStreams(job.sourceInfo, job.outputFile, false, hasVideoFilter(encoderArgs), job.sidecars)
+	job.muxing = job.streams.sidecars
+	if len(job.streams.dropped) > 0 && job.attempts == 1 {
+		r.logger.Printf("情報: 出力に含めないストリーム (%s): %s", filepath.Base(inputFile), strings.Join(job.streams.dropped, ", "))
+	}
+	r.progress.encodeStarted(job)
+	result := r.executeFFmpeg(ctx, job.currentInputFile, job.tempOutputPath, usedEncoder, encoderArgs, job.streams, func(p ffmpegProgress) {
+		r.progress.update(job, usedEncoder, p)
+		r.events.progress(job, usedEncoder, p)
+	})
+	cancel() // リソースを解放
+	job.lastResult = result
+
+	if result.err == nil && result.exitCode == 0 {
+		// --- 出力の検証 (-verify) ---
+		// 最終パスへ配置する前に確認し、不一致は失敗として扱う (次の段があればそこで再試行)
+		if verifyErr := r.verifyOutput(job, job.tempOutputPath); verifyErr != nil {
+			r.logger.Printf("エラー: %sエンコード出力の検証失敗 (%s): %v", laneName, usedEncoder, verifyErr)
+			result = ffmpegResult{err: fmt.Errorf("出力の検証失敗: %w", verifyErr), exitCode: 0, verifyFailed: true}
+			job.lastResult = result
+		} else {
+			r.logger.Printf("%sエンコード成功 (%s)", laneName, usedEncoder)
+			return r.finishEncodeSuccess(job)
+		}
+	}
+
+	if r.interrupted() {
+		// 中断: 失敗マーカーは作成せず、作業状態を直ちに元に戻す
+		r.rollbackInterruptedJob(job)
+		return false, ErrInterrupted
+	}
+
+	r.logger.Printf("%sエンコード失敗 (%s, ExitCode: %d, TimedOut: %t): %v", laneName, usedEncoder, result.exitCode, result.timedOut, result.err)
+	if r.fallbackToNextStage(job, enc, result) {
+		return true, nil
+	}
+	return false, r.finishEncodeFailure(job, result)
+}
+
+// fallbackToNextStage: 失敗した段の次の段で再試行するかを判定し、再試行する場合は job.stage を進める
+// (最後の段、タイムアウトで RetryOnTimeout が無効な段、出力サイズの基準未達による再エンコードは再試行しない)
+func (r *run) fallbackToNextStage(job *videoJob, enc Encoder, result ffmpegResult) bool {
+	if job.sizeRetry {
+		return false
+	}
+	if job.stage+1 >= len(r.cfg.Encoders) {
+		if len(r.cfg.Encoders) > 1 {
+			r.logger.Printf("エンコーダチェーンの全ての段 (%s) で失敗しました: %s", strings.Join(EncoderNames(r.cfg.Encoders), " → "), filepath.Base(job.inputFile))
+		}
+		return false
+	}
+	if result.timedOut && !enc.RetryOnTimeout {
+		r.logger.Printf("エンコーダ (%s) がタイムアウトしたため、次のエンコーダでの再試行はスキップします。", enc.Name)
+		return false
+	}
+	next := r.cfg.Encoders[job.stage+1]
+	r.logger.Printf("次のエンコーダ (%s) で再試行します: %s", next.Name, filepath.Base(job.inputFile))
+	r.events.encoderFallback(job, enc.Name, next.Name)
+	job.stage++
+	return true
+}
+
+// finishEncodeFailure: エンコード失敗時の後処理 (失敗マーカーの作成、作業状態の復元、ジャーナルへの記録) を行う
+func (r *run) finishEncodeFailure(job *videoJob, result ffmpegResult) error {
+	inputFile, outputFile := job.inputFile, job.outputFile
+
+	// マーカーファイルを作成 (fileutils.go)
+	markerContent := fmt.Sprintf("Encoder: %s, Options: \"%s\", ExitCode: %d, TimedOut: %t, Error: %v", job.usedEncoder, job.usedOptions, result.exitCode, result.timedOut, result.err)
+	markerSuffix := failureMarkerSuffix(result)
+	// 失敗マーカーは最終出力ファイルパス基準で作成
+	failMarkerPath := outputFile + markerSuffix
+	r.createMarkerFile(failMarkerPath, markerContent)
+
+	// QuickMode の .origin マーカーがあれば削除 (失敗したので回復処理は不要)
+	if job.quickModeOriginMarker != "" {
+		r.debugf("エンコード失敗のため .origin マーカー削除: %s", job.quickModeOriginMarker)
+		_ = os.Remove(job.quickModeOriginMarker)
+	}
+
+	// 失敗時のクリーンアップ処理 (fileutils.go)
+	// QuickMode かどうかで処理内容が変わる
+	// handleProcessingFailure は ffmpegResult.err を返すか、独自のメッセージを生成する
+	failErr := r.handleProcessingFailure(inputFile, outputFile, result, r.cfg.QuickMode, job.renamedSourcePath, job.tempOutputPath)
+	r.cleanupVideoJob(job)
+
+	// ジャーナルに失敗を記録
+	failState := stateFailed
+	if result.timedOut {
+		failState = stateTimeout
+	}
+	exitCode := result.exitCode
+	r.journal.record(journalEntry{
+		Source: inputFile, Output: outputFile, State: failState, QuickMode: r.cfg.QuickMode,
+		Encoder: job.usedEncoder, Options: job.usedOptions, Attempts: job.attempts, ExitCode: &exitCode,
+		Marker: markerSuffix, Error: failErr.Error(),
+		StartedAt: job.startedAt, ElapsedSec: time.Since(job.startedAt).Seconds(), InputSize: job.inputSize,
+	})
+	return failErr
+}
+
+// finishEncodeSuccess: エンコード成功時の後処理 (出力の配置、ソースの復元、出力サイズの確認、ジャーナルへの記録) を行う
+// 戻り値は processVideoFile と同じ
+func (r *run) finishEncodeSuccess(job *videoJob) (requeue bool, err error) {
+	inputFile, outputFile := job.inputFile, job.outputFile
+	r.logger.Printf("エンコード成功: %s", filepath.Base(outputFile)) // 最終出力ファイル名でログ表示
+	defer r.cleanupVideoJob(job)                              // Temp モードのジョブ用一時ディレクトリは最後に削除
+
+	if !r.cfg.QuickMode {
+		// === Temp モード成功時 ===
+		// 一時出力ファイルを最終出力先に移動 (リネーム)
+		tempOutputPath := job.tempOutputPath
+		r.debugf("Temp Mode: 一時ファイルを最終出力先に移動: %s -> %s", tempOutputPath, outputFile)
+		// 移動先にファイルが存在しないことを確認 (念のため)
+		if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+			// 存在する場合 (通常ありえないはずだが)、一時ファイルを削除して警告
+			r.logger.Printf("警告: 移動先 '%s' にファイルが既に存在します。一時ファイル '%s' は削除されます。", outputFile, tempOutputPath)
+			_ = os.Remove(tempOutputPath) // エラーは無視
+			job.placed = outputFile
+			return false, nil // 成功として終了 (既存ファイルを上書きしない)
+		}
+
+		// リネーム実行
+		if err := os.Rename(tempOutputPath, outputFile); err != nil {
+			// リネーム失敗時のリカバリ試行
+			_ = os.Remove(tempOutputPath) // 一時ファイルを削除
+			_ = os.Remove(outputFile)     // 作成された可能性のある最終ファイルを削除
+			// 失敗をエラーとして返す
+			return false, fmt.Errorf("一時ファイル移動失敗 (%s -> %s): %w", tempOutputPath, outputFile, err)
+		}
+		r.logger.Printf("ファイル移動完了: %s", filepath.Base(outputFile))
+
+		// Temp モードでは、一時ディレクトリにコピーした入力ファイル (currentInputFile) は
+		// cleanupVideoJob でジョブ用一時ディレクトリごと削除される。元の入力ファイル (inputFile) はそのまま残る。
+
+	} else {
+		// === Quick モード成功時 ===
+		// 1. .origin マーカーファイルを削除
+		if job.quickModeOriginMarker != "" {
+			r.debugf("Quick Mode 成功: .origin マーカー削除: %s", job.quickModeOriginMarker)
+			if err := os.Remove(job.quickModeOriginMarker); err != nil {
+				// マーカー削除失敗は警告ログに留める
+				r.logger.Printf("警告 [Quick Mode]: .origin マーカー削除失敗 (%s): %v", job.quickModeOriginMarker, err)
+			}
+		}
+
+		// 2. リネームしていたソースファイルを元の名前に戻す
+		r.debugf("Quick Mode 成功: 処理中ファイル名を元に戻します: %s -> %s", job.renamedSourcePath, inputFile)
+		if err := os.Rename(job.renamedSourcePath, inputFile); err != nil {
+			// ★★★ リネームバック失敗は致命的なエラーとして扱う ★★★
+			renameErr := fmt.Errorf("Quick Mode リネームバック失敗 (%s -> %s): %w", job.renamedSourcePath, inputFile, err)
+			r.logger.Printf("エラー [Quick Mode]: %v", renameErr)
+			r.logger.Printf("  手動で '%s' を '%s' に戻し、出力ファイル '%s' を確認してください。", job.renamedSourcePath, inputFile, outputFile)
+			// 失敗を示すエラーを返す
+			return false, renameErr
+		}
+		// Quick モードでは ffmpeg が直接 outputFile に出力しているので、移動は不要。
+	}
+
+	// --- 出力サイズの確認 (-minsaving / -larger) ---
+	if retry, handled, err := r.applySizeGuard(job); retry {
+		return true, nil
+	} else if handled {
+		if err == nil {
+			r.logger.Printf("動画処理完了 (元ファイルを保持): %s", filepath.Base(inputFile))
+		}
+		return false, err
+	}
+
+	// ジャーナルに完了を記録 (出力サイズは次回の変換済み判定に使用)
+	{
+		var outputSize int64
+		if info, err := os.Stat(outputFile); err == nil {
+			outputSize = info.Size()
+		}
+		r.journal.record(journalEntry{
+			Source: inputFile, Output: outputFile, State: stateDone, QuickMode: r.cfg.QuickMode,
+			Encoder: job.usedEncoder, Options: job.usedOptions, Attempts: job.attempts,
+			StartedAt: job.startedAt, ElapsedSec: time.Since(job.startedAt).Seconds(),
+			InputSize: job.inputSize, OutputSize: outputSize, Note: job.note,
+		})
+	}
+
+	// 正常終了
+	job.placed, job.muxed = outputFile, job.muxing
+	r.logger.Printf("動画処理完了: %s", filepath.Base(outputFile))
+	return false, nil
+}
@@ -1,4 +1,4 @@
-package main
+package transav1
 
 import (
 	"fmt"
@@ -26,17 +26,74 @@ var (
 		".nef": {}, ".orf": {}, ".sr2": {}, ".svg": {}, ".avif": {},
 	}
 	// -restart オプションで削除対象とするマーカーファイルのサフィックス
-	failedMarkersToDelete = []string{".failed", ".timeout", ".error", ".unreadable", ".failed_"} // .failed_NN も対象に含める
+	failedMarkersToDelete = []string{".failed", ".timeout", ".error", ".unreadable", ".verify_failed", ".failed_"} // .failed_NN も対象に含める
 )
 
-// 出力ファイル名のサフィックス
-const outputSuffix = "_AV1.mp4"
+// OutputSuffix: 既定のコンテナ (mp4) の出力ファイル名のサフィックス (例: input.mkv -> input_AV1.mp4, container.go)
+const OutputSuffix = OutputTag + ".mp4"
+
+// IsVideoFile: 拡張子から処理対象の動画ファイルかどうかを判定する
+func IsVideoFile(path string) bool {
+	_, ok := videoExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// isOutputName: 変換済みの出力のファイル名 (「名前_AV1.mp4」「名前_AV1.mkv」など) か判定する (出力を再び入力としてエンコードしないため)
+// -container の指定にかかわらず、全てのコンテナの出力を対象とする
+func isOutputName(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for ct := range containerFormats {
+		if strings.HasSuffix(name, strings.ToLower(OutputSuffixFor(ct))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePath: シンボリックリンクを解決した絶対パスを返す (存在しない末尾の部分は解決済みの親にそのまま連結する)
+func ResolvePath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	var rest []string // 存在しない末尾の部分 (親から順)
+	for cur := abs; ; {
+		if resolved, err := filepath.EvalSymlinks(cur); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return abs
+		}
+		rest = append([]string{filepath.Base(cur)}, rest...)
+		cur = parent
+	}
+}
+
+// IsSubPath: child が parent の配下 (parent 自体を除く) にあるか判定する (パスは ResolvePath などで正規化しておく)
+func IsSubPath(parent, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// outputStem: 出力のファイル名から OutputTag とコンテナの拡張子を除いた名前を求める (出力のファイル名でなければ ok は false)
+func outputStem(name string) (stem string, ok bool) {
+	if !isOutputName(name) {
+		return "", false
+	}
+	stem = strings.TrimSuffix(name, filepath.Ext(name))
+	return stem[:len(stem)-len(OutputTag)], true
+}
 
 // getOutputPath: 入力ファイルパスに対応する出力ファイルパスを生成する
 // inputFile: 入力ファイルのフルパス
 // srcRoot: 入力元のルートディレクトリパス
 // dstRoot: 出力先のルートディレクトリパス
-func getOutputPath(inputFile, srcRoot, dstRoot string) (string, error) {
+// suffix: 出力ファイル名のサフィックス (OutputSuffixFor)
+func getOutputPath(inputFile, srcRoot, dstRoot, suffix string) (string, error) {
 	// 入力元ルートからの相対パスを計算
 	relPath, err := filepath.Rel(srcRoot, inputFile)
 	if err != nil {
@@ -47,7 +104,7 @@ func getOutputPath(inputFile, srcRoot, dstRoot string) (string, error) {
 	// 拡張子を除去して新しいサフィックスを付与
 	ext := filepath.Ext(relPath)
 	baseNameWithoutExt := strings.TrimSuffix(relPath, ext) // 拡張子を除去
-	outputBaseName := baseNameWithoutExt + outputSuffix    // 新しいサフィックスを追加
+	outputBaseName := baseNameWithoutExt + suffix          // 新しいサフィックスを追加
 
 	// 最終的な出力フルパスを結合 (元のディレクトリ構造を維持)
 	return filepath.Join(dstRoot, outputBaseName), nil
@@ -56,7 +113,7 @@ func getOutputPath(inputFile, srcRoot, dstRoot string) (string, error) {
 // copyOtherFile: 動画以外のファイル (画像など) をコピーする関数
 // inputFile: コピー元ファイルのパス
 // outputFile: コピー先ファイルのパス
-func copyOtherFile(inputFile, outputFile string) error {
+func (r *run) copyOtherFile(inputFile, outputFile string) error {
 	// 入力ファイルの情報を取得 (パーミッション維持のため)
 	srcInfo, err := os.Stat(inputFile)
 	if err != nil {
@@ -67,9 +124,9 @@ func copyOtherFile(inputFile, outputFile string) error {
 	}
 
 	// 出力先にファイルが存在するかチェック
-	if fileExists(outputFile) {
+	if r.fileExists(outputFile) {
 		// 既に存在する場合はスキップログを出力して正常終了
-		// logger.Printf("スキップ (既存): %s", filepath.Base(outputFile)) // main 側でログを出すのでここでは不要かも
+		// r.logger.Printf("スキップ (既存): %s", filepath.Base(outputFile)) // 呼び出し側でログを出すのでここでは不要かも
 		return nil // 正常終了扱い
 	}
 	// Stat で IsNotExist 以外のエラーが出た場合は問題あり
@@ -85,8 +142,8 @@ func copyOtherFile(inputFile, outputFile string) error {
 	}
 
 	// コピー実行 (手動コピー関数を呼び出す)
-	// logger.Printf("コピー中: %s -> %s", filepath.Base(inputFile), filepath.Base(outputFile)) // main 側でログを出す
-	if err := copyFileManually(inputFile, outputFile); err != nil {
+	// r.logger.Printf("コピー中: %s -> %s", filepath.Base(inputFile), filepath.Base(outputFile)) // 呼び出し側でログを出す
+	if err := r.copyFileManually(inputFile, outputFile); err != nil {
 		// コピー失敗時は作成された可能性のある出力ファイルを削除試行
 		_ = os.Remove(outputFile)
 		return fmt.Errorf("ファイルコピー失敗 (%s -> %s): %w", inputFile, outputFile, err)
@@ -98,7 +155,7 @@ func copyOtherFile(inputFile, outputFile string) error {
 // copyFileManually: 低レベルなファイルコピー処理 (io.Copy を使用)
 // src: コピー元ファイルパス
 // dst: コピー先ファイルパス
-func copyFileManually(src, dst string) error {
+func (r *run) copyFileManually(src, dst string) error {
 	// コピー元のファイル情報を取得
 	sourceFileStat, err := os.Stat(src)
 	if err != nil {
@@ -130,7 +187,7 @@ func copyFileManually(src, dst string) error {
 		_ = os.Remove(dst)  // コピー失敗時は作成したファイルを削除試行
 		return fmt.Errorf("io.Copy エラー (%s -> %s): %w", src, dst, err)
 	}
-	debugLogPrintf("%d バイトコピー完了: %s -> %s", bytesCopied, filepath.Base(src), filepath.Base(dst))
+	r.debugf("%d バイトコピー完了: %s -> %s", bytesCopied, filepath.Base(src), filepath.Base(dst))
 
 	// コピー先ファイルのデータをディスクに書き込む (Sync)
 	// なくても動くことが多いが、信頼性を高めるため
@@ -158,44 +215,44 @@ func copyFileManually(src, dst string) error {
 // isQuickMode: Quick モードで実行されたか
 // renamedSourcePath: Quick モード時のリネーム後ソースパス (なければ空文字)
 // tempOutputPath: Temp モード時の一時出力パス (なければ空文字)
-func handleProcessingFailure(originalInputFile string, finalOutputFile string, result ffmpegResult, isQuickMode bool, renamedSourcePath string, tempOutputPath string) error {
+func (r *run) handleProcessingFailure(originalInputFile string, finalOutputFile string, result ffmpegResult, isQuickMode bool, renamedSourcePath string, tempOutputPath string) error {
 	// エラーログは呼び出し元 (processVideoFile) で出力済みなので、ここではクリーンアップ処理に専念
-	debugLogPrintf("失敗後処理開始: Original: %s, QuickMode: %t", originalInputFile, isQuickMode)
+	r.debugf("失敗後処理開始: Original: %s, QuickMode: %t", originalInputFile, isQuickMode)
 
 	if isQuickMode {
 		// === Quick モード失敗時 ===
 		// 1. リネームしたソースファイルを元に戻す試行
-		if renamedSourcePath != "" && fileExists(renamedSourcePath) {
-			debugLogPrintf("QuickMode失敗: ソースを元に戻します: %s -> %s", renamedSourcePath, originalInputFile)
+		if renamedSourcePath != "" && r.fileExists(renamedSourcePath) {
+			r.debugf("QuickMode失敗: ソースを元に戻します: %s -> %s", renamedSourcePath, originalInputFile)
 			if err := os.Rename(renamedSourcePath, originalInputFile); err != nil {
 				// リネームバック失敗は警告ログに留める
-				logger.Printf("警告 [Quick Mode]: ソースのリネームバック失敗 (%s -> %s): %v", renamedSourcePath, originalInputFile, err)
-				logger.Printf("  手動で '%s' を '%s' に戻してください。", renamedSourcePath, originalInputFile)
+				r.logger.Printf("警告 [Quick Mode]: ソースのリネームバック失敗 (%s -> %s): %v", renamedSourcePath, originalInputFile, err)
+				r.logger.Printf("  手動で '%s' を '%s' に戻してください。", renamedSourcePath, originalInputFile)
 			}
 		} else if renamedSourcePath != "" {
 			// リネーム後のファイルが見つからない場合 (通常ありえないはず)
-			debugLogPrintf("リネーム後のソースファイル '%s' が見つからないため、リネームバックはスキップします。", renamedSourcePath)
+			r.debugf("リネーム後のソースファイル '%s' が見つからないため、リネームバックはスキップします。", renamedSourcePath)
 		}
 
 		// 2. 不完全に生成された可能性のある出力ファイルを削除試行
-		if fileExists(finalOutputFile) {
-			debugLogPrintf("QuickMode失敗: 不完全な出力ファイルを削除試行: %s", finalOutputFile)
+		if r.fileExists(finalOutputFile) {
+			r.debugf("QuickMode失敗: 不完全な出力ファイルを削除試行: %s", finalOutputFile)
 			if err := os.Remove(finalOutputFile); err != nil {
-				logger.Printf("警告 [Quick Mode]: 不完全な出力ファイルの削除失敗 (%s): %v", finalOutputFile, err)
-				logger.Printf("  手動で '%s' を確認・削除してください。", finalOutputFile)
+				r.logger.Printf("警告 [Quick Mode]: 不完全な出力ファイルの削除失敗 (%s): %v", finalOutputFile, err)
+				r.logger.Printf("  手動で '%s' を確認・削除してください。", finalOutputFile)
 			}
 		}
 	} else {
 		// === Temp モード失敗時 ===
 		// 1. 一時ディレクトリにコピーした入力ファイルを削除試行 (tempDir ごと削除されるので不要かも)
 		// tempInputPath := filepath.Join(filepath.Dir(tempOutputPath), filepath.Base(originalInputFile)) // これでいいか要確認
-		// if fileExists(tempInputPath) { ... os.Remove ... }
+		// if r.fileExists(tempInputPath) { ... os.Remove ... }
 
 		// 2. 一時出力ファイルを削除試行
-		if tempOutputPath != "" && fileExists(tempOutputPath) {
-			debugLogPrintf("TempMode失敗: 一時出力ファイルを削除試行: %s", tempOutputPath)
+		if tempOutputPath != "" && r.fileExists(tempOutputPath) {
+			r.debugf("TempMode失敗: 一時出力ファイルを削除試行: %s", tempOutputPath)
 			if err := os.Remove(tempOutputPath); err != nil {
-				logger.Printf("警告 [Temp Mode]: 一時出力ファイルの削除失敗 (%s): %v", tempOutputPath, err)
+				r.logger.Printf("警告 [Temp Mode]: 一時出力ファイルの削除失敗 (%s): %v", tempOutputPath, err)
 			}
 		}
 		// Temp モードでは元の入力ファイル (originalInputFile) は変更されない
@@ -211,14 +268,14 @@ func handleProcessingFailure(originalInputFile string, finalOutputFile string, r
 }
 
 // fileExists: 指定されたパスがファイルとして存在するかどうかをチェック
-func fileExists(filename string) bool {
+func (r *run) fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false // 存在しない
 		}
 		// Stat で他のエラー (権限など) が発生した場合
-		logger.Printf("警告: ファイル状態確認エラー (%s): %v", filename, err)
+		r.logger.Printf("警告: ファイル状態確認エラー (%s): %v", filename, err)
 		return false // 存在するか不明な場合は false 扱い
 	}
 	// 存在し、かつディレクトリではない場合に true
@@ -228,12 +285,12 @@ func fileExists(filename string) bool {
 // createMarkerFile: 処理結果を示すマーカーファイルを作成する
 // markerPath: 作成するマーカーファイルのフルパス
 // content: マーカーファイルに書き込む内容 (エラー詳細など)
-func createMarkerFile(markerPath string, content string) {
-	debugLogPrintf("マーカーファイル作成試行: %s", markerPath)
+func (r *run) createMarkerFile(markerPath string, content string) {
+	r.debugf("マーカーファイル作成試行: %s", markerPath)
 	// マーカーファイル用のディレクトリが存在しない場合は作成
 	markerDir := filepath.Dir(markerPath)
 	if err := os.MkdirAll(markerDir, 0755); err != nil {
-		logger.Printf("警告: マーカー用ディレクトリ作成失敗 (%s): %v", markerDir, err)
+		r.logger.Printf("警告: マーカー用ディレクトリ作成失敗 (%s): %v", markerDir, err)
 		// ディレクトリが作れなくてもファイルの書き込みは試行する
 	}
 
@@ -246,21 +303,27 @@ func createMarkerFile(markerPath string, content string) {
 
 	// ファイルに内容を書き込む (既存ファイルは上書き)
 	if err := os.WriteFile(markerPath, []byte(fileContent), 0644); err != nil {
-		logger.Printf("警告: マーカーファイル書き込み失敗 (%s): %v", markerPath, err)
+		r.logger.Printf("警告: マーカーファイル書き込み失敗 (%s): %v", markerPath, err)
 	} else {
-		debugLogPrintf("マーカーファイル作成成功: %s", markerPath)
+		r.debugf("マーカーファイル作成成功: %s", markerPath)
 	}
 }
 
 // removeRestartFiles: -restart オプション実行時に、出力ディレクトリ内の不要ファイルを削除する
+// ジャーナルがある場合はジャーナル上の失敗・中断レコードを対象とし、
+// ジャーナル導入前の出力先ではディレクトリを走査してマーカーファイルを探す
 // dir: 対象の出力ディレクトリパス
-func removeRestartFiles(dir string) error {
-	logger.Printf("-Restart: ディレクトリ '%s' 内のエラーマーカーと0バイト動画ファイルを削除します...", dir)
+// 戻り値: 未処理に戻した動画、または削除したファイルの件数
+func (r *run) removeRestartFiles(dir string) (int, error) {
+	if r.journal.hasHistory() {
+		return r.restartFromJournal(), nil
+	}
+	r.logger.Printf("-Restart: ディレクトリ '%s' 内のエラーマーカーと0バイト動画ファイルを削除します...", dir)
 	filesRemoved := 0
 	walkErr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			// ディレクトリ走査中にエラーが発生した場合
-			logger.Printf("警告: ディレクトリ '%s' 走査エラー: %v。スキップします。", path, err)
+			r.logger.Printf("警告: ディレクトリ '%s' 走査エラー: %v。スキップします。", path, err)
 			// エラーが発生したのがディレクトリなら、その中身は処理しない
 			if d != nil && d.IsDir() {
 				return filepath.SkipDir
@@ -276,31 +339,28 @@ func removeRestartFiles(dir string) error {
 		fileNameLower := strings.ToLower(d.Name())
 
 		// 1. マーカーファイルの削除チェック
-		for _, markerSuffix := range failedMarkersToDelete {
-			// failed_ もチェックするため HasPrefix を使う
-			if strings.HasSuffix(fileNameLower, markerSuffix) || (markerSuffix == ".failed_" && strings.Contains(fileNameLower, ".failed_")) {
-				debugLogPrintf("-Restart: マーカーファイル削除: %s", path)
-				if err := os.Remove(path); err != nil {
-					logger.Printf("警告: マーカーファイル削除失敗 (%s): %v", path, err)
-				} else {
-					filesRemoved++
-				}
-				return nil // マーカーファイルならここで処理終了
+		if isFailedMarkerName(fileNameLower) {
+			r.debugf("-Restart: マーカーファイル削除: %s", path)
+			if err := os.Remove(path); err != nil {
+				r.logger.Printf("警告: マーカーファイル削除失敗 (%s): %v", path, err)
+			} else {
+				filesRemoved++
 			}
+			return nil // マーカーファイルならここで処理終了
 		}
 
 		// 2. 0バイト動画ファイルの削除チェック
-		ext := strings.ToLower(filepath.Ext(fileNameLower))
-		if _, isVideo := videoExtensions[ext]; isVideo { // 動画拡張子かチェック
+		// (出力は -container により .mp4 以外の拡張子にもなるため、出力名のファイルも対象とする)
+		if IsVideoFile(fileNameLower) || isOutputName(fileNameLower) { // 動画拡張子かチェック
 			info, infoErr := d.Info() // fs.DirEntry からファイル情報を取得
 			if infoErr != nil {
-				logger.Printf("警告: ファイル情報取得エラー (%s): %v。スキップします。", path, infoErr)
+				r.logger.Printf("警告: ファイル情報取得エラー (%s): %v。スキップします。", path, infoErr)
 				return nil
 			}
 			if info.Size() == 0 { // ファイルサイズが0かチェック
-				debugLogPrintf("-Restart: 0バイト動画ファイル削除: %s", path)
+				r.debugf("-Restart: 0バイト動画ファイル削除: %s", path)
 				if err := os.Remove(path); err != nil {
-					logger.Printf("警告: 0バイト動画ファイル削除失敗 (%s): %v", path, err)
+					r.logger.Printf("警告: 0バイト動画ファイル削除失敗 (%s): %v", path, err)
 				} else {
 					filesRemoved++
 				}
@@ -312,14 +372,69 @@ func removeRestartFiles(dir string) error {
 
 	if walkErr != nil {
 		// WalkDir 自体のエラー
-		return fmt.Errorf("-Restart 処理中に予期せぬエラー: %w", walkErr)
+		return filesRemoved, fmt.Errorf("-Restart 処理中に予期せぬエラー: %w", walkErr)
 	}
-	logger.Printf("-Restart: %d 個のマーカーファイルまたは0バイト動画ファイルを削除しました。", filesRemoved)
-	return nil
+	r.logger.Printf("-Restart: %d 個のマーカーファイルまたは0バイト動画ファイルを削除しました。", filesRemoved)
+	return filesRemoved, nil
+}
+
+// isFailedMarkerName: ファイル名 (小文字) が -restart で削除する失敗マーカーかどうかを判定する
+func isFailedMarkerName(fileNameLower string) bool {
+	for _, markerSuffix := range failedMarkersToDelete {
+		// .failed_NN は末尾が数字になるため、.failed_ は途中に含まれるかで判定する
+		if strings.HasSuffix(fileNameLower, markerSuffix) || (markerSuffix == ".failed_" && strings.Contains(fileNameLower, ".failed_")) {
+			return true
+		}
+	}
+	return false
+}
+
+// restartFromJournal: ジャーナル上の失敗・タイムアウト・中断レコードと、出力が欠けた完了レコードを未処理に戻す
+// 記録されている失敗マーカーと不完全な出力ファイルも削除する
+// 戻り値: 未処理に戻した件数
+func (r *run) restartFromJournal() int {
+	r.logger.Println("-Restart: ジャーナルを参照して、失敗・中断した動画を未処理に戻します...")
+	resetCount := 0
+	removeIfExists := func(path, kind string) {
+		if !r.fileExists(path) {
+			return
+		}
+		r.debugf("-Restart: %s削除: %s", kind, path)
+		if err := os.Remove(path); err != nil {
+			r.logger.Printf("警告: %s削除失敗 (%s): %v", kind, path, err)
+		}
+	}
+
+	// 1. 失敗・タイムアウト・中断 (エンコード中のまま) のレコード
+	for _, e := range r.journal.entriesInState(stateFailed, stateTimeout, stateEncoding) {
+		outputPath := r.journal.outputPath(e)
+		if e.Marker != "" {
+			removeIfExists(outputPath+e.Marker, "マーカーファイル")
+		}
+		removeIfExists(outputPath, "不完全な出力ファイル")
+		r.journal.resetEntry(e, "-restart")
+		resetCount++
+	}
+
+	// 2. 完了しているが出力が存在しない・サイズ 0 のレコード
+	for _, e := range r.journal.entriesInState(stateDone) {
+		outputPath := r.journal.outputPath(e)
+		info, err := os.Stat(outputPath)
+		if err == nil && info.Size() > 0 {
+			continue
+		}
+		if err == nil {
+			removeIfExists(outputPath, "0バイト動画ファイル")
+		}
+		r.journal.resetEntry(e, "-restart (出力なし)")
+		resetCount++
+	}
+	r.logger.Printf("-Restart: %d 件の動画を未処理に戻しました。", resetCount)
+	return resetCount
 }
 
-// getVideoExtList: サポートする動画拡張子のリストを文字列で返す (Usage 表示用)
-func getVideoExtList() string {
+// VideoExtList: サポートする動画拡張子のリストを文字列で返す (Usage 表示用)
+func VideoExtList() string {
 	keys := make([]string, 0, len(videoExtensions))
 	for k := range videoExtensions {
 		keys = append(keys, k)
@@ -328,8 +443,8 @@ func getVideoExtList() string {
 	return strings.Join(keys, ", ")
 }
 
-// getImageExtList: コピー対象の画像拡張子のリストを文字列で返す (Usage 表示用)
-func getImageExtList() string {
+// ImageExtList: コピー対象の画像拡張子のリストを文字列で返す (Usage 表示用)
+func ImageExtList() string {
 	keys := make([]string, 0, len(imageExtensions))
 	for k := range imageExtensions {
 		keys = append(keys, k)
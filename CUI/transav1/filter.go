@@ -0,0 +1,141 @@
+package transav1
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// --- 入力元の走査対象の絞り込み (Config.Include / Config.Exclude) ---
+// パターンは入力元ルートからの相対パス (スラッシュ区切り) と比較するグロブ (path.Match の書式) で、
+// 大文字小文字は区別しない。
+//   - 「/」を含まないパターンは、パスのいずれかの階層の名前と比較する (例: "*.part", "@eaDir")
+//   - 「/」を含むパターンは、パスの先頭からパターンと同じ階層数の部分と比較する
+//     (例: "tv/*/extras" はそのディレクトリと配下の全てに一致する)
+
+// DefaultExcludes: 既定で除外する、OS やアプリケーションが作成するファイル・ディレクトリと書きかけのダウンロード
+// (Config.NoDefaultExcludes で無効にできる)
+var DefaultExcludes = []string{
+	"Thumbs.db", "ehthumbs.db", "desktop.ini", // Windows
+	"$RECYCLE.BIN", "System Volume Information",
+	".DS_Store", "._*", ".Spotlight-V100", ".Trashes", ".fseventsd", // macOS
+	"@eaDir", "#recycle", // Synology NAS
+	"*.part", "*.partial", "*.crdownload", "*.download", "*.!ut", "*.!qB", // 書きかけのダウンロード
+}
+
+// pathFilter: 入力元の走査で処理対象とするファイルを選ぶ
+type pathFilter struct {
+	include []string // 空でなければ、いずれかに一致するファイルのみを対象とする
+	exclude []string // いずれかに一致するファイル・ディレクトリを除外する (DefaultExcludes を含む)
+}
+
+// newPathFilter: 設定のパターンを検証して pathFilter を作成する
+func newPathFilter(cfg Config) (*pathFilter, error) {
+	f := &pathFilter{}
+	for _, p := range cfg.Include {
+		if err := ValidatePattern(p); err != nil {
+			return nil, fmt.Errorf("対象パターン (include): %w", err)
+		}
+		f.include = append(f.include, normalizePattern(p))
+	}
+	exclude := cfg.Exclude
+	if !cfg.NoDefaultExcludes {
+		exclude = append(append([]string(nil), DefaultExcludes...), exclude...)
+	}
+	for _, p := range exclude {
+		if err := ValidatePattern(p); err != nil {
+			return nil, fmt.Errorf("除外パターン (exclude): %w", err)
+		}
+		f.exclude = append(f.exclude, normalizePattern(p))
+	}
+	return f, nil
+}
+
+// ValidatePattern: 対象・除外パターン (Config.Include / Exclude) の書式を検証する
+func ValidatePattern(pattern string) error {
+	if normalizePattern(pattern) == "" {
+		return fmt.Errorf("空のパターンは指定できません")
+	}
+	if _, err := path.Match(normalizePattern(pattern), ""); err != nil {
+		return fmt.Errorf("パターン '%s' の書式が正しくありません: %w", pattern, err)
+	}
+	return nil
+}
+
+// normalizePattern: パターンを比較用の形式 (小文字、スラッシュ区切り、先頭・末尾のスラッシュなし) にする
+func normalizePattern(pattern string) string {
+	return strings.Trim(strings.ToLower(filepath.ToSlash(strings.TrimSpace(pattern))), "/")
+}
+
+// matchPattern: 相対パス (小文字、スラッシュ区切り) がパターンに一致するか判定する
+func matchPattern(pattern, relPath string) bool {
+	elems := strings.Split(relPath, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, elem := range elems {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+	n := strings.Count(pattern, "/") + 1
+	if len(elems) < n {
+		return false
+	}
+	ok, _ := path.Match(pattern, strings.Join(elems[:n], "/"))
+	return ok
+}
+
+// excluded: 入力元の走査で見つかったファイル・ディレクトリを対象外とするか判定する
+// ディレクトリは除外パターンのみで判定し (除外した場合は配下ごと走査しない)、ファイルは対象パターンも適用する
+func (f *pathFilter) excluded(srcRoot, p string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	relPath, err := filepath.Rel(srcRoot, p)
+	if err != nil || relPath == "." {
+		return false // 入力元ルート自体は除外しない
+	}
+	relPath = strings.ToLower(filepath.ToSlash(relPath))
+	for _, pattern := range f.exclude {
+		if matchPattern(pattern, relPath) {
+			return true
+		}
+	}
+	if isDir || len(f.include) == 0 {
+		return false
+	}
+	for _, pattern := range f.include {
+		if matchPattern(pattern, relPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadPatternFile: 除外パターンなどを1行に1つずつ記述したファイルを読み込む
+// 空行と「#」で始まる行は無視する
+func ReadPatternFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("パターンファイル '%s' を開けません: %w", name, err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("パターンファイル '%s' の読み込みエラー: %w", name, err)
+	}
+	return patterns, nil
+}
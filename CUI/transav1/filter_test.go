@@ -0,0 +1,90 @@
+package transav1
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		// 「/」を含まないパターンは、いずれかの階層の名前と比較する
+		{"*.part", "movie.mkv.part", true},
+		{"*.part", "tv/show/ep01.mkv.part", true},
+		{"*.part", "movie.partial", false},
+		{"@eadir", "photos/@eadir/thumb.jpg", true},
+		{"@eadir", "photos/@eadir", true},
+		{"._*", "tv/._ep01.mkv", true},
+		{"._*", "tv/ep._01.mkv", false},
+		{"extras", "movies/extras.mkv", false},
+		// 「/」を含むパターンは、先頭から同じ階層数の部分と比較する
+		{"tv/*/extras", "tv/show/extras", true},
+		{"tv/*/extras", "tv/show/extras/clip.mkv", true},
+		{"tv/*/extras", "tv/show/season1/extras", false},
+		{"tv/*/extras", "anime/tv/show/extras", false},
+		{"tv/*/extras", "tv/show", false},
+		{"movies/*.iso", "movies/film.iso", true},
+		{"movies/*.iso", "movies/box/film.iso", false},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.relPath); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestPathFilterExcluded(t *testing.T) {
+	tests := []struct {
+		name      string
+		include   []string
+		exclude   []string
+		noDefault bool
+		path      string
+		isDir     bool
+		want      bool
+	}{
+		{name: "既定の除外 (ファイル)", path: "Thumbs.db", want: true},
+		{name: "既定の除外 (大文字小文字を区別しない)", path: "sub/THUMBS.DB", want: true},
+		{name: "既定の除外 (ディレクトリ)", path: "@eaDir", isDir: true, want: true},
+		{name: "書きかけのダウンロード", path: "dl/movie.mkv.crdownload", want: true},
+		{name: "既定の除外を無効化", noDefault: true, path: "Thumbs.db", want: false},
+		{name: "除外されない動画", path: "tv/ep01.mkv", want: false},
+		{name: "指定した除外", exclude: []string{"Samples"}, path: "movie/samples/s.mkv", want: true},
+		{name: "パターンの先頭・末尾のスラッシュ", exclude: []string{"/TV/Show/"}, path: "tv/show/ep01.mkv", want: true},
+		{name: "対象パターンに一致", include: []string{"*.mkv"}, path: "tv/ep01.MKV", want: false},
+		{name: "対象パターンに不一致", include: []string{"*.mkv"}, path: "tv/ep01.mp4", want: true},
+		{name: "ディレクトリには対象パターンを適用しない", include: []string{"*.mkv"}, path: "tv", isDir: true, want: false},
+		{name: "除外は対象パターンより優先", include: []string{"*.mkv"}, exclude: []string{"tv/old"}, path: "tv/old/ep01.mkv", want: true},
+		{name: "入力元ルート自体は除外しない", exclude: []string{"*"}, path: ".", isDir: true, want: false},
+	}
+	srcRoot := filepath.Join("src", "root")
+	for _, tt := range tests {
+		f, err := newPathFilter(Config{Include: tt.include, Exclude: tt.exclude, NoDefaultExcludes: tt.noDefault})
+		if err != nil {
+			t.Fatalf("%s: newPathFilter: %v", tt.name, err)
+		}
+		if got := f.excluded(srcRoot, filepath.Join(srcRoot, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+			t.Errorf("%s: excluded(%q) = %v, want %v", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "*.part"},
+		{pattern: "tv/*/extras"},
+		{pattern: "[abc].mkv"},
+		{pattern: " / ", wantErr: true},
+		{pattern: "[abc.mkv", wantErr: true},
+	} {
+		if err := ValidatePattern(tt.pattern); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePattern(%q) = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package transav1
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ExitInterrupted: 中断 (Ctrl+C / SIGTERM) で終了した場合の終了コード
+const ExitInterrupted = 130
+
+// ErrInterrupted: 中断要求 (ctx の取り消し) により処理を取りやめたことを示すエラー
+var ErrInterrupted = errors.New("中断要求により処理を中止しました")
+
+// interrupted: 中断要求を受信済みかどうか
+func (r *run) interrupted() bool {
+	return r.ctx.Err() != nil
+}
+
+// rollbackInterruptedJob: 中断されたジョブの作業状態を直ちに元に戻す
+// (QuickMode のソースを元の名前に戻し、不完全な出力・ジョブ用一時ディレクトリ・.origin マーカーを削除する)
+// ソースを元に戻せた場合はジャーナルを pending に戻し、戻せなかった場合は次回起動時の回復処理に任せる
+func (r *run) rollbackInterruptedJob(job *videoJob) {
+	if !job.prepared {
+		return
+	}
+	r.logger.Printf("中断: 作業状態を元に戻します: %s", filepath.Base(job.inputFile))
+	_ = r.handleProcessingFailure(job.inputFile, job.outputFile, ffmpegResult{err: ErrInterrupted}, r.cfg.QuickMode, job.renamedSourcePath, job.tempOutputPath)
+	r.cleanupVideoJob(job)
+	job.prepared = false
+	r.summary.add(summaryInterrupted, job.inputFile)
+
+	if r.cfg.QuickMode && !r.fileExists(job.inputFile) {
+		r.logger.Printf("警告 [Quick Mode]: ソースを元に戻せませんでした。次回起動時に回復処理が行われます: %s", job.renamedSourcePath)
+		return
+	}
+	if job.quickModeOriginMarker != "" {
+		_ = os.Remove(job.quickModeOriginMarker)
+	}
+	r.journal.resetEntry(journalEntry{Source: job.inputFile, Output: job.outputFile}, "中断によりロールバック")
+}
@@ -0,0 +1,283 @@
+package transav1
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// journalFileName: 出力先ルートに作成するジョブジャーナルのファイル名
+const journalFileName = "GoTransAV1_Journal.jsonl"
+
+// jobState: ジャーナルに記録する動画ごとの状態
+type jobState string
+
+const (
+	statePending  jobState = "pending"  // 未処理 (-restart や回復処理でリセットされた)
+	stateEncoding jobState = "encoding" // エンコード中 (この状態のまま残っていれば中断された)
+	stateDone     jobState = "done"     // 変換完了
+	stateFailed   jobState = "failed"   // 変換失敗
+	stateTimeout  jobState = "timeout"  // タイムアウト
+	stateSkipped  jobState = "skipped"  // 出力を作成せずにスキップした (AV1 ソースなど)
+)
+
+// journalEntry: ジャーナルの1レコード (1行の JSON)
+// 同じ Source のレコードは後に書かれたものが最新の状態となる
+type journalEntry struct {
+	Time       time.Time `json:"time"`                  // 記録時刻
+	Source     string    `json:"source"`                // 入力元ルートからの相対パス (スラッシュ区切り)
+	Output     string    `json:"output"`                // 出力先ルートからの相対パス (スラッシュ区切り)
+	State      jobState  `json:"state"`                 // 状態
+	QuickMode  bool      `json:"quick_mode,omitempty"`  // QuickMode で処理されたか (回復処理の対象判定)
+	Encoder    string    `json:"encoder,omitempty"`     // 使用したエンコーダ
+	Options    string    `json:"options,omitempty"`     // 使用したエンコーダオプション
+	Attempts   int       `json:"attempts,omitempty"`    // ffmpeg の実行回数
+	ExitCode   *int      `json:"exit_code,omitempty"`   // ffmpeg の終了コード (失敗時)
+	Marker     string    `json:"marker,omitempty"`      // 作成した失敗マーカーのサフィックス (例: ".failed_1")
+	Error      string    `json:"error,omitempty"`       // エラー内容 (失敗時)
+	StartedAt  time.Time `json:"started_at,omitzero"`   // 処理開始時刻
+	ElapsedSec float64   `json:"elapsed_sec,omitempty"` // 処理時間 (秒)
+	InputSize  int64     `json:"input_size,omitempty"`  // 入力ファイルサイズ (バイト)
+	OutputSize int64     `json:"output_size,omitempty"` // 出力ファイルサイズ (バイト)
+	Note       string    `json:"note,omitempty"`        // 補足 (リセット理由など)
+}
+
+// runJournal: 出力先ルートの追記型ジャーナルファイル
+// 複数のエンコードワーカーから同時に呼び出される
+type runJournal struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	srcRoot    string                   // 入力元ルート (相対パスの基準)
+	dstRoot    string                   // 出力先ルート (相対パスの基準)
+	entries    map[string]*journalEntry // Source ごとの最新レコード
+	hadHistory bool                     // 起動時に既存のジャーナルが存在したか
+	logger     *log.Logger
+}
+
+// openJournal: ジャーナルを読み込み、追記用に開く
+// srcRoot: 入力元ルート (単一ファイルモードではファイルの親ディレクトリ)
+// dstRoot: 出力先ルート (ジャーナルの作成場所)
+// logger: 読み込み・書き込みの警告の出力先
+// create: ジャーナルがない場合に作成するか (false の場合、既存のジャーナルがなければ記録はメモリ上のみ)
+func openJournal(srcRoot, dstRoot string, logger *log.Logger, create bool) (*runJournal, error) {
+	j := &runJournal{
+		logger:  logger,
+		path:    filepath.Join(dstRoot, journalFileName),
+		srcRoot: srcRoot,
+		dstRoot: dstRoot,
+		entries: make(map[string]*journalEntry),
+	}
+
+	// --- 既存ジャーナルの読み込み ---
+	if f, err := os.Open(j.path); err == nil {
+		j.hadHistory = true
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var e journalEntry
+			if err := json.Unmarshal(line, &e); err != nil || e.Source == "" {
+				// 中断時の書きかけの行などは無視する
+				j.logger.Printf("警告 [ジャーナル]: %s の %d 行目を読み込めません。無視します: %v", journalFileName, lineNo, err)
+				continue
+			}
+			entry := e
+			j.entries[e.Source] = &entry
+		}
+		scanErr := scanner.Err()
+		f.Close()
+		if scanErr != nil {
+			return nil, fmt.Errorf("ジャーナル '%s' の読み込みエラー: %w", j.path, scanErr)
+		}
+		j.logger.Printf("ジャーナル読み込み: %s (%d 件)", j.path, len(j.entries))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("ジャーナル '%s' を開けません: %w", j.path, err)
+	}
+
+	// --- 追記用に開く ---
+	// (保守処理でジャーナル導入前の出力先に空のジャーナルを作ると、次回以降マーカーファイルが走査されなくなる)
+	if !j.hadHistory && !create {
+		return j, nil
+	}
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ジャーナル '%s' を作成できません: %w", j.path, err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// close: ジャーナルファイルを閉じる
+func (j *runJournal) close() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+// hasHistory: 起動時に既存のジャーナルがあったか (ない場合は旧形式のマーカーファイルを走査する)
+func (j *runJournal) hasHistory() bool {
+	return j != nil && j.hadHistory
+}
+
+// key: 入力ファイルのフルパスからジャーナルのキー (相対パス) を求める
+func (j *runJournal) key(inputFile string) string {
+	rel, err := filepath.Rel(j.srcRoot, inputFile)
+	if err != nil {
+		return filepath.ToSlash(inputFile)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// outputKey: 出力ファイルのフルパスから出力先ルートからの相対パスを求める
+func (j *runJournal) outputKey(outputFile string) string {
+	rel, err := filepath.Rel(j.dstRoot, outputFile)
+	if err != nil {
+		return filepath.ToSlash(outputFile)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sourcePath: ジャーナルのキーから入力ファイルのフルパスを求める
+func (j *runJournal) sourcePath(e journalEntry) string {
+	return filepath.Join(j.srcRoot, filepath.FromSlash(e.Source))
+}
+
+// outputPath: ジャーナルのレコードから出力ファイルのフルパスを求める
+func (j *runJournal) outputPath(e journalEntry) string {
+	return filepath.Join(j.dstRoot, filepath.FromSlash(e.Output))
+}
+
+// lookup: 入力ファイルの最新レコードを返す
+func (j *runJournal) lookup(inputFile string) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[j.key(inputFile)]
+	if !ok {
+		return journalEntry{}, false
+	}
+	return *e, true
+}
+
+// entriesInState: 指定状態のいずれかにある最新レコードを Source 順で返す
+func (j *runJournal) entriesInState(states ...jobState) []journalEntry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var list []journalEntry
+	for _, e := range j.entries {
+		for _, s := range states {
+			if e.State == s {
+				list = append(list, *e)
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Source < list[b].Source })
+	return list
+}
+
+// outputsFor: 入力元のディレクトリ srcDir に対応する出力先のディレクトリへの出力を記録した最新レコードを返す
+// (以前の実行で決まった出力名を変えないため, collision.go)
+func (j *runJournal) outputsFor(srcDir string) []journalEntry {
+	if j == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(j.srcRoot, srcDir)
+	if err != nil {
+		return nil
+	}
+	outDir := filepath.ToSlash(rel)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var list []journalEntry
+	for _, e := range j.entries {
+		if e.Output != "" && path.Dir(e.Output) == outDir {
+			list = append(list, *e)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Source < list[b].Source })
+	return list
+}
+
+// outputOwner: 出力ファイルを完了した出力として記録している、inputFile 以外の入力の最新レコードを返す
+func (j *runJournal) outputOwner(outputFile, inputFile string) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+	output, source := j.outputKey(outputFile), j.key(inputFile)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.Output == output && e.Source != source && e.State == stateDone {
+			return *e, true
+		}
+	}
+	return journalEntry{}, false
+}
+
+// record: レコードを追記する (Source/Output はフルパスで渡してもよい)
+// QuickMode の回復に使われるため、書き込みごとにディスクへ同期する
+func (j *runJournal) record(e journalEntry) {
+	if j == nil {
+		return
+	}
+	if filepath.IsAbs(e.Source) {
+		e.Source = j.key(e.Source)
+	}
+	if filepath.IsAbs(e.Output) {
+		e.Output = j.outputKey(e.Output)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		j.logger.Printf("警告 [ジャーナル]: レコードの変換に失敗 (%s): %v", e.Source, err)
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := e
+	j.entries[e.Source] = &entry
+	if j.file == nil {
+		return
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		j.logger.Printf("警告 [ジャーナル]: 書き込み失敗 (%s): %v", j.path, err)
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		j.logger.Printf("警告 [ジャーナル]: 同期失敗 (%s): %v", j.path, err)
+	}
+}
+
+// resetEntry: レコードを pending に戻す (-restart や回復処理用)
+func (j *runJournal) resetEntry(e journalEntry, note string) {
+	j.record(journalEntry{Source: e.Source, Output: e.Output, State: statePending, Note: note})
+}
@@ -0,0 +1,263 @@
+package transav1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// --- 変換を伴わない保守処理 (検証・クリーンアップ・回復) ---
+// 変換 (ConvertTree) の開始時に暗黙に行われる処理を、変換を開始せずに単独で実行する。
+// いずれもジャーナルのない出力先 (ジャーナル導入前の出力など) にジャーナルを新たに作成しない。
+
+// newMaintenanceConverter: ffmpeg を使用しない保守処理用に、ログ出力先と走査対象の絞り込み・分類・出力名 (衝突の扱いとコンテナ) だけを設定した Converter を作成する
+// (エンコーダなどの変換設定は検証しない)
+func newMaintenanceConverter(cfg Config) (*Converter, error) {
+	filter, err := newPathFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := newClassifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Collision == "" {
+		cfg.Collision = DefaultCollision
+	}
+	if cfg.Collision, err = ParseCollisionPolicy(string(cfg.Collision)); err != nil {
+		return nil, err
+	}
+	if cfg.Container == "" {
+		cfg.Container = DefaultContainer
+	}
+	if cfg.Container, err = ParseContainer(string(cfg.Container)); err != nil {
+		return nil, err
+	}
+	c := &Converter{cfg: cfg, filter: filter, classes: classes, logger: cfg.Logger, debugLogger: cfg.DebugLogger}
+	if c.logger == nil {
+		c.logger = log.New(io.Discard, "", 0)
+	}
+	return c, nil
+}
+
+// requireDir: 保守処理の対象ディレクトリが存在することを確認する
+func requireDir(dir, label string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s '%s' の情報取得に失敗: %w", label, dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s '%s' はディレクトリではありません", label, dir)
+	}
+	return nil
+}
+
+// maintenanceReport: 保守処理の実行結果を作成する
+func (r *run) maintenanceReport(succeeded, skipped, failed int) *Report {
+	return &Report{
+		Succeeded: succeeded, Skipped: skipped, Failed: failed,
+		Errors:      r.errors.list(),
+		Summary:     r.summary.snapshot(),
+		Interrupted: r.interrupted(),
+		Elapsed:     time.Since(r.startTime),
+	}
+}
+
+// RecoverTree: QuickMode で中断された動画を回復する (ConvertTree の開始時と同じ処理, ffmpeg は使用しない)
+// 入力元の「.processing」を元の名前に戻し、不完全な出力を削除して未処理に戻す。
+// Report.Succeeded は回復した件数、Report.Failed は手動での確認が必要な件数。
+func RecoverTree(ctx context.Context, cfg Config, srcDir, dstDir string) (*Report, error) {
+	c, err := newMaintenanceConverter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDir(srcDir, "入力元"); err != nil {
+		return nil, err
+	}
+	if err := requireDir(dstDir, "出力先"); err != nil {
+		return nil, err
+	}
+	r, err := c.openRun(ctx, srcDir, dstDir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	recovered, failed := r.recoverQuickModeFiles(srcDir, dstDir)
+	if failed > 0 {
+		r.errors.add(fmt.Sprintf("QuickMode 回復処理で %d 件の動画を回復できませんでした (手動での確認が必要です)", failed))
+	}
+	return r.maintenanceReport(recovered, 0, failed), nil
+}
+
+// CleanTree: 出力先の失敗マーカーと不完全な出力を削除し、失敗・中断した動画を未処理に戻す
+// (Config.Restart 指定時に ConvertTree の開始時に行う処理と同じ, ffmpeg は使用しない)
+// Report.Succeeded は未処理に戻した動画 (ジャーナル導入前の出力先では削除したファイル) の件数。
+func CleanTree(ctx context.Context, cfg Config, dstDir string) (*Report, error) {
+	c, err := newMaintenanceConverter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDir(dstDir, "出力先"); err != nil {
+		return nil, err
+	}
+	// ジャーナル上の入力元は参照しないため、入力元ルートは指定しない
+	r, err := c.openRun(ctx, "", dstDir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	count, err := r.removeRestartFiles(dstDir)
+	if err != nil {
+		return nil, err
+	}
+	return r.maintenanceReport(count, 0, 0), nil
+}
+
+// verifyTarget: 出力の検証 (VerifyTree) の対象
+type verifyTarget struct {
+	source string // 入力ファイルのフルパス
+	output string // 出力ファイルのフルパス
+	remux  bool   // 再多重化 (AV1 ソース) の出力か (全ての映像・音声ストリームが含まれるべき)
+}
+
+// errNotVerifiable: 入力が見つからない・解析できないなどの理由で、出力と比較できないことを示すエラー
+var errNotVerifiable = errors.New("入力と比較できません")
+
+// VerifyTree: 変換済みの出力を入力と比較して検証する (Config.Verify の方法で行う, VerifyNone は指定できない)
+// ジャーナルがある場合は完了レコードのうちエンコード・再多重化した出力を、
+// ない場合は入力元の各動画に対応する出力パスに存在する出力を対象とする。
+// 検証に失敗した出力には「出力ファイル名.verify_failed」マーカーを作成し、ジャーナル上は失敗として記録する
+// (次回の変換、または CleanTree で再変換の対象に戻る)。
+// Report.Succeeded は検証に成功した件数、Report.Skipped は入力と比較できなかった件数。
+func (c *Converter) VerifyTree(ctx context.Context, srcDir, dstDir string) (*Report, error) {
+	if c.cfg.Verify == VerifyNone {
+		return nil, fmt.Errorf("検証方法に %s は指定できません", VerifyNone)
+	}
+	if c.cfg.FFprobePath == "" {
+		return nil, errors.New("出力の検証には ffprobe が必要です")
+	}
+	if err := requireDir(srcDir, "入力元"); err != nil {
+		return nil, err
+	}
+	if err := requireDir(dstDir, "出力先"); err != nil {
+		return nil, err
+	}
+	r, err := c.openRun(ctx, srcDir, dstDir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	targets, err := r.verifyTargets(srcDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Printf("--- 出力の検証開始 (%d 件, 方法: %s) ---", len(targets), c.cfg.Verify)
+	var succeeded, skipped, failed int
+	for i, t := range targets {
+		if r.interrupted() {
+			c.logger.Printf("中断: 残り %d 件の検証を取りやめます。", len(targets)-i)
+			break
+		}
+		label := fmt.Sprintf("(%d/%d): %s", i+1, len(targets), r.journal.outputKey(t.output))
+		err := r.verifyExisting(t)
+		switch {
+		case err == nil:
+			c.logger.Printf("検証 OK %s", label)
+			succeeded++
+		case r.interrupted():
+			// 中断による ffprobe/ffmpeg の停止は検証失敗として扱わない
+		case errors.Is(err, errNotVerifiable):
+			c.logger.Printf("警告: 検証スキップ %s: %v", label, err)
+			skipped++
+		default:
+			c.logger.Printf("エラー: 検証失敗 %s: %v", label, err)
+			r.createMarkerFile(t.output+VerifySuffix, fmt.Sprintf("Verify (検証コマンド), Error: %v", err))
+			r.journal.record(journalEntry{Source: t.source, Output: t.output, State: stateFailed, Marker: VerifySuffix, Error: err.Error(), Note: "検証コマンドで検証失敗"})
+			r.errors.add(fmt.Sprintf("出力の検証失敗 (%s): %v", r.journal.outputKey(t.output), err))
+			failed++
+		}
+	}
+	c.logger.Printf("--- 出力の検証終了 (OK: %d件, 失敗: %d件, スキップ: %d件) ---", succeeded, failed, skipped)
+	return r.maintenanceReport(succeeded, skipped, failed), nil
+}
+
+// verifyTargets: 検証の対象となる出力を列挙する
+func (r *run) verifyTargets(srcDir, dstDir string) ([]verifyTarget, error) {
+	var targets []verifyTarget
+	if r.journal.hasHistory() {
+		for _, e := range r.journal.entriesInState(stateDone) {
+			// 元のファイルのコピー (AV1 ソースのコピー、-larger original) は入力と同じ名前で出力されるため対象外
+			if path.Base(e.Output) == path.Base(e.Source) {
+				continue
+			}
+			targets = append(targets, verifyTarget{source: r.journal.sourcePath(e), output: r.journal.outputPath(e), remux: e.Encoder == "copy"})
+		}
+		return targets, nil
+	}
+
+	// --- ジャーナル導入前の出力先: 入力元を走査して、通常の出力パスに存在する出力を対象とする ---
+	walkErr := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			r.logger.Printf("警告: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", p, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if r.interrupted() {
+			return filepath.SkipAll
+		}
+		if r.isNestedDst(p, d) {
+			return filepath.SkipDir
+		}
+		if r.filter.excluded(srcDir, p, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || r.classify(p) != ClassEncode {
+			return nil
+		}
+		outputPath, err := r.outputPath(p, srcDir, dstDir)
+		if err != nil {
+			return nil
+		}
+		outputPath = r.existingOutput(outputPath)
+		if info, err := os.Stat(outputPath); err == nil && info.Size() > 0 {
+			targets = append(targets, verifyTarget{source: p, output: outputPath})
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("入力元の走査中に予期せぬエラーが発生: %w", walkErr)
+	}
+	return targets, nil
+}
+
+// verifyExisting: 変換済みの出力を入力と比較して検証する
+// 入力が見つからない・解析できない場合は errNotVerifiable を返す
+func (r *run) verifyExisting(t verifyTarget) error {
+	if _, err := os.Stat(t.output); err != nil {
+		return fmt.Errorf("出力ファイルが見つかりません: %w", err)
+	}
+	if _, err := os.Stat(t.source); err != nil {
+		return fmt.Errorf("%w (入力ファイルが見つかりません: %v)", errNotVerifiable, err)
+	}
+	src, err := r.probeMedia(r.ctx, t.source)
+	if err != nil {
+		return fmt.Errorf("%w (入力を解析できません: %v)", errNotVerifiable, err)
+	}
+	// 変換時と同じ Config.Streams などの指定で選ばれるストリーム数と比較する (サイドカーは数えない)
+	return r.checkOutput(src, t.output, r.mapStreams(src, t.output, t.remux, false, nil).counts)
+}
@@ -0,0 +1,241 @@
+package transav1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SplitOptions: ffmpeg オプション文字列をシェルと同様の規則で引数に分割する
+//   - 空白 (スペース・タブ・改行) で区切る
+//   - '...' の中は全て文字どおりに扱う
+//   - "..." の中では \" と \\ のみをエスケープとして扱う
+//   - 引用符の外では、バックスラッシュは空白・引用符・バックスラッシュの前でのみエスケープとして扱う
+//     (Windows のパス "C:\videos\sub.srt" をそのまま書けるようにするため)
+//
+// 例: `-vf "scale=1280:-2, fps=30" -metadata title='My Movie'` -> [-vf, scale=1280:-2, fps=30, -metadata, title=My Movie]
+func SplitOptions(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false // 現在の引数が始まっているか ("" のような空の引数も1つとして扱う)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			inArg = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("オプション文字列の引用符 (') が閉じられていません: %s", s)
+			}
+			cur.WriteString(string(runes[i+1 : end]))
+			i = end
+		case c == '"':
+			inArg = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+					cur.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				cur.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("オプション文字列の引用符 (\") が閉じられていません: %s", s)
+			}
+		case c == '\\' && i+1 < len(runes) && strings.ContainsRune(" \t'\"\\", runes[i+1]):
+			inArg = true
+			i++
+			cur.WriteRune(runes[i])
+		default:
+			inArg = true
+			cur.WriteRune(c)
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// indexRune: runes[from:] 中で最初に r が現れる位置を返す (なければ -1)
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// JoinOptions: 引数のリストを SplitOptions で元に戻せる1つの文字列にする (ログ・ジャーナル記録用)
+func JoinOptions(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n\r'\"\\") {
+			a = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a) + `"`
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
+
+// reservedOptions: ツール自身が指定するため、エンコーダオプションでの指定を認めない ffmpeg オプション
+// ストリーム指定子付きのもの ("-c:v:0", "-map_metadata:s:a" など) は、"-c:v" のように種類まで、次にオプション名のみで照合する
+var reservedOptions = map[string]string{
+	"-i":            "入力ファイルはツールが指定します",
+	"-y":            "出力の上書きはツールが指定します",
+	"-n":            "出力の上書きはツールが指定します",
+	"-progress":     "進捗の取得にツールが使用します",
+	"-c:v":          "映像エンコーダはエンコーダ名で指定してください",
+	"-codec:v":      "映像エンコーダはエンコーダ名で指定してください",
+	"-vcodec":       "映像エンコーダはエンコーダ名で指定してください",
+	"-c:a":          "音声のコーデックは -acodec で指定してください",
+	"-codec:a":      "音声のコーデックは -acodec で指定してください",
+	"-acodec":       "音声のコーデックは -acodec で指定してください",
+	"-c:s":          "字幕のコーデックは -scodec で指定してください",
+	"-codec:s":      "字幕のコーデックは -scodec で指定してください",
+	"-scodec":       "字幕のコーデックは -scodec で指定してください",
+	"-c":            "コーデックはツールがストリームごとに指定します (映像はエンコーダ名, 音声は -acodec, 字幕は -scodec)",
+	"-codec":        "コーデックはツールがストリームごとに指定します (映像はエンコーダ名, 音声は -acodec, 字幕は -scodec)",
+	"-map":          "出力に含めるストリームはツールが指定します (-streams)",
+	"-map_metadata": "メタデータの引き継ぎはツールが指定します (-nometadata)",
+	"-map_chapters": "チャプターの引き継ぎはツールが指定します (-nometadata)",
+	"-f":            "出力の形式はツールが指定します (-container)",
+	"-loglevel":     "ログレベルはツールが指定します",
+	"-v":            "ログレベルはツールが指定します",
+}
+
+// reservedOption: 引数が予約済みオプションであれば、指定できない理由を返す
+func reservedOption(a string) (reason string, ok bool) {
+	parts := strings.SplitN(a, ":", 3)
+	if len(parts) > 1 {
+		if reason, ok := reservedOptions[parts[0]+":"+parts[1]]; ok {
+			return reason, true
+		}
+	}
+	reason, ok = reservedOptions[parts[0]]
+	return reason, ok
+}
+
+// flagOptions: 値を取らない ffmpeg オプション (これらの直後の引数は出力パスとみなす)
+// ffmpeg -h full から一覧を取得できない場合 (Encoder.Validate など) に使用する
+var flagOptions = map[string]bool{
+	"-an": true, "-vn": true, "-sn": true, "-dn": true,
+	"-shortest": true, "-copyts": true, "-start_at_zero": true, "-stdin": true,
+	"-stats": true, "-hide_banner": true, "-benchmark": true, "-benchmark_all": true,
+	"-debug_ts": true, "-xerror": true, "-ignore_unknown": true, "-copy_unknown": true,
+	"-recast_media": true, "-re": true, "-accurate_seek": true, "-find_stream_info": true,
+	"-autorotate": true, "-autoscale": true, "-fix_sub_duration": true, "-copyinkf": true,
+	"-bitexact": true, "-dump": true, "-hex": true, "-vstats": true, "-qphist": true,
+	"-report": true, "-drop_changed": true,
+}
+
+// parseFlagOptions: ffmpeg -h full の出力から、値を取らないオプション名の集合を求める
+// 出力形式: 行頭から "-名前[:<stream_spec>] <値の名前>  説明" (値を取らないものは値の名前がない)。
+// 行頭が空白の行 (エンコーダなどの AVOption, 常に値を取る) は対象外
+func parseFlagOptions(help []byte) map[string]bool {
+	flags := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(help))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "-") {
+			continue
+		}
+		spec, _, _ := strings.Cut(line, "  ") // 説明との区切りは2つ以上の空白
+		fields := strings.Fields(spec)
+		if len(fields) != 1 {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[0], "[")
+		flags[name] = true
+	}
+	return flags
+}
+
+// listFlagOptions: ffmpeg -h full を実行し、値を取らないオプション名の集合を返す
+// (組み込みの flagOptions も含める。ffmpeg のバージョンで増えたオプションも検証できるようにする)
+func listFlagOptions(ctx context.Context, ffmpegPath string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, encoderTestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-h", "full")
+	setOSSpecificAttrs(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg -h full の実行に失敗: %w", err)
+	}
+	flags := parseFlagOptions(out)
+	if len(flags) == 0 {
+		return nil, fmt.Errorf("ffmpeg -h full の出力からオプション一覧を取得できません")
+	}
+	for name := range flagOptions {
+		flags[name] = true
+	}
+	return flags, nil
+}
+
+// isFlagOption: 引数が値を取らないオプションかどうか (ストリーム指定子を除いて照合し、"-noXXX" は "-XXX" の否定として扱う)
+func isFlagOption(a string, flags map[string]bool) bool {
+	name, _, _ := strings.Cut(a, ":")
+	if flags[a] || flags[name] {
+		return true
+	}
+	return strings.HasPrefix(name, "-no") && flags["-"+strings.TrimPrefix(name, "-no")]
+}
+
+// ValidateOptions: エンコーダオプションにツールが管理する引数が含まれていないか検証する
+// (-i, -y などの予約済みオプションと、ffmpeg に出力パスとして解釈されるオプション以外の引数を拒否する)
+func ValidateOptions(args []string) error {
+	return validateOptions(args, flagOptions)
+}
+
+// validateOptions: flags を値を取らないオプションの一覧として ValidateOptions の検証を行う
+func validateOptions(args []string, flags map[string]bool) error {
+	expectValue := false // 直前の引数がオプション名で、値を待っているか
+	for _, a := range args {
+		isOption := strings.HasPrefix(a, "-") && len(a) > 1 && !isNumber(a)
+		if !isOption {
+			if !expectValue {
+				return fmt.Errorf("オプション以外の引数 '%s' は出力パスとして解釈されるため指定できません", a)
+			}
+			expectValue = false
+			continue
+		}
+		if reason, ok := reservedOption(a); ok {
+			return fmt.Errorf("オプション '%s' は指定できません (%s)", a, reason)
+		}
+		expectValue = !isFlagOption(a, flags)
+	}
+	return nil
+}
+
+// isNumber: 負の数値 ("-1", "-0.5") など、数値として解釈できる文字列かどうか
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// Arguments: この段のエンコーダ用の追加引数 (Options を SplitOptions で分割し、Args を続けたもの) を返す
+func (e Encoder) Arguments() ([]string, error) {
+	args, err := SplitOptions(e.Options)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, e.Args...), nil
+}
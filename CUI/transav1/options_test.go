@@ -0,0 +1,140 @@
+package transav1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitOptions(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "  -crf 28\t-preset 7\n", want: []string{"-crf", "28", "-preset", "7"}},
+		{in: `-vf "scale=1280:-2, fps=30"`, want: []string{"-vf", "scale=1280:-2, fps=30"}},
+		{in: `-metadata title='My Movie'`, want: []string{"-metadata", "title=My Movie"}},
+		{in: `-x "a \"b\" \\ c"`, want: []string{"-x", `a "b" \ c`}},
+		{in: `-x 'a \ b'`, want: []string{"-x", `a \ b`}},
+		{in: `-i C:\videos\sub.srt`, want: []string{"-i", `C:\videos\sub.srt`}},
+		{in: `-x a\ b`, want: []string{"-x", "a b"}},
+		{in: `-x ""`, want: []string{"-x", ""}},
+		{in: `-x "abc`, wantErr: true},
+		{in: `-x 'abc`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SplitOptions(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SplitOptions(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitOptions(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoinOptionsRoundTrip(t *testing.T) {
+	for _, args := range [][]string{
+		{"-crf", "28"},
+		{"-vf", "scale=1280:-2, fps=30"},
+		{"-metadata", `title=It's "quoted"`},
+		{"-x", `C:\videos\sub.srt`, ""},
+	} {
+		got, err := SplitOptions(JoinOptions(args))
+		if err != nil || !reflect.DeepEqual(got, args) {
+			t.Errorf("SplitOptions(JoinOptions(%q)) = %q, %v", args, got, err)
+		}
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		args    string
+		wantErr string // エラーに含まれる文字列 (空: エラーなし)
+	}{
+		{args: "-crf 28 -preset 7"},
+		{args: "-cq 25 -preset p5 -b:v 0"},
+		{args: `-vf "scale=1280:-2" -svtav1-params tune=0`},
+		{args: "-g -1 -an"},
+		{args: "-shortest -crf 30"},
+		{args: "-nostdin -crf 30"},
+		{args: "-i input.mp4", wantErr: "-i"},
+		{args: "-y", wantErr: "-y"},
+		{args: "-c:v libx264", wantErr: "-c:v"},
+		{args: "-c:v:0 libx264", wantErr: "-c:v:0"},
+		{args: "-vcodec libx264", wantErr: "-vcodec"},
+		{args: "-c copy", wantErr: "-c"},
+		{args: "-codec copy", wantErr: "-codec"},
+		{args: "-c:a aac", wantErr: "-acodec"},
+		{args: "-acodec aac", wantErr: "-acodec"},
+		{args: "-c:s mov_text", wantErr: "-scodec"},
+		{args: "-c:0 copy", wantErr: "-c:0"},
+		{args: "-map 0", wantErr: "-map"},
+		{args: "-map_metadata -1", wantErr: "-map_metadata"},
+		{args: "-map_metadata:s:a 0", wantErr: "-map_metadata"},
+		{args: "-map_chapters -1", wantErr: "-map_chapters"},
+		{args: "-f matroska", wantErr: "-f"},
+		{args: "-loglevel debug", wantErr: "-loglevel"},
+		{args: "out.mp4", wantErr: "out.mp4"},
+		{args: "-an out.mp4", wantErr: "out.mp4"},
+		{args: "-crf 28 out.mp4", wantErr: "out.mp4"},
+		{args: "-copyts out.mp4", wantErr: "out.mp4"},
+		{args: "-noautorotate out.mp4", wantErr: "out.mp4"},
+	}
+	for _, tt := range tests {
+		args, err := SplitOptions(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ValidateOptions(args)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("ValidateOptions(%q) = %v, want nil", tt.args, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("ValidateOptions(%q) = %v, want error containing %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+// ffmpeg -h full の出力 (抜粋) から値を取らないオプションを求め、組み込みの一覧にないものも検証に使う
+func TestParseFlagOptions(t *testing.T) {
+	help := `Hyper fast Audio and Video encoder
+usage: ffmpeg [options] [[infile options] -i infile]... {[outfile options] outfile}...
+
+Getting help:
+    -h      -- print basic options
+
+Global options (affect whole program instead of just one file):
+-y                  overwrite output files
+-stats_period time  set the period at which ffmpeg updates stats and -progress output
+-stdin              enable or disable interaction on standard input
+
+Per-file main options:
+-f fmt              force container format (auto-detected otherwise)
+-c[:<stream_spec>] <codec>  select encoder/decoder ('copy' to copy stream without reencoding)
+-map [-]input_file_id[:stream_specifier][,sync_file_id[:stream_s  set input stream mapping
+-newflag            some flag added in a newer ffmpeg
+-fix_sub_duration[:<stream_spec>]  fix subtitles duration
+
+AVCodecContext AVOptions:
+  -b                 <int64>      E..VA...... set bitrate (in bits/s) (default 200000)
+  -flags             <flags>      ED.VAS..... (default 0)
+`
+	got := parseFlagOptions([]byte(help))
+	want := map[string]bool{"-y": true, "-stdin": true, "-newflag": true, "-fix_sub_duration": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFlagOptions = %v, want %v", got, want)
+	}
+
+	args := []string{"-newflag", "out.mp4"}
+	if err := validateOptions(args, got); err == nil {
+		t.Errorf("validateOptions(%q) = nil, want error", args)
+	}
+	args = []string{"-nostdin", "-fix_sub_duration:s", "-stats_period", "5"}
+	if err := validateOptions(args, got); err != nil {
+		t.Errorf("validateOptions(%q) = %v, want nil", args, err)
+	}
+}
@@ -0,0 +1,394 @@
+package transav1
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// --- 実行計画 (ドライラン) ---
+// ConvertTree / ConvertFile と同じ判定 (QuickMode 回復処理、Restart 処理、出力パスの計算、既存の出力の確認) を、
+// ファイルを一切変更せず、ffmpeg/ffprobe も実行せずに行い、実行した場合の処理内容を一覧にする。
+// 入力の解析が必要な判定 (AV1 ソース、読み取れない入力) は行わないため、それらもエンコード対象として計画する。
+
+// PlanItem: 実行計画の1件 (パスはそれぞれのルートからの相対パス, スラッシュ区切り)
+type PlanItem struct {
+	Source string `json:"source,omitempty"` // 入力元のファイル
+	Output string `json:"output,omitempty"` // 出力先のファイル
+	Size   int64  `json:"size,omitempty"`   // 入力ファイルサイズ (バイト)
+	Detail string `json:"detail,omitempty"` // 判定の理由・処理内容の補足
+}
+
+// Plan: 変換の実行計画 (PlanTree / PlanFile の結果)
+type Plan struct {
+	Source      string     `json:"source"`       // 入力元ディレクトリ (単一ファイルの場合は入力ファイル)
+	Dest        string     `json:"dest"`         // 出力先ディレクトリ
+	Journal     bool       `json:"journal"`      // ジャーナルを参照したか
+	RemoveDest  bool       `json:"remove_dest"`  // 変換の前に出力先ディレクトリを削除するか
+	RemoveFiles int        `json:"remove_files"` // 削除される出力先のファイル数 (RemoveDest の場合)
+	RemoveBytes int64      `json:"remove_bytes"` // 削除される出力先のファイルの合計サイズ (RemoveDest の場合)
+	Recover     []PlanItem `json:"recover"`      // QuickMode 回復処理の対象 (入力元の .processing、.origin マーカー)
+	Restart     []PlanItem `json:"restart"`      // Restart 処理で削除するファイル・未処理に戻す動画
+	Encode      []PlanItem `json:"encode"`       // エンコードする動画
+	Skip        []PlanItem `json:"skip"`         // 出力済みのためスキップする動画
+	Copy        []PlanItem `json:"copy"`         // コピーするその他のファイル
+	CopySkip    []PlanItem `json:"copy_skip"`    // 出力先に既に存在するためコピーしないその他のファイル
+	Excluded    []PlanItem `json:"excluded"`     // パターン・拡張子の設定 (ignore)・入力元の中にある出力先により除外するファイル・ディレクトリ
+	Collisions  []PlanItem `json:"collisions"`   // 出力名が衝突する動画 (Config.Collision で解決した出力名)
+}
+
+// PlanTree: ConvertTree(ctx, srcDir, dstDir) を実行した場合の処理内容を求める (ファイルの変更・ffmpeg の実行は行わない)
+// removeDest: 変換の前に出力先ディレクトリを削除する場合 (-force) に true を指定する (出力先を空として計画する)
+func (c *Converter) PlanTree(ctx context.Context, srcDir, dstDir string, removeDest bool) (*Plan, error) {
+	if err := requireDir(srcDir, "入力元"); err != nil {
+		return nil, err
+	}
+	p := &Plan{Source: srcDir, Dest: dstDir, RemoveDest: removeDest}
+	r, emptyDest, err := c.openPlanRun(ctx, srcDir, dstDir, p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	// --- QuickMode 回復処理・Restart 処理 (ConvertTree と同じく、ファイルリスト作成の前に行われる) ---
+	recovered := make(map[string]bool) // 回復処理で元の名前に戻る入力 (元の名前のフルパス)
+	if !emptyDest {
+		r.planRecover(p, srcDir, dstDir, recovered)
+		if c.cfg.Restart {
+			r.planRestart(p, dstDir)
+		}
+	}
+
+	// --- ファイルリスト作成と、動画・その他のファイルごとの判定 ---
+	walkErr := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.logger.Printf("警告: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if r.isNestedDst(path, d) {
+			p.Excluded = append(p.Excluded, PlanItem{Source: r.journal.key(path) + "/", Detail: "入力元の中にある出力先"})
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			if c.filter.excluded(srcDir, path, true) {
+				p.Excluded = append(p.Excluded, PlanItem{Source: r.journal.key(path) + "/", Detail: "ディレクトリ (配下を含む)"})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		var size int64
+		if info, err := d.Info(); err == nil {
+			size = info.Size()
+		}
+		// 回復処理で元の名前に戻る入力は、元の名前で計画する
+		if original, ok := strings.CutSuffix(path, processingSuffix); ok && recovered[original] {
+			path = original
+		}
+		if c.filter.excluded(srcDir, path, false) {
+			p.Excluded = append(p.Excluded, PlanItem{Source: r.journal.key(path), Size: size})
+			return nil
+		}
+
+		// 内容による判定 (Config.Sniff) は ffprobe の実行が必要なため、拡張子のみで計画する
+		class, known := c.classes.classOf(path)
+		if class == ClassIgnore {
+			p.Excluded = append(p.Excluded, PlanItem{Source: r.journal.key(path), Size: size, Detail: "拡張子の設定: " + string(ClassIgnore)})
+			return nil
+		}
+		if class == ClassEncode {
+			names, _ := r.dirNames(srcDir, filepath.Dir(path))
+			oc, collided := names.collision(filepath.Base(path))
+			outputPath, err := r.outputPath(path, srcDir, dstDir)
+			if err != nil && collided { // CollisionFail
+				p.Collisions = append(p.Collisions, PlanItem{Source: r.journal.key(path), Size: size,
+					Detail: fmt.Sprintf("出力名 '%s' が衝突, -collision %s のため変換は開始されません", oc.output, CollisionFail)})
+				return nil
+			}
+			if err != nil {
+				c.logger.Printf("警告: 動画出力パス計算失敗 (%s): %v。", path, err)
+				return nil
+			}
+			if collided {
+				p.Collisions = append(p.Collisions, PlanItem{Source: r.journal.key(path), Output: r.journal.outputKey(outputPath), Size: size,
+					Detail: fmt.Sprintf("出力名 '%s' が衝突, -collision %s", oc.output, c.cfg.Collision)})
+			}
+			outputPath = r.existingOutput(outputPath)
+			skip, detail := r.planVideo(path, outputPath, emptyDest)
+			item := PlanItem{Source: r.journal.key(path), Output: r.journal.outputKey(outputPath), Size: size, Detail: detail}
+			if skip {
+				p.Skip = append(p.Skip, item)
+			} else {
+				p.Encode = append(p.Encode, item)
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			c.logger.Printf("警告: その他ファイル相対パス計算失敗 (%s): %v。", path, err)
+			return nil
+		}
+		outputPath := filepath.Join(dstDir, relPath)
+		item := PlanItem{Source: filepath.ToSlash(relPath), Output: filepath.ToSlash(relPath), Size: size}
+		sidecarPath, videoOutput, sidecar := "", "", false
+		if c.cfg.Sidecars != SidecarCopy {
+			sidecarPath, videoOutput, sidecar = r.sidecarOutput(path, srcDir, dstDir)
+		}
+		switch {
+		case sidecar && r.willMux(path, srcDir):
+			item.Output = r.journal.outputKey(videoOutput)
+			item.Detail = "サイドカー: 動画の出力に多重化 (多重化できなかった場合は名前を変えてコピー)"
+			p.Copy = append(p.Copy, item)
+			return nil
+		case sidecar:
+			outputPath = sidecarPath
+			item.Output = r.journal.outputKey(outputPath)
+			item.Detail = "サイドカー: 動画の出力名に合わせる (動画を元の名前で配置した場合は元の名前)"
+		case class == ClassImage:
+			outputPath = imageOutputPath(outputPath)
+			item.Output = r.journal.outputKey(outputPath)
+			item.Detail = "AVIF に変換, 失敗した場合はそのままコピー"
+		case !known && c.cfg.Sniff:
+			item.Detail = "-sniff: 実行時に内容を調べ、動画であればエンコード"
+		}
+		if !emptyDest && r.fileExists(outputPath) {
+			p.CopySkip = append(p.CopySkip, item)
+		} else {
+			p.Copy = append(p.Copy, item)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("ファイルリスト作成中に予期せぬエラーが発生: %w", walkErr)
+	}
+	return p, nil
+}
+
+// PlanFile: ConvertFile(ctx, inputFile, outputDir) を実行した場合の処理内容を求める (ファイルの変更・ffmpeg の実行は行わない)
+func (c *Converter) PlanFile(ctx context.Context, inputFile, outputDir string) (*Plan, error) {
+	inputFilename := filepath.Base(inputFile)
+	if class, _ := c.classes.classOf(inputFilename); class != ClassEncode && !c.cfg.Sniff {
+		return nil, fmt.Errorf("入力ファイル '%s' はエンコード対象の拡張子ではありません", inputFile)
+	}
+	outputFile := filepath.Join(outputDir, strings.TrimSuffix(inputFilename, filepath.Ext(inputFilename))+c.outputSuffix())
+
+	p := &Plan{Source: inputFile, Dest: outputDir}
+	r, emptyDest, err := c.openPlanRun(ctx, filepath.Dir(inputFile), outputDir, p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	outputFile = r.existingOutput(outputFile)
+	skip, detail := r.planVideo(inputFile, outputFile, emptyDest)
+	item := PlanItem{Source: r.journal.key(inputFile), Output: r.journal.outputKey(outputFile), Detail: detail}
+	if info, err := os.Stat(inputFile); err == nil {
+		item.Size = info.Size()
+	}
+	if skip {
+		p.Skip = append(p.Skip, item)
+	} else {
+		p.Encode = append(p.Encode, item)
+	}
+	return p, nil
+}
+
+// openPlanRun: 計画用の実行状態を作成する (ジャーナルは読み込むだけで、回復処理などのリセットはメモリ上にのみ反映する)
+// 出力先が存在しない、または削除される (p.RemoveDest) 場合は emptyDest を true とし、出力先を空として扱う
+func (c *Converter) openPlanRun(ctx context.Context, srcRoot, dstRoot string, p *Plan) (r *run, emptyDest bool, err error) {
+	emptyDest = p.RemoveDest
+	if info, err := os.Stat(dstRoot); err != nil || !info.IsDir() {
+		emptyDest = true
+		p.RemoveDest = false // 削除するものはない
+	}
+	if p.RemoveDest {
+		// 削除される出力先の規模を集計する
+		_ = filepath.WalkDir(dstRoot, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				p.RemoveFiles++
+				if info, err := d.Info(); err == nil {
+					p.RemoveBytes += info.Size()
+				}
+			}
+			return nil
+		})
+	}
+
+	r, err = c.openRun(ctx, srcRoot, dstRoot, false)
+	if err != nil {
+		return nil, false, err
+	}
+	r.journal.close() // 以降の記録 (回復処理・Restart 処理のリセット) はメモリ上のみ
+	r.sniff = false   // 内容による判定 (ffprobe) は行わない
+	if p.RemoveDest {
+		// 削除される出力先のジャーナルは参照しない
+		r.journal.entries, r.journal.hadHistory = make(map[string]*journalEntry), false
+	}
+	p.Journal = r.journal.hasHistory()
+	return r, emptyDest, nil
+}
+
+// planVideo: 動画をエンコードするか、出力済みとしてスキップするかを判定する (checkExistingOutput と同じ判定)
+// emptyDest: 出力先を空として扱う (出力先が存在しない、または削除される)
+func (r *run) planVideo(inputFile, outputFile string, emptyDest bool) (skip bool, detail string) {
+	if emptyDest {
+		return false, ""
+	}
+	outputInfo, statErr := os.Stat(outputFile)
+	outputExists := statErr == nil && !outputInfo.IsDir()
+	if owner, ok := r.journal.outputOwner(outputFile, inputFile); ok && outputExists {
+		return false, fmt.Sprintf("出力ファイルはジャーナル上で別の入力 (%s) の出力のため、上書きせずに失敗します", owner.Source)
+	}
+
+	entry, known := r.journal.lookup(inputFile)
+	switch {
+	case known && entry.State == stateDone && r.journal.outputPath(entry) != outputFile:
+		// AV1 ソースのコピーなど、記録上の出力が通常の出力パスと異なる場合はそちらを確認する
+		if info, err := os.Stat(r.journal.outputPath(entry)); err == nil && (entry.OutputSize == 0 || info.Size() == entry.OutputSize) {
+			return true, fmt.Sprintf("処理済み (出力: %s)", entry.Output)
+		}
+		return false, "ジャーナル上は処理済みですが、出力ファイルが見つかりません"
+	case known && entry.State == stateDone:
+		if outputExists && (entry.OutputSize == 0 || outputInfo.Size() == entry.OutputSize) {
+			return true, "変換済み"
+		}
+		if outputExists {
+			return false, fmt.Sprintf("出力サイズが記録と異なります (%d != %d)", outputInfo.Size(), entry.OutputSize)
+		}
+		return false, "ジャーナル上は変換済みですが、出力ファイルが見つかりません"
+	case known:
+		detail = fmt.Sprintf("前回の状態: %s", entry.State)
+		if entry.State == statePending && entry.Note != "" {
+			detail = fmt.Sprintf("未処理に戻されています (%s)", entry.Note)
+		}
+		if outputExists {
+			detail += "。不完全な出力ファイルを削除します"
+		}
+		return false, detail
+	case outputExists && outputInfo.Size() > 0:
+		return true, "出力ファイル既存"
+	case outputExists:
+		return false, "サイズ 0 の出力ファイルを削除します"
+	}
+	return false, ""
+}
+
+// planRecover: QuickMode 回復処理 (recoverQuickModeFiles) の対象を求める
+// recovered: 元の名前に戻る入力のフルパスを追加する
+func (r *run) planRecover(p *Plan, srcRoot, dstRoot string, recovered map[string]bool) {
+	if r.journal.hasHistory() {
+		for _, e := range r.journal.entriesInState(stateEncoding) {
+			if !e.QuickMode {
+				continue // Temp モードでは入力元は変更されていない
+			}
+			originalSourcePath := r.journal.sourcePath(e)
+			item := PlanItem{Source: e.Source + processingSuffix, Output: e.Output}
+			switch {
+			case r.fileExists(originalSourcePath + processingSuffix):
+				item.Detail = "元の名前に戻し、不完全な出力を削除して未処理に戻します"
+				recovered[originalSourcePath] = true
+			case r.fileExists(originalSourcePath):
+				item.Source, item.Detail = e.Source, "不完全な出力を削除して未処理に戻します"
+			default:
+				item.Detail = "入力元が見つかりません (手動での確認が必要です)"
+				p.Recover = append(p.Recover, item)
+				continue
+			}
+			r.journal.resetEntry(e, "QuickMode 回復")
+			p.Recover = append(p.Recover, item)
+		}
+		return
+	}
+
+	// --- ジャーナル導入前の出力先: .origin マーカーを走査する ---
+	_ = filepath.WalkDir(dstRoot, func(markerPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), originSuffix) {
+			return nil
+		}
+		relDir, err := filepath.Rel(dstRoot, filepath.Dir(markerPath))
+		if err != nil {
+			return nil
+		}
+		originalSourcePath := filepath.Join(srcRoot, relDir, strings.TrimSuffix(d.Name(), originSuffix))
+		item := PlanItem{Output: r.journal.outputKey(markerPath)}
+		if r.fileExists(originalSourcePath + processingSuffix) {
+			item.Source = r.journal.key(originalSourcePath + processingSuffix)
+			item.Detail = "元の名前に戻し、マーカーを削除します"
+			recovered[originalSourcePath] = true
+		} else {
+			item.Detail = "対応する処理中ファイルがないため、マーカーを削除します"
+		}
+		p.Recover = append(p.Recover, item)
+		return nil
+	})
+}
+
+// planRestart: Restart 処理 (removeRestartFiles) で削除するファイルと未処理に戻す動画を求める
+func (r *run) planRestart(p *Plan, dstDir string) {
+	if r.journal.hasHistory() {
+		// 失敗・タイムアウト・中断のレコード (回復処理で未処理に戻したものは含まれない)
+		for _, e := range r.journal.entriesInState(stateFailed, stateTimeout, stateEncoding) {
+			outputPath := r.journal.outputPath(e)
+			var removed []string
+			if e.Marker != "" && r.fileExists(outputPath+e.Marker) {
+				removed = append(removed, path.Base(e.Output)+e.Marker)
+			}
+			if r.fileExists(outputPath) {
+				removed = append(removed, path.Base(e.Output))
+			}
+			p.Restart = append(p.Restart, restartItem(e, removed))
+			r.journal.resetEntry(e, "-restart")
+		}
+		// 完了しているが出力が存在しない・サイズ 0 のレコード
+		for _, e := range r.journal.entriesInState(stateDone) {
+			info, err := os.Stat(r.journal.outputPath(e))
+			if err == nil && info.Size() > 0 {
+				continue
+			}
+			var removed []string
+			if err == nil {
+				removed = append(removed, path.Base(e.Output))
+			}
+			p.Restart = append(p.Restart, restartItem(e, removed))
+			r.journal.resetEntry(e, "-restart (出力なし)")
+		}
+		return
+	}
+
+	// --- ジャーナル導入前の出力先: マーカーファイルと 0 バイトの動画ファイルを走査する ---
+	_ = filepath.WalkDir(dstDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		fileNameLower := strings.ToLower(d.Name())
+		switch {
+		case isFailedMarkerName(fileNameLower):
+			p.Restart = append(p.Restart, PlanItem{Output: r.journal.outputKey(filePath), Detail: "マーカーファイルを削除します"})
+		case IsVideoFile(fileNameLower):
+			if info, err := d.Info(); err == nil && info.Size() == 0 {
+				p.Restart = append(p.Restart, PlanItem{Output: r.journal.outputKey(filePath), Detail: "0バイト動画ファイルを削除します"})
+			}
+		}
+		return nil
+	})
+}
+
+// restartItem: ジャーナルのレコードを未処理に戻す計画の1件を作成する
+// removed: 削除するファイル名 (マーカー・不完全な出力)
+func restartItem(e journalEntry, removed []string) PlanItem {
+	detail := fmt.Sprintf("未処理に戻します (状態: %s)", e.State)
+	if len(removed) > 0 {
+		detail += "。削除: " + strings.Join(removed, ", ")
+	}
+	return PlanItem{Source: e.Source, Output: e.Output, Detail: detail}
+}
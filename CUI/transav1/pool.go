@@ -0,0 +1,214 @@
+package transav1
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// encodeLane: エンコードを実行するレーンの種類
+type encodeLane int
+
+const (
+	laneHW  encodeLane = iota // ハードウェアエンコーダの段を実行するレーン (Config.HWJobs)
+	laneCPU                   // CPU エンコーダの段を実行するレーン (Config.CPUJobs)
+)
+
+// videoJob: 1つの動画ファイルのエンコードジョブ
+// エンコードに失敗したジョブは準備済みの状態のまま、エンコーダチェーンの次の段へ渡される
+type videoJob struct {
+	index      int    // 処理順 (1 始まり, ログ表示用)
+	total      int    // 総件数 (0: 不明, 一時ファイルリスト使用時)
+	inputFile  string // 入力動画ファイルのフルパス
+	outputFile string // 出力動画ファイルのフルパス
+	outputDir  string // 出力先ディレクトリのパス (QuickModeマーカー作成用)
+
+	// --- prepareVideoJob で設定される作業状態 ---
+	prepared              bool          // 準備済みか
+	jobTempDir            string        // Temp モード時のジョブ専用一時ディレクトリ
+	currentInputFile      string        // ffmpeg に渡す実際の入力ファイルパス
+	tempOutputPath        string        // ffmpeg の出力先 (Temp モード時は一時パス)
+	renamedSourcePath     string        // Quick モード時のリネーム後ソースパス
+	quickModeOriginMarker string        // Quick モード時の .origin マーカーファイルパス
+	stage                 int           // エンコーダチェーン上の現在の段 (Config.Encoders のインデックス)
+	attempts              int           // ffmpeg の実行回数
+	sizeRetry             bool          // 出力サイズの基準未達により -retryopt で再エンコード中か
+	remux                 bool          // AV1 ソースを再エンコードせずに再多重化するか (-av1src remux, av1source.go)
+	sourceInfo            *mediaInfo    // 入力のメディア情報 (ffprobe で取得, 利用できない場合は nil)
+	sourceDuration        time.Duration // 入力の再生時間 (ffprobe で取得, 不明な場合は 0)
+	sidecars              []string      // 出力に多重化するサイドカー (SidecarMux, sidecar.go)
+	sidecarFiles          []string      // 動画の処理後に copySidecars でコピーするサイドカー (多重化したものを除く)
+	streams               streamMapping // 実行中の ffmpeg に渡したストリームの選択 (出力の検証に使用)
+	muxing                []string      // 実行中の ffmpeg に渡したサイドカー
+	muxed                 []string      // 最終的な出力に多重化されたサイドカー
+	placed                string        // 動画を最終的に配置したパス (出力または元ファイルのコピー, 配置しなかった場合は空)
+
+	// --- 処理結果 (イベント出力用) ---
+	skipped     bool         // 出力が既に存在したためスキップしたか
+	usedEncoder string       // 最後に使用したエンコーダ名
+	usedOptions string       // 最後に使用したエンコーダオプション
+	startedAt   time.Time    // 処理開始時刻 (ジャーナル記録用)
+	inputSize   int64        // 入力ファイルサイズ (ジャーナル記録用)
+	note        string       // ジャーナルの完了レコードに付記する補足
+	lastResult  ffmpegResult // 最後の ffmpeg 実行結果
+}
+
+// label: ログ表示用の "(index/total): ファイル名" 文字列を返す
+func (j *videoJob) label() string {
+	if j.total > 0 {
+		return fmt.Sprintf("(%d/%d): %s", j.index, j.total, filepath.Base(j.inputFile))
+	}
+	return fmt.Sprintf("(%d/不明): %s", j.index, filepath.Base(j.inputFile))
+}
+
+// errorList: 複数のゴルーチンから安全に追記できるエラーメッセージのリスト
+type errorList struct {
+	mu    sync.Mutex
+	items []string
+}
+
+// add: エラーメッセージを追加する
+func (l *errorList) add(msgs ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = append(l.items, msgs...)
+}
+
+// list: 現在までのエラーメッセージのコピーを返す
+func (l *errorList) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.items...)
+}
+
+// encodePool: HW/CPU レーンごとに独立した同時実行数を持つエンコードワーカープール
+// - 投入されたジョブはエンコーダチェーンの先頭の段のレーンで処理される
+// - 失敗したジョブは次の段で再試行され、別のレーンの段へはそのレーンに再キューされる (HW → CPU, CPU → HW)
+// - 同じレーンの次の段は、同じワーカーで続けて処理される
+type encodePool struct {
+	r        *run // 実行状態 (設定・一時ディレクトリ・エラーの格納先など)
+	hwQueue  chan *videoJob
+	cpuQueue chan *videoJob
+	hwWG     sync.WaitGroup
+	cpuWG    sync.WaitGroup
+	pending  sync.WaitGroup // 投入されてから完了していない (再キュー中を含む) ジョブ
+}
+
+// newEncodePool: ワーカープールを作成し、各レーンのワーカーを起動する
+// HW レーンは Config.HWJobs、CPU レーンは Config.CPUJobs の数だけワーカーを起動する
+// (チェーンに段がないレーンは起動しない)
+func (r *run) newEncodePool() *encodePool {
+	p := &encodePool{
+		r: r,
+		// バッファなしチャネル: 空きワーカーがいない場合は投入側が待機する
+		// (HW→CPU の再キューも同様で、準備済みジョブの一時コピーが溜まり続けるのを防ぐ)
+		hwQueue:  make(chan *videoJob),
+		cpuQueue: make(chan *videoJob),
+	}
+
+	hwWorkers, cpuWorkers := r.laneWorkers()
+	for i := 0; i < hwWorkers; i++ {
+		p.hwWG.Add(1)
+		go p.worker(laneHW, &p.hwWG, p.hwQueue)
+	}
+	for i := 0; i < cpuWorkers; i++ {
+		p.cpuWG.Add(1)
+		go p.worker(laneCPU, &p.cpuWG, p.cpuQueue)
+	}
+	r.logger.Printf("ワーカープール開始 (HWレーン: %d, CPUレーン: %d, エンコーダチェーン: %s)", hwWorkers, cpuWorkers, strings.Join(EncoderNames(r.cfg.Encoders), " → "))
+	return p
+}
+
+// laneWorkers: エンコーダチェーンを考慮した各レーンのワーカー数を返す (段がないレーンは 0)
+func (r *run) laneWorkers() (hw, cpu int) {
+	for _, enc := range r.cfg.Encoders {
+		if enc.Hardware() {
+			hw = r.cfg.HWJobs
+		} else {
+			cpu = r.cfg.CPUJobs
+		}
+	}
+	return hw, cpu
+}
+
+// queueFor: レーンのキューを返す
+func (p *encodePool) queueFor(lane encodeLane) chan *videoJob {
+	if lane == laneHW {
+		return p.hwQueue
+	}
+	return p.cpuQueue
+}
+
+// submit: ジョブをプールに投入する (空きワーカーが出るまでブロックする)
+func (p *encodePool) submit(job *videoJob) {
+	p.r.events.fileQueued(job)
+	p.pending.Add(1)
+	p.queueFor(p.r.cfg.Encoders[job.stage].lane()) <- job
+}
+
+// requeue: 別のレーンの段で再試行するジョブを、そのレーンのキューへ送る
+// HW → CPU は CPU ワーカーが受け取るまで待機する (準備済みジョブの一時コピーが溜まり続けるのを防ぐ)。
+// CPU → HW は別のゴルーチンから送り、CPU ワーカーは待機しない
+// (両方向で待機すると、互いのレーンへの再キューで全ワーカーが停止する場合があるため)
+func (p *encodePool) requeue(job *videoJob) {
+	if p.r.cfg.Encoders[job.stage].lane() == laneCPU {
+		p.cpuQueue <- job
+		return
+	}
+	go func() { p.hwQueue <- job }()
+}
+
+// wait: 投入を締め切り、全ジョブの完了を待つ
+// 再キュー中のジョブも含めて全て完了した後に、両レーンのキューを閉じる
+func (p *encodePool) wait() {
+	p.pending.Wait()
+	close(p.hwQueue)
+	close(p.cpuQueue)
+	p.hwWG.Wait()
+	p.cpuWG.Wait()
+}
+
+// worker: 指定レーンのキューからジョブを取り出して処理する
+func (p *encodePool) worker(lane encodeLane, wg *sync.WaitGroup, queue <-chan *videoJob) {
+	defer wg.Done()
+	r := p.r
+	for job := range queue {
+		if lane == laneHW {
+			r.logger.Printf("--- 動画エンコード [HW] %s ---", job.label())
+		} else {
+			r.logger.Printf("--- 動画エンコード [CPU] %s ---", job.label())
+		}
+		requeue, err := r.processVideoFile(job)
+		for requeue && r.cfg.Encoders[job.stage].lane() == lane {
+			// 同じレーンの次の段は同じワーカーで続けて処理する
+			// (自レーンのキューへ送るとワーカー数 1 の場合にデッドロックするため)
+			requeue, err = r.processVideoFile(job)
+		}
+		if requeue {
+			// 別のレーンの段の失敗 (または出力サイズの基準未達) -> そのレーンへ
+			p.requeue(job)
+			continue
+		}
+		p.finishJob(job, err)
+	}
+}
+
+// finishJob: 完了したジョブの後処理 (サイドカーのコピー、進捗・イベントの出力、エラーの記録) を行う
+func (p *encodePool) finishJob(job *videoJob, err error) {
+	defer p.pending.Done()
+	r := p.r
+	if len(job.sidecarFiles) > 0 && !errors.Is(err, ErrInterrupted) {
+		r.copySidecars(job)
+	}
+	r.progress.jobFinished(job)
+	r.events.fileFinished(job, err)
+	if errors.Is(err, ErrInterrupted) {
+		return // 中断はエラー一覧に含めず、終了時にまとめて報告する
+	}
+	if err != nil {
+		r.errors.add(fmt.Sprintf("%s: %v", filepath.Base(job.inputFile), err))
+	}
+}
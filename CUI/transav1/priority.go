@@ -0,0 +1,63 @@
+package transav1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// processPriority: OS に依存しないプロセス優先度レベル
+// -priority オプションの文字列を parsePriority で変換して使用する。
+// 実際の OS への適用は priority_<os>.go の startProcess が行う。
+type processPriority int
+
+const (
+	priorityIdle        processPriority = iota // 最低優先度 (アイドル時のみ実行)
+	priorityBelowNormal                        // 通常より低い (デフォルト)
+	priorityNormal                             // 通常
+	priorityAboveNormal                        // 通常より高い (権限が必要な場合あり)
+)
+
+// parsePriority: -priority オプションの文字列を processPriority に変換する
+// 大文字小文字は区別しない (idle, BelowNormal, Normal, AboveNormal)
+func parsePriority(priority string) (processPriority, error) {
+	switch strings.ToLower(priority) {
+	case "idle":
+		return priorityIdle, nil
+	case "belownormal":
+		return priorityBelowNormal, nil
+	case "normal":
+		return priorityNormal, nil
+	case "abovenormal":
+		return priorityAboveNormal, nil
+	default:
+		return priorityNormal, fmt.Errorf("無効な優先度指定: '%s' (idle, BelowNormal, Normal, AboveNormal のいずれか)", priority)
+	}
+}
+
+// niceValue: Unix 系 OS における nice 値 (-20〜19) を返す
+func (p processPriority) niceValue() int {
+	switch p {
+	case priorityIdle: // 最低優先度
+		return 19
+	case priorityBelowNormal:
+		return 10
+	case priorityAboveNormal: // より高い優先度 (低い nice 値)
+		return -5 // 一般ユーザーでは設定できない場合がある (CAP_SYS_NICE が必要)
+	default:
+		return 0
+	}
+}
+
+// String: ログ表示用の優先度名を返す
+func (p processPriority) String() string {
+	switch p {
+	case priorityIdle:
+		return "Idle"
+	case priorityBelowNormal:
+		return "BelowNormal"
+	case priorityAboveNormal:
+		return "AboveNormal"
+	default:
+		return "Normal"
+	}
+}
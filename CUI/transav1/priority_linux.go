@@ -0,0 +1,79 @@
+//go:build linux
+
+package transav1
+
+import (
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix" // setpriority / ioprio_set の呼び出しに必要
+)
+
+// ioprio_set(2) 用の定数 (linux/ioprio.h)
+const (
+	ioprioWhoProcess = 1  // IOPRIO_WHO_PROCESS
+	ioprioClassShift = 13 // IOPRIO_CLASS_SHIFT
+	ioprioClassBE    = 2  // IOPRIO_CLASS_BE (ベストエフォート, レベル 0〜7)
+	ioprioClassIdle  = 3  // IOPRIO_CLASS_IDLE (他に I/O がない時のみ)
+)
+
+// setOSSpecificAttrs: プロセス開始前に OS 固有の属性を設定する
+// Linux では追加の属性設定は不要
+func setOSSpecificAttrs(cmd *exec.Cmd) {}
+
+// startProcess: Linux で CPU 優先度 (nice) と I/O 優先度を設定してプロセスを開始する
+// Linux の setpriority(2) / ioprio_set(2) はスレッド単位で、プロセス開始後に PID に対して設定すると
+// ffmpeg が既に生成したスレッドには反映されない。そのため、専用の OS スレッドの優先度を先に設定し、
+// そのスレッドから fork することで、子プロセスとその全てのスレッドに最初から引き継がせる。
+// 優先度を変更したスレッドは、ゴルーチンの終了とともに破棄される (UnlockOSThread しない)。
+// 優先度の設定失敗は警告ログを出力するのみ (ベストエフォート)
+func (r *run) startProcess(cmd *exec.Cmd, priority string) error {
+	level, err := parsePriority(priority)
+	if err != nil {
+		r.logger.Printf("警告: %v。デフォルト優先度を維持します。", err)
+		return cmd.Start()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		r.setThreadPriority(level)
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// setThreadPriority: 呼び出し元の OS スレッドの CPU 優先度 (nice) と I/O 優先度を設定する (startProcess 用)
+func (r *run) setThreadPriority(level processPriority) {
+	// 1. CPU 優先度 (nice 値, who=0 は呼び出し元のスレッド)
+	nice := level.niceValue()
+	r.debugf("Linux: 起動するプロセスの nice 値を %d (%s) に設定試行...", nice, level)
+	if err := unix.Setpriority(unix.PRIO_PROCESS, 0, nice); err != nil {
+		if err == unix.EACCES || err == unix.EPERM {
+			r.logger.Printf("警告: setpriority (nice: %d) 失敗: %v。優先度を上げるには CAP_SYS_NICE 権限が必要です。", nice, err)
+		} else {
+			r.logger.Printf("警告: setpriority (nice: %d) 失敗: %v", nice, err)
+		}
+	}
+
+	// 2. I/O 優先度 (who=0 は呼び出し元のスレッド)
+	ioprio := ioprioValue(level)
+	r.debugf("Linux: 起動するプロセスの I/O 優先度を 0x%x に設定試行...", ioprio)
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(ioprio)); errno != 0 {
+		r.logger.Printf("警告: ioprio_set (ioprio: 0x%x) 失敗: %v", ioprio, errno)
+	}
+}
+
+// ioprioValue: 優先度レベルに対応する ioprio_set(2) の値を返す
+func ioprioValue(level processPriority) int {
+	switch level {
+	case priorityIdle:
+		return ioprioClassIdle << ioprioClassShift
+	case priorityBelowNormal:
+		return ioprioClassBE<<ioprioClassShift | 7 // ベストエフォートの最低レベル
+	case priorityAboveNormal:
+		return ioprioClassBE<<ioprioClassShift | 0 // ベストエフォートの最高レベル
+	default:
+		return ioprioClassBE<<ioprioClassShift | 4 // カーネルのデフォルトレベル
+	}
+}
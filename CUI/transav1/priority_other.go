@@ -0,0 +1,26 @@
+//go:build !unix && !windows
+
+package transav1
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// setOSSpecificAttrs: プロセス開始前に OS 固有の属性を設定する (未対応 OS では何もしない)
+func setOSSpecificAttrs(cmd *exec.Cmd) {}
+
+// startProcess: プロセスを開始する (未対応 OS では優先度を設定しない)
+func (r *run) startProcess(cmd *exec.Cmd, priority string) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.setProcessPriority(cmd.Process, priority)
+	return nil
+}
+
+// setProcessPriority: 未対応 OS ではプロセス優先度設定をスキップする
+func (r *run) setProcessPriority(process *os.Process, priority string) {
+	r.logger.Printf("警告: 未対応 OS (%s) のため、プロセス優先度設定はスキップされます。", runtime.GOOS)
+}
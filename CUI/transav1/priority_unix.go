@@ -0,0 +1,46 @@
+//go:build unix && !linux
+
+package transav1
+
+import (
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix" // setpriority の呼び出しに必要
+)
+
+// setOSSpecificAttrs: プロセス開始前に OS 固有の属性を設定する
+// macOS/BSD では追加の属性設定は不要
+func setOSSpecificAttrs(cmd *exec.Cmd) {}
+
+// startProcess: プロセスを開始し、開始直後に setProcessPriority で優先度を設定する
+// (macOS/BSD では優先度がプロセス全体に適用されるため、開始後の設定で全てのスレッドに反映される)
+func (r *run) startProcess(cmd *exec.Cmd, priority string) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.setProcessPriority(cmd.Process, priority)
+	return nil
+}
+
+// setProcessPriority: macOS/BSD でプロセス開始後に nice 値を設定する
+// I/O 優先度は OS ごとに API が異なるため設定しない
+// 失敗時は警告ログを出力するのみ (ベストエフォート)
+func (r *run) setProcessPriority(process *os.Process, priority string) {
+	if process == nil {
+		r.logger.Printf("警告: 優先度設定対象のプロセスが nil です。")
+		return
+	}
+
+	level, err := parsePriority(priority)
+	if err != nil {
+		r.logger.Printf("警告: %v。デフォルト優先度を維持します。", err)
+		return
+	}
+
+	nice := level.niceValue()
+	r.debugf("プロセス (PID: %d) の nice 値を %d (%s) に設定試行...", process.Pid, nice, level)
+	if err := unix.Setpriority(unix.PRIO_PROCESS, process.Pid, nice); err != nil {
+		r.logger.Printf("警告: setpriority (PID: %d, nice: %d) 失敗: %v", process.Pid, nice, err)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build windows
+
+package transav1
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows" // Windows 特有の API 呼び出しに必要
+)
+
+// setOSSpecificAttrs: プロセス開始前に OS 固有の属性を設定する
+func setOSSpecificAttrs(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// Windows で ffmpeg 実行時にコンソールウィンドウを表示しないようにする
+	cmd.SysProcAttr.HideWindow = true
+}
+
+// startProcess: プロセスを開始し、開始直後に setProcessPriority で優先度を設定する
+// (Windows では優先度がプロセス全体に適用されるため、開始後の設定で全てのスレッドに反映される)
+func (r *run) startProcess(cmd *exec.Cmd, priority string) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.setProcessPriority(cmd.Process, priority)
+	return nil
+}
+
+// setProcessPriority: Windows でプロセス開始後に優先度を設定する
+// 失敗時は警告ログを出力するのみ (ベストエフォート)
+// プロセス初期化待ちのため、OpenProcess はリトライを試みる
+func (r *run) setProcessPriority(process *os.Process, priority string) {
+	if process == nil {
+		r.logger.Printf("警告: 優先度設定対象のプロセスが nil です。")
+		return
+	}
+
+	level, err := parsePriority(priority)
+	if err != nil {
+		r.logger.Printf("警告: %v。デフォルト優先度を維持します。", err)
+		return
+	}
+
+	var priorityClass uint32
+	switch level {
+	case priorityIdle:
+		priorityClass = windows.IDLE_PRIORITY_CLASS
+	case priorityBelowNormal:
+		priorityClass = windows.BELOW_NORMAL_PRIORITY_CLASS
+	case priorityAboveNormal:
+		priorityClass = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		priorityClass = windows.NORMAL_PRIORITY_CLASS
+	}
+
+	r.debugf("Windows プロセス (PID: %d) の優先度を %s (0x%x) に設定試行...", process.Pid, level, priorityClass)
+
+	var handle windows.Handle
+	const maxRetries = 3
+	const retryDelay = 100 * time.Millisecond
+
+	// OpenProcess をリトライ (プロセス初期化待ちのため)
+	for i := 0; i < maxRetries; i++ {
+		// プロセスハンドルを取得 (優先度設定に必要な権限を要求)
+		handle, err = windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(process.Pid))
+		if err == nil {
+			break // 成功したらループを抜ける
+		}
+		// アクセス拒否などの特定のエラーの場合のみリトライ
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_INVALID_PARAMETER) { // ERROR_INVALID_PARAMETER も初期化中に出ることがある
+			r.debugf("OpenProcess 試行 %d/%d 失敗 (PID: %d): %v。%v 後にリトライします。", i+1, maxRetries, process.Pid, err, retryDelay)
+			time.Sleep(retryDelay)
+		} else {
+			// その他のエラーはリトライしない
+			break
+		}
+	}
+
+	// リトライしても OpenProcess が失敗した場合
+	if err != nil {
+		errMsg := fmt.Sprintf("OpenProcess (PID: %d) 失敗 (リトライ後): %v.", process.Pid, err)
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			errMsg += " プロセス優先度変更に必要な権限がない可能性があります (管理者権限で実行が必要な場合があります)。"
+		}
+		r.logger.Printf("警告: %s", errMsg) // 警告としてログ出力
+		return
+	}
+	defer windows.CloseHandle(handle) // ハンドルを確実に閉じる
+
+	// 優先度を設定
+	if err := windows.SetPriorityClass(handle, priorityClass); err != nil {
+		r.logger.Printf("警告: SetPriorityClass (PID: %d, Priority: 0x%x) 失敗: %v.", process.Pid, priorityClass, err)
+		return
+	}
+
+	r.debugf("Windows プロセス (PID: %d) の優先度設定成功。", process.Pid)
+}
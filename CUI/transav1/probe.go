@@ -0,0 +1,220 @@
+package transav1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeTimeout: ffprobe 1回あたりのタイムアウト
+const probeTimeout = 60 * time.Second
+
+// maxSaneDuration: 入力検証で許容する最大の再生時間 (これを超える値はヘッダ破損とみなす)
+const maxSaneDuration = 7 * 24 * time.Hour
+
+// unreadableSuffix: 入力検証に失敗した動画の出力パスに付与するマーカーのサフィックス
+const unreadableSuffix = ".unreadable"
+
+// mediaInfo: ffprobe (-show_format -show_streams) の JSON 出力のうち使用する部分
+type mediaInfo struct {
+	Format  probeFormat   `json:"format"`
+	Streams []probeStream `json:"streams"`
+}
+
+// probeFormat: コンテナ (format) 情報
+type probeFormat struct {
+	FormatName string `json:"format_name"` // 例: "mov,mp4,m4a,3gp,3g2,mj2"
+	Duration   string `json:"duration"`    // 秒 (文字列, 不明な場合は空)
+	Size       string `json:"size"`        // バイト数 (文字列)
+}
+
+// probeStream: ストリーム情報
+type probeStream struct {
+	Index     int               `json:"index"`
+	CodecType string            `json:"codec_type"` // video, audio, subtitle, data, attachment
+	CodecName string            `json:"codec_name"` // 例: h264, av1, aac
+	Duration  string            `json:"duration"`   // 秒 (文字列, 不明な場合は空)
+	Tags      map[string]string `json:"tags"`
+	// Disposition: ストリームの属性 (例: "attached_pic": 1 はカバー画像)
+	Disposition map[string]int `json:"disposition"`
+}
+
+// isAttachedPicture: カバー画像などの静止画ストリームかどうか
+func (s probeStream) isAttachedPicture() bool {
+	return s.Disposition["attached_pic"] == 1
+}
+
+// duration: コンテナの再生時間を返す (コンテナに記録がなければ映像ストリームの再生時間, 不明な場合は 0)
+func (m *mediaInfo) duration() time.Duration {
+	if d := parseProbeSeconds(m.Format.Duration); d > 0 {
+		return d
+	}
+	if v := m.videoStream(); v != nil {
+		return parseProbeSeconds(v.Duration)
+	}
+	return 0
+}
+
+// videoStream: 最初の (カバー画像以外の) 映像ストリームを返す (なければ nil)
+func (m *mediaInfo) videoStream() *probeStream {
+	for i := range m.Streams {
+		if m.Streams[i].CodecType == "video" && !m.Streams[i].isAttachedPicture() {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// parseProbeSeconds: ffprobe の秒数文字列 ("123.456000") を time.Duration に変換する (不明・不正な場合は 0)
+func parseProbeSeconds(s string) time.Duration {
+	sec, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || sec <= 0 {
+		return 0
+	}
+	return time.Duration(sec * float64(time.Second))
+}
+
+// probeMedia: ffprobe でメディアファイルの情報を取得する
+// ffprobe が見つからない場合 (r.cfg.FFprobePath が空) はエラーを返す
+func (r *run) probeMedia(ctx context.Context, path string) (*mediaInfo, error) {
+	if r.cfg.FFprobePath == "" {
+		return nil, errors.New("ffprobe が利用できません")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	args := []string{
+		"-hide_banner",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	}
+	cmd := exec.CommandContext(ctx, r.cfg.FFprobePath, args...)
+	setOSSpecificAttrs(cmd) // Windows でウィンドウ非表示
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	r.debugf("ffprobe 実行: %s %s", r.cfg.FFprobePath, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			// タイムアウト・中断 (%w で context のエラーを保持し、probeInput で一時的な失敗として扱う)
+			return nil, fmt.Errorf("ffprobe 停止 (%s, タイムアウト: %v): %w", path, probeTimeout, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("ffprobe 失敗 (%s): %s", path, msg)
+	}
+
+	var info mediaInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("ffprobe 出力の解析失敗 (%s): %w", path, err)
+	}
+	return &info, nil
+}
+
+// validateMediaInfo: ffprobe の結果がエンコード可能な動画かを検証する
+// - カバー画像以外の映像ストリームがあり、コーデックが識別できること
+// - 再生時間が取得でき、0 より大きく maxSaneDuration 以下であること
+func validateMediaInfo(info *mediaInfo) error {
+	v := info.videoStream()
+	if v == nil {
+		return errors.New("映像ストリームがありません")
+	}
+	if v.CodecName == "" || v.CodecName == "none" {
+		return fmt.Errorf("映像ストリーム (#%d) のコーデックを識別できません", v.Index)
+	}
+	d := info.duration()
+	if d <= 0 {
+		return errors.New("再生時間を取得できません")
+	}
+	if d > maxSaneDuration {
+		return fmt.Errorf("再生時間が異常です (%s)", d)
+	}
+	return nil
+}
+
+// checkDecodable: ffmpeg で最初の映像フレームを実際にデコードできるか確認する
+func (r *run) checkDecodable(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	args := []string{
+		"-hide_banner",
+		"-v", "error",
+		"-i", path,
+		"-map", "0:V:0", // カバー画像 (attached_pic) を除いた最初の映像ストリーム
+		"-frames:v", "1",
+		"-f", "null", "-",
+	}
+	cmd := exec.CommandContext(ctx, r.cfg.FFmpegPath, args...)
+	setOSSpecificAttrs(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	r.debugf("デコード確認: %s %s", r.cfg.FFmpegPath, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("デコード確認停止 (タイムアウト: %v): %w", probeTimeout, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("最初のフレームをデコードできません: %s", msg)
+	}
+	return nil
+}
+
+// unreadableError: 入力検証 (probeInput) で読み取り不能と判定されたことを示すエラー
+type unreadableError struct {
+	err error
+}
+
+func (e *unreadableError) Error() string {
+	return fmt.Sprintf("入力ファイルを読み取れません: %v", e.err)
+}
+
+func (e *unreadableError) Unwrap() error {
+	return e.err
+}
+
+// probeInput: エンコード前に入力を検証し、メディア情報を返す
+// ffprobe の失敗、映像ストリーム・再生時間の異常、最初のフレームのデコード失敗は *unreadableError を返す
+// タイムアウト・中断は入力の問題とは限らないため、*unreadableError にせずそのまま返す (マーカーを書き込まず、次回の実行で再試行する)
+// ffprobe が利用できない場合は検証をスキップし、(nil, nil) を返す
+func (r *run) probeInput(ctx context.Context, path string) (*mediaInfo, error) {
+	if r.cfg.FFprobePath == "" {
+		return nil, nil
+	}
+	info, err := r.probeMedia(ctx, path)
+	if err != nil {
+		return nil, probeError(err)
+	}
+	if err := validateMediaInfo(info); err != nil {
+		return nil, &unreadableError{err: err}
+	}
+	if err := r.checkDecodable(ctx, path); err != nil {
+		return nil, probeError(err)
+	}
+	return info, nil
+}
+
+// probeError: 入力検証のコマンドのエラーを分類する (タイムアウト・中断以外は読み取り不能とする)
+func probeError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &unreadableError{err: err}
+}
@@ -0,0 +1,26 @@
+package transav1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// タイムアウト・中断は読み取り不能 (.unreadable マーカー) として扱わない
+func TestProbeError(t *testing.T) {
+	tests := []struct {
+		err            error
+		wantUnreadable bool
+	}{
+		{err: errors.New("ffprobe 失敗 (a.mp4): Invalid data found when processing input"), wantUnreadable: true},
+		{err: fmt.Errorf("ffprobe 停止 (a.mp4, タイムアウト: %v): %w", probeTimeout, context.DeadlineExceeded)},
+		{err: fmt.Errorf("デコード確認停止 (タイムアウト: %v): %w", probeTimeout, context.Canceled)},
+	}
+	for _, tt := range tests {
+		var unreadable *unreadableError
+		if got := errors.As(probeError(tt.err), &unreadable); got != tt.wantUnreadable {
+			t.Errorf("probeError(%v): unreadable = %v, want %v", tt.err, got, tt.wantUnreadable)
+		}
+	}
+}
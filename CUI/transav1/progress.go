@@ -0,0 +1,260 @@
+package transav1
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ffmpegProgress: ffmpeg の -progress 出力 (key=value 形式) の1ブロック分
+type ffmpegProgress struct {
+	outTime   time.Duration // 出力済みの再生位置 (out_time_us)
+	frame     int64         // 出力済みフレーム数
+	fps       float64       // エンコード速度 (フレーム/秒)
+	speed     float64       // 再生速度に対する倍率 (0: 不明)
+	totalSize int64         // 出力済みサイズ (バイト)
+	done      bool          // progress=end を受信したか
+}
+
+// apply: -progress 出力の1行 (key=value) を反映する
+// 戻り値が true の場合、1ブロック分の値が揃った (progress= 行を受信した) ことを示す
+func (p *ffmpegProgress) apply(line string) bool {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return false
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "out_time_us", "out_time_ms": // out_time_ms も実際はマイクロ秒 (ffmpeg の仕様)
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			p.outTime = time.Duration(us) * time.Microsecond
+		}
+	case "frame":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			p.frame = n
+		}
+	case "fps":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			p.fps = f
+		}
+	case "speed":
+		// 例: "1.25x", 開始直後は "N/A"
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			p.speed = f
+		}
+	case "total_size":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			p.totalSize = n
+		}
+	case "progress":
+		p.done = value == "end"
+		return true
+	}
+	return false
+}
+
+// isProgressLine: ffmpeg の出力行が -progress の key=value 行かどうか
+func isProgressLine(line string) bool {
+	key, _, ok := strings.Cut(line, "=")
+	return ok && key != "" && !strings.ContainsAny(key, " \t")
+}
+
+// progressTracker: 実行中の各ファイルと全体の進捗・ETA を集計してログに出力する
+// 複数のエンコードワーカーから同時に呼び出される
+type progressTracker struct {
+	mu       sync.Mutex
+	interval time.Duration // ファイルごとの進捗ログ出力間隔
+	logger   *log.Logger
+
+	totalJobs      int           // 総ジョブ数 (0: 不明)
+	finishedJobs   int           // 完了 (成功・失敗・スキップ) したジョブ数
+	probedJobs     int           // 再生時間を取得できたジョブ数
+	probedDuration time.Duration // 再生時間を取得できたジョブの合計再生時間
+	doneDuration   time.Duration // 完了したジョブの合計再生時間
+	active         map[*videoJob]time.Duration
+	lastLog        map[*videoJob]time.Time
+	firstStart     time.Time // 最初のエンコード開始時刻 (全体速度の計算用)
+}
+
+// newProgressTracker: 進捗トラッカーを作成する
+// interval: ファイルごとの進捗ログ出力間隔 (0 以下は進捗ログなし)
+func newProgressTracker(interval time.Duration, logger *log.Logger) *progressTracker {
+	return &progressTracker{
+		interval: interval,
+		logger:   logger,
+		active:   make(map[*videoJob]time.Duration),
+		lastLog:  make(map[*videoJob]time.Time),
+	}
+}
+
+// setTotal: 総ジョブ数を設定する (一時ファイルリスト使用時は呼び出さない)
+func (t *progressTracker) setTotal(n int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totalJobs = n
+}
+
+// jobProbed: ジョブの入力の再生時間を登録する (ffprobe 成功時)
+func (t *progressTracker) jobProbed(job *videoJob) {
+	if t == nil || job.sourceDuration <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.probedJobs++
+	t.probedDuration += job.sourceDuration
+}
+
+// encodeStarted: ffmpeg の実行開始を登録する (HW→CPU の再試行時は進捗を 0 に戻す)
+func (t *progressTracker) encodeStarted(job *videoJob) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstStart.IsZero() {
+		t.firstStart = time.Now()
+	}
+	t.active[job] = 0
+	t.lastLog[job] = time.Now()
+}
+
+// update: ffmpeg の進捗を反映し、出力間隔を過ぎていればログに出力する
+func (t *progressTracker) update(job *videoJob, encoder string, p ffmpegProgress) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active[job] = p.outTime
+	if t.interval <= 0 || time.Since(t.lastLog[job]) < t.interval {
+		return
+	}
+	t.lastLog[job] = time.Now()
+
+	// --- ファイル単位 ---
+	fileStatus := fmt.Sprintf("%s 経過 %s", formatClock(p.outTime), FormatSize(p.totalSize))
+	if job.sourceDuration > 0 {
+		percent := float64(p.outTime) / float64(job.sourceDuration) * 100
+		fileStatus = fmt.Sprintf("%5.1f%% (%s / %s)", min(percent, 100), formatClock(p.outTime), formatClock(job.sourceDuration))
+		if p.speed > 0 {
+			remaining := time.Duration(float64(job.sourceDuration-p.outTime) / p.speed)
+			fileStatus += fmt.Sprintf(", 残り %s", formatClock(max(remaining, 0)))
+		}
+	}
+	if p.speed > 0 {
+		fileStatus += fmt.Sprintf(", 速度 %.2fx", p.speed)
+	}
+
+	t.logger.Printf("進捗 (%s) %s: %s | 全体: %s", encoder, filepath.Base(job.inputFile), fileStatus, t.overallLocked())
+}
+
+// jobFinished: ジョブの完了 (成功・失敗・スキップ) を登録する
+func (t *progressTracker) jobFinished(job *videoJob) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.active, job)
+	delete(t.lastLog, job)
+	t.finishedJobs++
+	t.doneDuration += job.sourceDuration
+	if t.interval > 0 {
+		t.logger.Printf("全体進捗: %s", t.overallLocked())
+	}
+}
+
+// overallSnapshot: 全体の進捗の集計値
+type overallSnapshot struct {
+	finished int           // 完了ジョブ数
+	total    int           // 総ジョブ数 (0: 不明)
+	percent  float64       // 全体の進捗率 (-1: 算出不可)
+	rate     float64       // 全体のエンコード速度 (再生時間/実時間, 0: 算出不可)
+	eta      time.Duration // 全体の残り時間 (-1: 算出不可)
+}
+
+// snapshot: 全体の進捗の集計値を返す
+func (t *progressTracker) snapshot() overallSnapshot {
+	if t == nil {
+		return overallSnapshot{percent: -1, eta: -1}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snapshotLocked()
+}
+
+// snapshotLocked: 全体の進捗を集計する (t.mu を保持した状態で呼び出すこと)
+// 残り時間は「これまでの全体のエンコード速度 (再生時間/実時間)」と「残りの推定再生時間」から算出する。
+// 再生時間が未取得のジョブは、取得済みジョブの平均再生時間で見積もる。
+func (t *progressTracker) snapshotLocked() overallSnapshot {
+	snap := overallSnapshot{finished: t.finishedJobs, total: t.totalJobs, percent: -1, eta: -1}
+	if t.totalJobs == 0 || t.probedJobs == 0 {
+		return snap
+	}
+
+	encoded := t.doneDuration
+	for _, d := range t.active {
+		encoded += d
+	}
+	average := t.probedDuration / time.Duration(t.probedJobs)
+	estimatedTotal := t.probedDuration + average*time.Duration(max(t.totalJobs-t.probedJobs, 0))
+	if estimatedTotal <= 0 {
+		return snap
+	}
+	snap.percent = min(float64(encoded)/float64(estimatedTotal)*100, 100)
+
+	elapsed := time.Since(t.firstStart)
+	if t.firstStart.IsZero() || elapsed <= 0 || encoded <= 0 {
+		return snap
+	}
+	snap.rate = float64(encoded) / float64(elapsed) // 実時間1秒あたりにエンコードできる再生時間
+	snap.eta = time.Duration(float64(max(estimatedTotal-encoded, 0)) / snap.rate)
+	return snap
+}
+
+// overallLocked: 全体の進捗文字列を生成する (t.mu を保持した状態で呼び出すこと)
+func (t *progressTracker) overallLocked() string {
+	snap := t.snapshotLocked()
+	if snap.total == 0 {
+		return fmt.Sprintf("%d 件完了 (総数不明)", snap.finished)
+	}
+	status := fmt.Sprintf("%d/%d 件完了", snap.finished, snap.total)
+	if snap.percent >= 0 {
+		status += fmt.Sprintf(", %.1f%%", snap.percent)
+	}
+	if snap.eta >= 0 {
+		status += fmt.Sprintf(", 全体速度 %.2fx, 残り %s", snap.rate, formatClock(snap.eta))
+	}
+	return status
+}
+
+// formatClock: 時間を "hh:mm:ss" 形式で返す
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+}
+
+// FormatSize: バイト数を読みやすい単位で返す
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,77 @@
+package transav1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFFmpegProgressApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		want   ffmpegProgress
+		blocks int // progress= 行で揃ったブロック数
+	}{
+		{
+			name: "1ブロック",
+			lines: []string{
+				"frame=240", "fps=47.95", "out_time_us=10000000", "out_time=00:00:10.000000",
+				"total_size=524288", "speed=1.99x", "progress=continue",
+			},
+			want:   ffmpegProgress{outTime: 10 * time.Second, frame: 240, fps: 47.95, speed: 1.99, totalSize: 524288},
+			blocks: 1,
+		},
+		{
+			name:   "out_time_ms もマイクロ秒",
+			lines:  []string{"out_time_ms=2500000", "progress=continue"},
+			want:   ffmpegProgress{outTime: 2500 * time.Millisecond},
+			blocks: 1,
+		},
+		{
+			name:   "開始直後の N/A は無視",
+			lines:  []string{"out_time_us=N/A", "speed=N/A", "fps=0.00", "progress=continue"},
+			want:   ffmpegProgress{},
+			blocks: 1,
+		},
+		{
+			name:   "負の再生位置は無視",
+			lines:  []string{"out_time_us=-23220", "progress=continue"},
+			want:   ffmpegProgress{},
+			blocks: 1,
+		},
+		{
+			name:   "行末の CR と終了",
+			lines:  []string{"frame=10\r", "speed=0.5x\r", "progress=end\r"},
+			want:   ffmpegProgress{frame: 10, speed: 0.5, done: true},
+			blocks: 1,
+		},
+		{
+			name:   "後のブロックの値で更新",
+			lines:  []string{"frame=1", "progress=continue", "frame=2", "progress=continue"},
+			want:   ffmpegProgress{frame: 2},
+			blocks: 2,
+		},
+		{
+			name:  "key=value 以外の行",
+			lines: []string{"[libsvtav1 @ 0x1] SVT [version]: SVT-AV1 Encoder Lib v2.1.0", ""},
+			want:  ffmpegProgress{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p ffmpegProgress
+			blocks := 0
+			for _, line := range tt.lines {
+				if p.apply(line) {
+					blocks++
+				}
+			}
+			if p != tt.want {
+				t.Errorf("apply = %+v, want %+v", p, tt.want)
+			}
+			if blocks != tt.blocks {
+				t.Errorf("ブロック数 %d, want %d", blocks, tt.blocks)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package transav1
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- recoverQuickModeFiles 関数: QuickMode で中断された可能性のあるファイルを回復試行 ---
+// ジャーナルがある場合は「エンコード中」のまま残った QuickMode のレコードを回復対象とし、
+// ジャーナル導入前の出力先では .origin マーカーファイルを走査する
+// 戻り値: 回復成功件数, 要確認件数
+func (r *run) recoverQuickModeFiles(srcRoot, dstRoot string) (recoveredCount, failedCount int) {
+	r.logger.Println("--- QuickMode 回復処理開始 ---")
+	if r.journal.hasHistory() {
+		recoveredCount, failedCount = r.recoverQuickModeFromJournal()
+	} else {
+		recoveredCount, failedCount = r.recoverQuickModeFromMarkers(srcRoot, dstRoot)
+	}
+
+	if recoveredCount > 0 || failedCount > 0 {
+		r.logger.Printf("--- QuickMode 回復処理終了 (成功: %d件, 要確認: %d件) ---", recoveredCount, failedCount)
+	} else {
+		r.logger.Println("--- QuickMode 回復処理終了 (対象ファイルなし) ---")
+	}
+	return recoveredCount, failedCount
+}
+
+// --- recoverQuickModeFromJournal 関数: ジャーナルを参照して QuickMode の中断ファイルを回復 ---
+// 戻り値: 回復成功件数, 要確認件数
+func (r *run) recoverQuickModeFromJournal() (recoveredCount, failedCount int) {
+	for _, e := range r.journal.entriesInState(stateEncoding) {
+		if !e.QuickMode {
+			continue // Temp モードでは入力元は変更されていない
+		}
+		originalSourcePath := r.journal.sourcePath(e)
+		processingSourcePath := originalSourcePath + processingSuffix
+		outputPath := r.journal.outputPath(e)
+		markerPath := filepath.Join(filepath.Dir(outputPath), filepath.Base(originalSourcePath)+originSuffix)
+		r.debugf("[QuickMode回復]: 中断レコード: %s (処理中名: '%s')", e.Source, processingSourcePath)
+
+		// 1. .processing ファイルがあれば元の名前に戻す
+		if _, err := os.Stat(processingSourcePath); err == nil {
+			r.logger.Printf("情報 [QuickMode回復]: 処理中ファイル '%s' を '%s' にリネーム試行...", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath))
+			if err := os.Rename(processingSourcePath, originalSourcePath); err != nil {
+				r.logger.Printf("エラー [QuickMode回復]: リネーム失敗 (%s -> %s): %v。手動での確認が必要です！", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath), err)
+				failedCount++
+				continue
+			}
+		} else if !r.fileExists(originalSourcePath) {
+			// .processing も元のファイルも見つからない
+			r.logger.Printf("エラー [QuickMode回復]: 入力元 '%s' が見つかりません (処理中名 '%s' もなし)。手動での確認が必要です！", originalSourcePath, filepath.Base(processingSourcePath))
+			failedCount++
+			continue
+		}
+
+		// 2. 書きかけの出力ファイルと .origin マーカーを削除し、未処理に戻す
+		if r.fileExists(outputPath) {
+			r.logger.Printf("情報 [QuickMode回復]: 不完全な出力ファイル '%s' を削除します。", filepath.Base(outputPath))
+			if err := os.Remove(outputPath); err != nil {
+				r.logger.Printf("警告 [QuickMode回復]: 出力ファイル削除失敗 (%s): %v", outputPath, err)
+			}
+		}
+		if r.fileExists(markerPath) {
+			if err := os.Remove(markerPath); err != nil {
+				r.logger.Printf("警告 [QuickMode回復]: マーカー削除失敗 (%s): %v", markerPath, err)
+			}
+		}
+		r.journal.resetEntry(e, "QuickMode 回復")
+		r.logger.Printf("成功 [QuickMode回復]: %s を未処理に戻しました。", e.Source)
+		recoveredCount++
+	}
+	return recoveredCount, failedCount
+}
+
+// --- recoverQuickModeFromMarkers 関数: .origin マーカーを走査して QuickMode の中断ファイルを回復 (ジャーナル導入前の出力先用) ---
+// 戻り値: 回復成功件数, 要確認件数
+func (r *run) recoverQuickModeFromMarkers(srcRoot, dstRoot string) (recoveredCount, failedCount int) {
+	walkErr := filepath.WalkDir(dstRoot, func(markerPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			r.logger.Printf("警告 [QuickMode回復]: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", markerPath, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// ディレクトリや .origin 以外のファイルは無視
+		if d.IsDir() || !strings.HasSuffix(d.Name(), originSuffix) {
+			return nil
+		}
+
+		// .origin ファイルが見つかった
+		r.debugf("[QuickMode回復]: マーカー発見: %s", markerPath)
+
+		// 1. 元のファイル名と相対パスを取得
+		originalBaseName := strings.TrimSuffix(d.Name(), originSuffix)
+		relPath, err := filepath.Rel(dstRoot, filepath.Dir(markerPath))
+		if err != nil {
+			r.logger.Printf("警告 [QuickMode回復]: マーカー '%s' の相対パス計算失敗: %v。回復スキップ。", markerPath, err)
+			return nil // このマーカーは処理できない
+		}
+
+		// 2. 対応するソースファイルパスを構築
+		originalSourcePath := filepath.Join(srcRoot, relPath, originalBaseName)
+		processingSourcePath := originalSourcePath + processingSuffix
+
+		r.debugf("[QuickMode回復]: 対応ソース確認: '%s' (処理中名: '%s')", originalSourcePath, processingSourcePath)
+
+		// 3. .processing ファイルが存在するか確認
+		if _, err := os.Stat(processingSourcePath); os.IsNotExist(err) {
+			// .processing が存在しない -> 正常終了済みか、マーカーだけ残った異常状態
+			r.logger.Printf("情報 [QuickMode回復]: 対応する処理中ファイル '%s' が見つかりません。マーカー '%s' を削除します。", filepath.Base(processingSourcePath), filepath.Base(markerPath))
+			if errDel := os.Remove(markerPath); errDel != nil {
+				r.logger.Printf("警告 [QuickMode回復]: マーカー削除失敗 (%s): %v", markerPath, errDel)
+			}
+			return nil // 次のファイルへ
+		} else if err != nil {
+			// Stat で他のエラー
+			r.logger.Printf("警告 [QuickMode回復]: 処理中ファイル '%s' の状態確認エラー: %v。回復スキップ。", processingSourcePath, err)
+			return nil
+		}
+
+		// 4. .processing ファイルを元の名前にリネーム試行
+		r.logger.Printf("情報 [QuickMode回復]: 処理中ファイル '%s' を '%s' にリネーム試行...", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath))
+		if err := os.Rename(processingSourcePath, originalSourcePath); err != nil {
+			r.logger.Printf("エラー [QuickMode回復]: リネーム失敗 (%s -> %s): %v。手動での確認が必要です！", filepath.Base(processingSourcePath), filepath.Base(originalSourcePath), err)
+			failedCount++
+		} else {
+			// 5. リネーム成功 -> マーカーファイルを削除
+			r.logger.Printf("成功 [QuickMode回復]: リネーム完了。マーカー '%s' を削除します。", filepath.Base(markerPath))
+			if errDel := os.Remove(markerPath); errDel != nil {
+				r.logger.Printf("警告 [QuickMode回復]: リネーム成功後、マーカー削除失敗 (%s): %v", markerPath, errDel)
+				// リネームは成功したので recoveredCount は増やす
+			}
+			recoveredCount++
+		}
+		return nil // 次のファイルへ
+	})
+
+	if walkErr != nil {
+		r.logger.Printf("警告 [QuickMode回復]: ディレクトリ走査中に予期せぬエラー: %v", walkErr)
+	}
+	return recoveredCount, failedCount
+}
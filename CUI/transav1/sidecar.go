@@ -0,0 +1,202 @@
+package transav1
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// --- サイドカーファイル (Config.Sidecars) ---
+// 動画と同じディレクトリにあり、動画の拡張子を除いた名前に「.」または「-」が続く字幕・メタデータ・画像
+// (例: movie.mkv に対する movie.srt, movie.en.ass, movie.nfo, movie-poster.jpg) をサイドカーとして扱い、
+// 動画の処理が終わった後に、動画を配置した名前に合わせて名前を変えてコピーする (movie.srt -> movie_AV1.srt)。
+// 動画を元の名前で配置した場合 (AV1 ソースのコピー、-larger original) や配置しなかった場合は元の名前のままコピーする。
+// 複数の動画の名前に一致する場合は、最も長い名前の動画のサイドカーとする。
+
+// SidecarPolicy: サイドカーファイルの扱い (-sidecar)
+type SidecarPolicy string
+
+const (
+	SidecarRename SidecarPolicy = "rename" // 動画の出力名に合わせて名前を変えてコピーする
+	SidecarCopy   SidecarPolicy = "copy"   // 元の名前のままコピーする (その他のファイルと同じ)
+	SidecarMux    SidecarPolicy = "mux"    // 字幕・カバー画像を出力に多重化し、それ以外は rename と同じ
+)
+
+// ParseSidecarPolicy: -sidecar の指定値を解釈する (大文字小文字は区別しない)
+func ParseSidecarPolicy(s string) (SidecarPolicy, error) {
+	switch p := SidecarPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case SidecarRename, SidecarCopy, SidecarMux:
+		return p, nil
+	}
+	return "", fmt.Errorf("不明な扱い: '%s' (rename, copy, mux のいずれか)", s)
+}
+
+var (
+	// サイドカーとして扱う拡張子
+	sidecarExtensions = map[string]struct{}{
+		".srt": {}, ".ass": {}, ".ssa": {}, ".vtt": {}, ".sub": {}, ".idx": {}, ".sup": {}, // 字幕
+		".nfo": {}, ".xml": {}, // メタデータ
+		".jpg": {}, ".jpeg": {}, ".png": {}, ".webp": {}, ".tbn": {}, // ポスター・サムネイル
+	}
+	// 多重化できる字幕 (テキスト形式) の拡張子 -> コーデック (出力のコンテナに合わせて変換する, streams.go)
+	muxSubtitleExtensions = map[string]string{".srt": "subrip", ".ass": "ass", ".ssa": "ass", ".vtt": "webvtt"}
+	// カバー画像 (attached_pic) として多重化できる画像の拡張子 -> コーデック
+	muxPictureExtensions = map[string]string{".jpg": "mjpeg", ".jpeg": "mjpeg", ".png": "png"}
+)
+
+// matchSidecar: ファイル名がディレクトリ内の動画 (groups: 拡張子を除いた名前 (小文字) -> 入力のファイル名, 名前順)
+// のサイドカーであれば、その動画の入力のファイル名を返す
+func matchSidecar(name string, groups map[string][]string) (video string, ok bool) {
+	if _, known := sidecarExtensions[strings.ToLower(filepath.Ext(name))]; !known {
+		return "", false
+	}
+	lower := strings.ToLower(name)
+	best := ""
+	for stem := range groups {
+		if len(stem) > len(best) && (strings.HasPrefix(lower, stem+".") || strings.HasPrefix(lower, stem+"-")) {
+			best = stem
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return groups[best][0], true // 出力名が衝突した動画は、名前順で最初の動画に付ける
+}
+
+// sidecarOutput: サイドカーファイルの出力パス (動画の出力名に合わせる) と、対応する動画の出力パスを求める
+// ok: サイドカーでない、または動画の出力名が決まらない (CollisionFail) 場合は false
+// (実際のコピーは動画の処理後に copySidecars が、動画を配置した名前に合わせて行う)
+func (r *run) sidecarOutput(path, srcRoot, dstRoot string) (output, videoOutput string, ok bool) {
+	names, _ := r.dirNames(srcRoot, filepath.Dir(path))
+	base := filepath.Base(path)
+	video, ok := names.sidecars[base]
+	if !ok {
+		return "", "", false
+	}
+	videoOutput, err := r.outputPath(filepath.Join(filepath.Dir(path), video), srcRoot, dstRoot)
+	if err != nil {
+		return "", "", false
+	}
+	output, ok = sidecarName(base, video, videoOutput)
+	return output, videoOutput, ok
+}
+
+// sidecarName: 動画 (入力のファイル名 video) を placed に配置した場合のサイドカー (ファイル名 base) の出力パスを返す
+// (サイドカー名のうち動画の名前に一致する部分を、配置した動画の拡張子を除いた名前に置き換える)
+func sidecarName(base, video, placed string) (string, bool) {
+	n := len(strings.TrimSuffix(video, filepath.Ext(video))) // サイドカー名のうち動画の名前に一致する部分の長さ
+	if len(base) < n {
+		return "", false
+	}
+	return strings.TrimSuffix(placed, filepath.Ext(placed)) + base[n:], true
+}
+
+// videoSidecars: 動画のサイドカーのパスを名前順に返す (SidecarCopy の場合はその他のファイルとしてコピーするため nil)
+func (r *run) videoSidecars(inputFile, srcRoot string) []string {
+	if r.cfg.Sidecars == SidecarCopy {
+		return nil
+	}
+	dir := filepath.Dir(inputFile)
+	names, _ := r.dirNames(srcRoot, dir)
+	var sidecars []string
+	for name, video := range names.sidecars {
+		if video == filepath.Base(inputFile) {
+			sidecars = append(sidecars, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(sidecars)
+	return sidecars
+}
+
+// muxSidecars: 動画の出力に多重化するサイドカーのパスを返す (SidecarMux の場合のみ)
+// 字幕は全て、カバー画像は1つだけ (名前に poster または cover を含むものを優先) 選ぶ
+func (r *run) muxSidecars(inputFile, srcRoot string) []string {
+	if r.cfg.Sidecars != SidecarMux {
+		return nil
+	}
+	var subtitles, pictures []string
+	for _, sidecar := range r.videoSidecars(inputFile, srcRoot) {
+		ext := strings.ToLower(filepath.Ext(sidecar))
+		if _, ok := muxSubtitleExtensions[ext]; ok {
+			subtitles = append(subtitles, sidecar)
+		} else if _, ok := muxPictureExtensions[ext]; ok {
+			pictures = append(pictures, sidecar)
+		}
+	}
+	sort.Slice(pictures, func(i, j int) bool {
+		pi, pj := isCoverName(pictures[i]), isCoverName(pictures[j])
+		if pi != pj {
+			return pi
+		}
+		return pictures[i] < pictures[j]
+	})
+	if len(pictures) > 0 {
+		subtitles = append(subtitles, pictures[0])
+	}
+	return subtitles
+}
+
+// isCoverName: カバー画像らしい名前 (poster / cover を含む) か
+func isCoverName(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	return strings.Contains(name, "poster") || strings.Contains(name, "cover")
+}
+
+// willMux: その他のファイルが、動画の出力に多重化されるサイドカーか判定する (コピーを省く)
+func (r *run) willMux(path, srcRoot string) bool {
+	if r.cfg.Sidecars != SidecarMux {
+		return false
+	}
+	names, _ := r.dirNames(srcRoot, filepath.Dir(path))
+	video, ok := names.sidecars[filepath.Base(path)]
+	return ok && containsString(r.muxSidecars(filepath.Join(filepath.Dir(path), video), srcRoot), path)
+}
+
+// sidecarLanguage: 字幕のファイル名の言語コード (例: movie.jpn.srt -> "jpn", ISO 639-2 の3文字のみ)
+func sidecarLanguage(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	lang := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if len(lang) != 3 {
+		return ""
+	}
+	for _, c := range lang {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	return lang
+}
+
+// hasVideoFilter: エンコーダオプションに映像フィルタが含まれるか (カバー画像のストリームコピーと両立しない, streams.go)
+func hasVideoFilter(args []string) bool {
+	for _, a := range args {
+		if a == "-vf" || a == "-filter_complex" || strings.HasPrefix(a, "-filter:v") {
+			return true
+		}
+	}
+	return false
+}
+
+// copySidecars: 動画の処理後に、多重化しなかったサイドカーを動画を配置した名前 (job.placed) に合わせてコピーする
+// 動画を配置しなかった場合 (エンコード失敗、AV1 ソースのスキップなど) は、失われないよう元の名前のままコピーする
+func (r *run) copySidecars(job *videoJob) {
+	for _, sidecar := range job.sidecarFiles {
+		if containsString(job.muxed, sidecar) {
+			continue
+		}
+		base := filepath.Base(sidecar)
+		output := filepath.Join(job.outputDir, base)
+		if job.placed != "" {
+			if name, ok := sidecarName(base, filepath.Base(job.inputFile), job.placed); ok {
+				output = name
+			}
+		}
+		r.logger.Printf("コピー中 (サイドカー): %s -> %s", base, output)
+		if err := r.copyOtherFile(sidecar, output); err != nil {
+			errMsg := fmt.Sprintf("サイドカーのコピー失敗(%s): %v", base, err)
+			r.logger.Printf("エラー: %s", errMsg)
+			r.errors.add(errMsg)
+		}
+	}
+}
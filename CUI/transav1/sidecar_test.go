@@ -0,0 +1,104 @@
+package transav1
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchSidecar(t *testing.T) {
+	groups := map[string][]string{
+		"movie":       {"movie.mkv"},
+		"movie.part2": {"Movie.Part2.mp4"},
+		"clip":        {"clip.MKV", "clip.mov"},
+	}
+	tests := []struct {
+		name  string
+		video string // 空: サイドカーではない
+	}{
+		{name: "movie.srt", video: "movie.mkv"},
+		{name: "movie.jpn.srt", video: "movie.mkv"},
+		{name: "Movie.NFO", video: "movie.mkv"},
+		{name: "movie-poster.jpg", video: "movie.mkv"},
+		{name: "movie.part2.en.ass", video: "Movie.Part2.mp4"}, // 最も長い名前の動画
+		{name: "clip.srt", video: "clip.MKV"},                  // 出力名が衝突した動画は名前順で最初の動画
+		{name: "movie.txt"},                                    // サイドカーの拡張子ではない
+		{name: "movies.srt"},                                   // 名前の後が「.」「-」ではない
+		{name: "movie_poster.jpg"},
+		{name: "other.srt"},
+	}
+	for _, tt := range tests {
+		video, ok := matchSidecar(tt.name, groups)
+		if ok != (tt.video != "") || video != tt.video {
+			t.Errorf("matchSidecar(%q) = (%q, %v), want %q", tt.name, video, ok, tt.video)
+		}
+	}
+}
+
+// サイドカーは動画を実際に配置した名前に合わせてコピーする
+func TestCopySidecars(t *testing.T) {
+	tests := []struct {
+		name   string
+		placed string   // 動画を配置したファイル名 (空: 配置しなかった)
+		muxed  []string // 多重化したサイドカー
+		want   []string // 出力先にコピーされるファイル
+	}{
+		{
+			name:   "エンコードした出力",
+			placed: "movie_AV1.mp4",
+			want:   []string{"movie_AV1-poster.jpg", "movie_AV1.jpn.srt", "movie_AV1.nfo"},
+		},
+		{
+			name:   "多重化したサイドカーはコピーしない",
+			placed: "movie_AV1.mkv",
+			muxed:  []string{"movie.jpn.srt", "movie-poster.jpg"},
+			want:   []string{"movie_AV1.nfo"},
+		},
+		{
+			name:   "元のファイルをコピー (AV1 ソース, -larger original)",
+			placed: "movie.mkv",
+			want:   []string{"movie-poster.jpg", "movie.jpn.srt", "movie.nfo"},
+		},
+		{
+			name: "動画を配置しなかった (エンコード失敗など)",
+			want: []string{"movie-poster.jpg", "movie.jpn.srt", "movie.nfo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			sidecars := []string{"movie-poster.jpg", "movie.jpn.srt", "movie.nfo"}
+			writeFiles(t, src, append([]string{"movie.mkv"}, sidecars...)...)
+			r := newTestRun(t, DefaultConfig(), src, dst)
+
+			job := &videoJob{inputFile: filepath.Join(src, "movie.mkv"), outputDir: dst}
+			for _, name := range sidecars {
+				job.sidecarFiles = append(job.sidecarFiles, filepath.Join(src, name))
+			}
+			for _, name := range tt.muxed {
+				job.muxed = append(job.muxed, filepath.Join(src, name))
+			}
+			if tt.placed != "" {
+				job.placed = filepath.Join(dst, tt.placed)
+			}
+			r.copySidecars(job)
+
+			entries, err := os.ReadDir(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				if e.Name() != journalFileName {
+					got = append(got, e.Name())
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("出力先のファイル %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package transav1
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LargerPolicy: エンコード後の出力が十分に小さくならなかった場合の扱い (-larger)
+type LargerPolicy string
+
+const (
+	LargerOriginal LargerPolicy = "original" // 出力を破棄し、元のファイルをそのままコピーする
+	LargerRetry    LargerPolicy = "retry"    // チェーン中の最初の CPU エンコーダで -retryopt を使って1回だけ再エンコードする
+	LargerKeep     LargerPolicy = "keep"     // 出力をそのまま残し、実行サマリーとジャーナルに記録する
+	LargerOff      LargerPolicy = "off"      // 出力サイズを確認しない
+)
+
+// ParseLargerPolicy: -larger の指定値を解釈する (大文字小文字は区別しない)
+func ParseLargerPolicy(s string) (LargerPolicy, error) {
+	switch p := LargerPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case LargerOriginal, LargerRetry, LargerKeep, LargerOff:
+		return p, nil
+	}
+	return "", fmt.Errorf("不明な扱い: '%s' (original, retry, keep, off のいずれか)", s)
+}
+
+// applySizeGuard: エンコード成功後 (出力が最終パスに配置され、ソースが元の名前に戻った後) に
+// 入力に対する出力サイズの削減率を確認し、-minsaving を下回る場合は -larger の指定に従って処理する (LargerOff の場合は確認しない)
+// 戻り値:
+//   - retry: 出力を削除した。job.stage の CPU エンコーダで再エンコードすべき (ジョブは未準備状態に戻る)
+//   - handled: 出力を元ファイルのコピーに置き換え、ジャーナルへの記録も済ませた
+func (r *run) applySizeGuard(job *videoJob) (retry bool, handled bool, err error) {
+	if r.cfg.Larger == LargerOff || job.inputSize <= 0 || job.remux { // 再多重化 (AV1 ソース) は入力と同程度のサイズになるため対象外
+		return false, false, nil
+	}
+	info, statErr := os.Stat(job.outputFile)
+	if statErr != nil {
+		return false, false, nil
+	}
+	outputSize := info.Size()
+	saving := 1 - float64(outputSize)/float64(job.inputSize)
+	if saving >= r.cfg.MinSaving {
+		return false, false, nil
+	}
+
+	r.logger.Printf("警告: 出力サイズの削減率が基準を下回りました (%s -> %s, 削減率 %.1f%% < %.1f%%): %s",
+		FormatSize(job.inputSize), FormatSize(outputSize), saving*100, r.cfg.MinSaving*100, filepath.Base(job.outputFile))
+
+	policy := r.cfg.Larger
+	retryStage := r.retryStage()
+	if policy == LargerRetry && (job.sizeRetry || retryStage < 0) {
+		// 再エンコード済み、または CPU エンコーダがない場合は元ファイルを残す
+		if job.sizeRetry {
+			r.logger.Printf("情報: 再エンコード後も基準を満たさないため、元のファイルをコピーします: %s", filepath.Base(job.inputFile))
+		} else {
+			r.logger.Printf("情報: CPUエンコーダが指定されていないため再エンコードできません。元のファイルをコピーします: %s", filepath.Base(job.inputFile))
+		}
+		policy = LargerOriginal
+	}
+
+	switch policy {
+	case LargerKeep:
+		job.note = fmt.Sprintf("出力が基準より大きい (削減率 %.1f%%)", saving*100)
+		r.summary.add(summaryLargerKept, job.inputFile)
+		return false, false, nil
+
+	case LargerRetry:
+		r.logger.Printf("情報: CPUエンコーダ (%s) とオプション \"%s\" で再エンコードします: %s", r.cfg.Encoders[retryStage].Name, r.cfg.RetryOptions, filepath.Base(job.inputFile))
+		if err := os.Remove(job.outputFile); err != nil {
+			return false, true, fmt.Errorf("再エンコード前の出力削除失敗 (%s): %w", job.outputFile, err)
+		}
+		job.sizeRetry = true
+		job.stage = retryStage
+		job.prepared = false
+		r.summary.add(summaryLargerRetried, job.inputFile)
+		return true, false, nil
+	}
+
+	// --- 元ファイルをコピー (LargerOriginal) ---
+	if err := os.Remove(job.outputFile); err != nil {
+		return false, true, fmt.Errorf("出力削除失敗 (%s): %w", job.outputFile, err)
+	}
+	copyPath := filepath.Join(job.outputDir, filepath.Base(job.inputFile))
+	if err := r.copyOtherFile(job.inputFile, copyPath); err != nil {
+		r.journal.record(journalEntry{Source: job.inputFile, Output: job.outputFile, State: stateFailed, Error: err.Error(), InputSize: job.inputSize})
+		return false, true, err
+	}
+	r.logger.Printf("元のファイルをコピーしました: %s", filepath.Base(copyPath))
+	job.placed = copyPath
+	var copySize int64
+	if info, err := os.Stat(copyPath); err == nil {
+		copySize = info.Size()
+	}
+	r.journal.record(journalEntry{
+		Source: job.inputFile, Output: copyPath, State: stateDone,
+		Encoder: job.usedEncoder, Options: job.usedOptions, Attempts: job.attempts,
+		InputSize: job.inputSize, OutputSize: copySize,
+		Note: fmt.Sprintf("出力が基準より大きいため元のファイルをコピー (削減率 %.1f%%)", saving*100),
+	})
+	r.summary.add(summaryLargerOriginal, job.inputFile)
+	return false, true, nil
+}
@@ -0,0 +1,248 @@
+package transav1
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileState: 進捗状況 (TreeStatus) での動画ごとの状態
+type FileState string
+
+const (
+	FileDone       FileState = "done"        // 変換済み (再多重化・元のファイルのコピーを含む)
+	FileFailed     FileState = "failed"      // 失敗 (失敗マーカーあり)
+	FileTimeout    FileState = "timeout"     // タイムアウト
+	FileInProgress FileState = "in_progress" // エンコード中、または中断されたまま (.processing / .origin)
+	FilePending    FileState = "pending"     // 未処理
+	FileSkipped    FileState = "skipped"     // 出力を作成せずにスキップした (AV1 ソースなど)
+)
+
+// FileStates: 全ての状態 (表示順)
+var FileStates = []FileState{FileDone, FileFailed, FileTimeout, FileInProgress, FilePending, FileSkipped}
+
+// FileStatus: 動画1件の状態
+type FileStatus struct {
+	Source     string    `json:"source"`                // 入力元ルートからの相対パス (スラッシュ区切り)
+	Output     string    `json:"output"`                // 出力先ルートからの相対パス (スラッシュ区切り)
+	State      FileState `json:"state"`                 // 状態
+	Marker     string    `json:"marker,omitempty"`      // 失敗マーカーのサフィックス (例: ".failed_1")
+	ExitCode   *int      `json:"exit_code,omitempty"`   // ffmpeg の終了コード (失敗マーカー・ジャーナルから分かる場合)
+	Detail     string    `json:"detail,omitempty"`      // エラー内容などの補足
+	InputSize  int64     `json:"input_size"`            // 入力ファイルサイズ (バイト)
+	OutputSize int64     `json:"output_size,omitempty"` // 出力ファイルサイズ (バイト, 変換済みの場合)
+}
+
+// StateTotal: 状態ごとの件数と入力の合計サイズ
+type StateTotal struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"` // 入力ファイルの合計サイズ (バイト)
+}
+
+// StatusReport: 入力元と出力先を照合した進捗状況
+type StatusReport struct {
+	Source      string                   `json:"source"`       // 入力元ディレクトリ
+	Dest        string                   `json:"dest"`         // 出力先ディレクトリ
+	Journal     bool                     `json:"journal"`      // ジャーナルを参照したか
+	Total       StateTotal               `json:"total"`        // 全ての動画
+	States      map[FileState]StateTotal `json:"states"`       // 状態ごとの集計 (全ての状態を含む)
+	OutputBytes int64                    `json:"output_bytes"` // 変換済みの動画の出力の合計サイズ
+	SavedBytes  int64                    `json:"saved_bytes"`  // 変換済みの動画の入力と出力の差 (削減できた容量)
+	Files       []FileStatus             `json:"files"`        // 動画ごとの状態 (入力元の走査順)
+	Elapsed     time.Duration            `json:"-"`            // 集計にかかった時間
+}
+
+// TreeStatus: srcDir 以下の動画それぞれについて、出力先 (getOutputPath)、マーカーファイル、ジャーナルを照合して
+// 状態を分類し、件数・サイズ・削減できた容量を集計する (ファイルの変更は行わず、ffmpeg も使用しない)
+// ジャーナルがある場合はその記録を優先し、ジャーナル導入前の出力先ではマーカーファイルと出力の有無から判定する。
+func TreeStatus(ctx context.Context, cfg Config, srcDir, dstDir string) (*StatusReport, error) {
+	c, err := newMaintenanceConverter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDir(srcDir, "入力元"); err != nil {
+		return nil, err
+	}
+	if err := requireDir(dstDir, "出力先"); err != nil {
+		return nil, err
+	}
+	r, err := c.openRun(ctx, srcDir, dstDir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	rep := &StatusReport{Source: srcDir, Dest: dstDir, Journal: r.journal.hasHistory(), States: make(map[FileState]StateTotal)}
+	for _, s := range FileStates {
+		rep.States[s] = StateTotal{}
+	}
+	markers := newMarkerIndex()
+	walkErr := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.logger.Printf("警告: ディレクトリ/ファイル '%s' へのアクセスエラー: %v。スキップします。", path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if r.isNestedDst(path, d) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			if c.filter.excluded(srcDir, path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// QuickMode でエンコード中の入力は「元の名前.processing」になっている
+		inputFile, processing := strings.CutSuffix(path, processingSuffix)
+		if c.filter.excluded(srcDir, inputFile, false) {
+			return nil
+		}
+		// 拡張子が未知でも、変換時に内容から動画と判定 (Config.Sniff) した入力はジャーナルの記録で数える
+		class, known := c.classes.classOf(inputFile)
+		if _, recorded := r.journal.lookup(inputFile); !known && recorded {
+			class = ClassEncode
+		}
+		if class != ClassEncode {
+			return nil
+		}
+		if !processing && r.fileExists(inputFile+processingSuffix) {
+			return nil // 同名の .processing 側で数える (回復失敗などで両方ある場合)
+		}
+		outputFile, err := r.outputPath(inputFile, srcDir, dstDir)
+		if err != nil {
+			c.logger.Printf("警告: 出力パス計算失敗 (%s): %v。スキップします。", inputFile, err)
+			return nil
+		}
+		outputFile = r.existingOutput(outputFile)
+		fst := r.fileStatus(inputFile, outputFile, processing, markers)
+		if info, err := d.Info(); err == nil {
+			fst.InputSize = info.Size()
+		}
+		rep.add(fst)
+		return nil
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("入力元の走査中にエラーが発生: %w", walkErr)
+	}
+	rep.Elapsed = time.Since(r.startTime)
+	return rep, nil
+}
+
+// add: 動画1件の状態を集計に加える
+func (rep *StatusReport) add(fst FileStatus) {
+	rep.Files = append(rep.Files, fst)
+	st := rep.States[fst.State]
+	st.Count++
+	st.Bytes += fst.InputSize
+	rep.States[fst.State] = st
+	rep.Total.Count++
+	rep.Total.Bytes += fst.InputSize
+	if fst.State == FileDone {
+		rep.OutputBytes += fst.OutputSize
+		rep.SavedBytes += fst.InputSize - fst.OutputSize
+	}
+}
+
+// fileStatus: 入力ファイル1件の状態を判定する
+// processing: 入力元で「.processing」の名前になっていたか
+func (r *run) fileStatus(inputFile, outputFile string, processing bool, markers *markerIndex) FileStatus {
+	fst := FileStatus{Source: r.journal.key(inputFile), Output: r.journal.outputKey(outputFile)}
+	originMarker := filepath.Join(filepath.Dir(outputFile), filepath.Base(inputFile)+originSuffix)
+
+	// --- エンコード中・中断 (QuickMode の作業状態が残っている) ---
+	if processing || r.fileExists(originMarker) {
+		fst.State = FileInProgress
+		fst.Detail = "QuickMode の作業状態が残っています (エンコード中でなければ recover で回復できます)"
+		return fst
+	}
+
+	// --- ジャーナルの記録を優先する ---
+	if e, ok := r.journal.lookup(inputFile); ok {
+		fst.Output = e.Output
+		fst.Marker, fst.ExitCode, fst.Detail = e.Marker, e.ExitCode, e.Error
+		switch e.State {
+		case stateDone:
+			if info, err := os.Stat(r.journal.outputPath(e)); err == nil && info.Size() > 0 {
+				fst.State, fst.OutputSize, fst.Detail = FileDone, info.Size(), e.Note
+			} else {
+				fst.State, fst.Detail = FilePending, "ジャーナル上は変換済みですが、出力が見つかりません"
+			}
+		case stateFailed:
+			fst.State = FileFailed
+		case stateTimeout:
+			fst.State = FileTimeout
+		case stateEncoding:
+			fst.State, fst.Detail = FileInProgress, "エンコード中、または中断されました"
+		case stateSkipped:
+			fst.State, fst.Detail = FileSkipped, e.Note
+		default:
+			fst.State, fst.Detail = FilePending, e.Note
+		}
+		return fst
+	}
+
+	// --- ジャーナルに記録がない: マーカーファイルと出力の有無から判定する ---
+	if suffix := markers.find(outputFile); suffix != "" {
+		fst.Marker = suffix
+		fst.State = FileFailed
+		if suffix == ".timeout" {
+			fst.State = FileTimeout
+		}
+		if code, err := strconv.Atoi(strings.TrimPrefix(suffix, ".failed_")); err == nil {
+			fst.ExitCode = &code
+		}
+		return fst
+	}
+	if info, err := os.Stat(outputFile); err == nil && !info.IsDir() && info.Size() > 0 {
+		fst.State, fst.OutputSize = FileDone, info.Size()
+		return fst
+	}
+	fst.State = FilePending
+	return fst
+}
+
+// markerIndex: 出力先ディレクトリごとのファイル名一覧 (失敗マーカーの検索用, ディレクトリは1回だけ読み込む)
+type markerIndex struct {
+	dirs map[string][]string
+}
+
+// newMarkerIndex: 空の markerIndex を作成する
+func newMarkerIndex() *markerIndex {
+	return &markerIndex{dirs: make(map[string][]string)}
+}
+
+// find: 出力ファイルに対応する失敗マーカー (「出力ファイル名.failed_1」など) を探し、サフィックスを返す (なければ空文字)
+func (m *markerIndex) find(outputFile string) string {
+	dir := filepath.Dir(outputFile)
+	names, ok := m.dirs[dir]
+	if !ok {
+		entries, _ := os.ReadDir(dir) // 出力先ディレクトリがなければマーカーもない
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		m.dirs[dir] = names
+	}
+	prefix := filepath.Base(outputFile)
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		for _, marker := range failedMarkersToDelete {
+			if suffix == marker || (marker == ".failed_" && strings.HasPrefix(suffix, marker)) {
+				return suffix
+			}
+		}
+	}
+	return ""
+}
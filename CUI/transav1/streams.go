@@ -0,0 +1,281 @@
+package transav1
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --- 出力に含めるストリーム (Config.Streams) ---
+// executeFFmpeg は入力のストリームを -map で明示的に選び、種類ごとにコーデックを指定する。
+// 選択は入力の ffprobe の結果から決めるため、ffprobe がない場合は最初の映像と全ての音声のみとなる。
+
+// StreamPolicy: 出力に含める入力のストリームの選び方 (-streams)
+type StreamPolicy string
+
+const (
+	StreamsAll      StreamPolicy = "all"   // 全ての映像・音声・字幕・カバー画像 (出力のコンテナに格納できないものは除く)
+	StreamsAudio    StreamPolicy = "audio" // 最初の映像と全ての音声
+	StreamsLanguage StreamPolicy = "lang"  // 最初の映像と、Config.Languages の言語の音声・字幕
+	StreamsFirst    StreamPolicy = "first" // 最初の映像と最初の音声 (従来の ffmpeg の既定の選択に相当)
+)
+
+// ストリームごとのコーデックの指定 (Config.AudioCodec / Config.SubtitleCodec) のうち、エンコーダ名以外の値
+const (
+	CodecAuto = "auto" // 出力のコンテナに格納できるものはコピーし、それ以外は変換する (格納できない字幕は除外)
+	CodecCopy = "copy" // 常にコピーする
+	CodecNone = "none" // 出力に含めない (字幕のみ)
+)
+
+// ParseStreamPolicy: -streams の指定値を解釈する (大文字小文字は区別しない)
+func ParseStreamPolicy(s string) (StreamPolicy, error) {
+	switch p := StreamPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case StreamsAll, StreamsAudio, StreamsLanguage, StreamsFirst:
+		return p, nil
+	}
+	return "", fmt.Errorf("不明なストリームの選び方: '%s' (all, audio, lang, first のいずれか)", s)
+}
+
+// parseCodecChoice: -acodec / -scodec の指定値を解釈する (auto, copy, none は小文字に正規化し、それ以外はエンコーダ名とみなす)
+func parseCodecChoice(s, kind string, allowNone bool) (string, error) {
+	s = strings.TrimSpace(s)
+	switch lower := strings.ToLower(s); {
+	case lower == CodecAuto || lower == CodecCopy || (allowNone && lower == CodecNone):
+		return lower, nil
+	case lower == CodecNone:
+		return "", fmt.Errorf("%sのコーデックに none は指定できません", kind)
+	case s == "" || strings.HasPrefix(s, "-") || strings.ContainsAny(s, " \t"):
+		return "", fmt.Errorf("%sのコーデックが不正です: '%s' (auto, copy またはエンコーダ名)", kind, s)
+	}
+	return s, nil
+}
+
+// normalizeLanguages: 言語コードの一覧を小文字に正規化する (空の要素は除く)
+func normalizeLanguages(langs []string) []string {
+	var out []string
+	for _, lang := range langs {
+		if lang = strings.ToLower(strings.TrimSpace(lang)); lang != "" && !containsString(out, lang) {
+			out = append(out, lang)
+		}
+	}
+	return out
+}
+
+// textSubtitleCodecs: テキスト形式の字幕 (別のテキスト字幕に変換できる) のコーデック
+var textSubtitleCodecs = codecSet("subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text", "microdvd", "subviewer", "sami")
+
+// streamMapping: executeFFmpeg に渡すストリームの選択
+type streamMapping struct {
+	sidecars []string     // 追加の入力 (入力 1 以降) として多重化するサイドカー
+	args     []string     // -map とストリームごとのコーデック・メタデータの指定 (映像のエンコーダは executeFFmpeg が指定する)
+	counts   streamCounts // 出力に含まれるストリーム数 (出力の検証用)
+	pictures int          // 出力に含まれるカバー画像の数 (映像の出力ストリーム番号の計算用)
+	dropped  []string     // 出力に含めない入力のストリームの説明 (ログ用)
+	// incompatible: 出力のコンテナにそのまま (コピーで) 格納できないため、変換または除外した入力のストリーム (ContainerAuto の判定用)
+	incompatible []string
+}
+
+// mapStreams: 入力のメディア情報と Config.Streams などから、出力に含めるストリームとコーデックを決める
+// info: 入力の ffprobe の結果 (nil の場合は最初の映像と全ての音声を選ぶ)
+// copyVideo: 映像を再エンコードせずにコピーする (AV1 ソースの再多重化)
+// filtered: 映像フィルタを使用する (ストリームコピーのカバー画像と両立しないため、カバー画像を含めない)
+// sidecars: 多重化するサイドカー (格納できないものは streamMapping.sidecars に含めない)
+func (c *Converter) mapStreams(info *mediaInfo, outputPath string, copyVideo, filtered bool, sidecars []string) streamMapping {
+	ct := containerFor(outputPath)
+	var m streamMapping
+	if info == nil {
+		m.args = []string{"-map", "0:V:0", "-map", "0:a?", "-c:a", c.audioCodec("", ct)}
+		if c.cfg.Streams == StreamsFirst {
+			m.args[3] = "0:a:0?"
+		}
+	} else {
+		m = c.mapInputStreams(info, ct, copyVideo, filtered)
+	}
+
+	// --- サイドカー (入力 1 以降) ---
+	for _, sidecar := range sidecars {
+		input := strconv.Itoa(len(m.sidecars) + 1)
+		ext := strings.ToLower(filepath.Ext(sidecar))
+		if codec, ok := muxSubtitleExtensions[ext]; ok {
+			enc := c.subtitleCodec(codec, ct, true)
+			if enc == "" {
+				continue
+			}
+			m.args = append(m.args, "-map", input+":0", fmt.Sprintf("-c:s:%d", m.counts.subtitle), enc)
+			if lang := sidecarLanguage(sidecar); lang != "" {
+				m.args = append(m.args, fmt.Sprintf("-metadata:s:s:%d", m.counts.subtitle), "language="+lang)
+			}
+			m.counts.subtitle++
+		} else if codec := muxPictureExtensions[ext]; !filtered && ct.pictures[codec] {
+			n := m.counts.video + m.pictures
+			m.args = append(m.args, "-map", input+":0", fmt.Sprintf("-c:v:%d", n), "copy", fmt.Sprintf("-disposition:v:%d", n), "attached_pic")
+			m.pictures++
+		} else {
+			continue
+		}
+		m.sidecars = append(m.sidecars, sidecar)
+	}
+
+	// --- メタデータとチャプター ---
+	if c.cfg.NoMetadata {
+		m.args = append(m.args, "-map_metadata", "-1", "-map_chapters", "-1")
+	} else {
+		m.args = append(m.args, "-map_metadata", "0", "-map_chapters", "0")
+	}
+	return m
+}
+
+// mapInputStreams: 入力 (入力 0) のストリームを ffprobe の結果から選ぶ
+func (c *Converter) mapInputStreams(info *mediaInfo, ct containerFormat, copyVideo, filtered bool) streamMapping {
+	var m streamMapping
+	policy := c.cfg.Streams
+	// 言語で選ぶ場合、一致する音声がなければ無音にならないよう最初の音声を残す
+	audioMatched := false
+	if policy == StreamsLanguage {
+		for _, st := range info.Streams {
+			if st.CodecType == "audio" && c.languageSelected(st) {
+				audioMatched = true
+				break
+			}
+		}
+	}
+	attachments := false
+	drop := func(st probeStream, reason string) {
+		m.dropped = append(m.dropped, fmt.Sprintf("#%d %s (%s): %s", st.Index, st.CodecType, st.CodecName, reason))
+	}
+	incompatible := func(st probeStream) {
+		m.incompatible = append(m.incompatible, fmt.Sprintf("#%d %s (%s)", st.Index, st.CodecType, st.CodecName))
+	}
+
+	for _, st := range info.Streams {
+		input := "0:" + strconv.Itoa(st.Index)
+		switch st.CodecType {
+		case "video":
+			if st.isAttachedPicture() {
+				switch {
+				case policy != StreamsAll:
+					continue
+				case filtered && !copyVideo:
+					drop(st, "映像フィルタを使用するため")
+					continue
+				case !ct.pictures[st.CodecName]:
+					drop(st, ct.name+" に格納できないカバー画像")
+					continue
+				}
+				n := m.counts.video + m.pictures
+				m.args = append(m.args, "-map", input, fmt.Sprintf("-c:v:%d", n), "copy")
+				m.pictures++
+				continue
+			}
+			if m.counts.video > 0 && policy != StreamsAll {
+				continue
+			}
+			m.args = append(m.args, "-map", input) // コーデックは executeFFmpeg の -c:v (エンコーダまたは copy)
+			m.counts.video++
+		case "audio":
+			switch {
+			case policy == StreamsFirst && m.counts.audio > 0:
+				continue
+			case policy == StreamsLanguage && audioMatched && !c.languageSelected(st):
+				continue
+			case policy == StreamsLanguage && !audioMatched && m.counts.audio > 0:
+				continue
+			}
+			if (c.cfg.AudioCodec == CodecAuto || c.cfg.AudioCodec == CodecCopy) && !ct.copiesAudio(st.CodecName) {
+				incompatible(st)
+			}
+			m.args = append(m.args, "-map", input, fmt.Sprintf("-c:a:%d", m.counts.audio), c.audioCodec(st.CodecName, ct))
+			m.counts.audio++
+		case "subtitle":
+			if policy != StreamsAll && (policy != StreamsLanguage || !c.languageSelected(st)) {
+				continue
+			}
+			if (c.cfg.SubtitleCodec == CodecAuto || c.cfg.SubtitleCodec == CodecCopy) && !ct.subtitles[st.CodecName] {
+				incompatible(st)
+			}
+			enc := c.subtitleCodec(st.CodecName, ct, false)
+			if enc == "" {
+				if c.cfg.SubtitleCodec != CodecNone {
+					drop(st, ct.name+" に格納できない字幕")
+				}
+				continue
+			}
+			m.args = append(m.args, "-map", input, fmt.Sprintf("-c:s:%d", m.counts.subtitle), enc)
+			m.counts.subtitle++
+		case "attachment":
+			if policy != StreamsAll {
+				continue
+			}
+			if !ct.attachments {
+				incompatible(st)
+				drop(st, ct.name+" に格納できない添付ファイル")
+				continue
+			}
+			m.args = append(m.args, "-map", input)
+			attachments = true
+		default: // data など
+			if policy == StreamsAll {
+				drop(st, "対応していない種類のストリーム")
+			}
+		}
+	}
+	if attachments {
+		m.args = append(m.args, "-c:t", "copy")
+	}
+	return m
+}
+
+// languageSelected: ストリームの言語が Config.Languages に含まれるか
+func (c *Converter) languageSelected(st probeStream) bool {
+	for key, value := range st.Tags {
+		if strings.EqualFold(key, "language") {
+			return containsString(c.cfg.Languages, strings.ToLower(value))
+		}
+	}
+	return false
+}
+
+// audioCodec: 音声のコーデック (codec: 入力のコーデック, 空の場合は不明) に対するエンコーダを返す
+func (c *Converter) audioCodec(codec string, ct containerFormat) string {
+	switch c.cfg.AudioCodec {
+	case CodecAuto:
+		if ct.copiesAudio(codec) {
+			return CodecCopy
+		}
+		return ct.fallbackAudio
+	default: // copy またはエンコーダ名
+		return c.cfg.AudioCodec
+	}
+}
+
+// subtitleCodec: 字幕のコーデックに対するエンコーダを返す (空: 出力に含めない)
+// sidecar: 多重化するサイドカー (-sidecar mux で指定されたため、none の場合も自動で選ぶ)
+func (c *Converter) subtitleCodec(codec string, ct containerFormat, sidecar bool) string {
+	choice := c.cfg.SubtitleCodec
+	if sidecar && choice == CodecNone {
+		choice = CodecAuto
+	}
+	switch choice {
+	case CodecNone:
+		return ""
+	case CodecCopy:
+		return CodecCopy
+	case CodecAuto:
+		if ct.subtitles[codec] {
+			return CodecCopy
+		}
+		if textSubtitleCodecs[codec] {
+			return ct.textSubtitle
+		}
+		return ""
+	default: // エンコーダ名 (テキスト字幕のみ変換し、画像の字幕は格納できればコピーする)
+		if textSubtitleCodecs[codec] {
+			return choice
+		}
+		if ct.subtitles[codec] {
+			return CodecCopy
+		}
+		return ""
+	}
+}
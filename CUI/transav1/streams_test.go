@@ -0,0 +1,222 @@
+package transav1
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapStreams(t *testing.T) {
+	lang := func(l string) map[string]string { return map[string]string{"language": l} }
+	multi := &mediaInfo{Streams: []probeStream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "audio", CodecName: "dts", Tags: lang("jpn")},
+		{Index: 2, CodecType: "audio", CodecName: "ac3", Tags: lang("eng")},
+		{Index: 3, CodecType: "subtitle", CodecName: "ass", Tags: lang("JPN")},
+		{Index: 4, CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle", Tags: lang("eng")},
+		{Index: 5, CodecType: "attachment", CodecName: "ttf"},
+		{Index: 6, CodecType: "video", CodecName: "mjpeg", Disposition: map[string]int{"attached_pic": 1}},
+	}}
+	simple := &mediaInfo{Streams: []probeStream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "audio", CodecName: "aac"},
+	}}
+	dir := filepath.Join("src", "movies")
+	srt, poster, nfo := filepath.Join(dir, "movie.jpn.srt"), filepath.Join(dir, "movie-poster.jpg"), filepath.Join(dir, "movie.nfo")
+	const meta = " -map_metadata 0 -map_chapters 0"
+
+	tests := []struct {
+		name         string
+		streams      StreamPolicy // 空: 既定 (all)
+		languages    []string
+		audioCodec   string // 空: 既定 (auto)
+		subCodec     string // 空: 既定 (auto)
+		noMetadata   bool
+		info         *mediaInfo
+		output       string
+		filtered     bool
+		sidecars     []string
+		wantArgs     string
+		wantCounts   streamCounts
+		wantPictures int
+		wantSidecars []string
+		dropped      int // 除外したストリームの数
+		incompatible int // 出力のコンテナにそのまま格納できないストリームの数
+	}{
+		{
+			name:     "ffprobe の結果なし (mp4)",
+			output:   "movie_AV1.mp4",
+			wantArgs: "-map 0:V:0 -map 0:a? -c:a aac" + meta,
+		},
+		{
+			name:     "ffprobe の結果なし (mkv は音声をコピー)",
+			output:   "movie_AV1.mkv",
+			wantArgs: "-map 0:V:0 -map 0:a? -c:a copy" + meta,
+		},
+		{
+			name:     "ffprobe の結果なし (first)",
+			streams:  StreamsFirst,
+			output:   "movie_AV1.mp4",
+			wantArgs: "-map 0:V:0 -map 0:a:0? -c:a aac" + meta,
+		},
+		{
+			name:       "メタデータとチャプターを含めない",
+			noMetadata: true,
+			output:     "movie_AV1.mp4",
+			wantArgs:   "-map 0:V:0 -map 0:a? -c:a aac -map_metadata -1 -map_chapters -1",
+		},
+		{
+			name:         "all (mkv は全てコピー)",
+			info:         multi,
+			output:       "movie_AV1.mkv",
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 copy -map 0:2 -c:a:1 copy -map 0:3 -c:s:0 copy -map 0:4 -c:s:1 copy -map 0:5 -map 0:6 -c:v:1 copy -c:t copy" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 2, subtitle: 2},
+			wantPictures: 1,
+		},
+		{
+			name:         "all (mp4 に格納できないものは変換・除外)",
+			info:         multi,
+			output:       "movie_AV1.mp4",
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 aac -map 0:2 -c:a:1 copy -map 0:3 -c:s:0 mov_text -map 0:6 -c:v:1 copy" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 2, subtitle: 1},
+			wantPictures: 1,
+			dropped:      2, // PGS 字幕, フォント
+			incompatible: 4, // DTS 音声, ASS 字幕, PGS 字幕, フォント
+		},
+		{
+			name:         "all (webm)",
+			info:         multi,
+			output:       "movie_AV1.webm",
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 libopus -map 0:2 -c:a:1 libopus -map 0:3 -c:s:0 webvtt" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 2, subtitle: 1},
+			dropped:      3,
+			incompatible: 5,
+		},
+		{
+			name:         "映像フィルタ使用時はカバー画像を除く",
+			info:         multi,
+			output:       "movie_AV1.mp4",
+			filtered:     true,
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 aac -map 0:2 -c:a:1 copy -map 0:3 -c:s:0 mov_text" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 2, subtitle: 1},
+			dropped:      3,
+			incompatible: 4,
+		},
+		{
+			name:         "字幕を含めない (-scodec none)",
+			subCodec:     CodecNone,
+			info:         multi,
+			output:       "movie_AV1.mp4",
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 aac -map 0:2 -c:a:1 copy -map 0:6 -c:v:1 copy" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 2},
+			wantPictures: 1,
+			dropped:      1,
+			incompatible: 2,
+		},
+		{
+			name:       "audio (音声のエンコーダを指定)",
+			streams:    StreamsAudio,
+			audioCodec: "libopus",
+			info:       multi,
+			output:     "movie_AV1.mkv",
+			wantArgs:   "-map 0:0 -map 0:1 -c:a:0 libopus -map 0:2 -c:a:1 libopus" + meta,
+			wantCounts: streamCounts{video: 1, audio: 2},
+		},
+		{
+			name:       "lang (一致する言語の音声・字幕)",
+			streams:    StreamsLanguage,
+			languages:  []string{"jpn"},
+			info:       multi,
+			output:     "movie_AV1.mkv",
+			wantArgs:   "-map 0:0 -map 0:1 -c:a:0 copy -map 0:3 -c:s:0 copy" + meta,
+			wantCounts: streamCounts{video: 1, audio: 1, subtitle: 1},
+		},
+		{
+			name:       "lang (一致する音声がなければ最初の音声)",
+			streams:    StreamsLanguage,
+			languages:  []string{"fra"},
+			info:       multi,
+			output:     "movie_AV1.mkv",
+			wantArgs:   "-map 0:0 -map 0:1 -c:a:0 copy" + meta,
+			wantCounts: streamCounts{video: 1, audio: 1},
+		},
+		{
+			name:         "first",
+			streams:      StreamsFirst,
+			info:         multi,
+			output:       "movie_AV1.mp4",
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 aac" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 1},
+			incompatible: 1,
+		},
+		{
+			name:         "サイドカーの多重化",
+			info:         simple,
+			output:       "movie_AV1.mp4",
+			sidecars:     []string{srt, poster, nfo},
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 copy -map 1:0 -c:s:0 mov_text -metadata:s:s:0 language=jpn -map 2:0 -c:v:1 copy -disposition:v:1 attached_pic" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 1, subtitle: 1},
+			wantPictures: 1,
+			wantSidecars: []string{srt, poster},
+		},
+		{
+			name:         "サイドカーの字幕は -scodec none でも多重化",
+			subCodec:     CodecNone,
+			info:         simple,
+			output:       "movie_AV1.mkv",
+			filtered:     true,
+			sidecars:     []string{srt, poster},
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 copy -map 1:0 -c:s:0 copy -metadata:s:s:0 language=jpn" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 1, subtitle: 1},
+			wantSidecars: []string{srt},
+		},
+		{
+			name:         "webm にはカバー画像を多重化しない",
+			info:         simple,
+			output:       "movie_AV1.webm",
+			sidecars:     []string{poster, srt},
+			wantArgs:     "-map 0:0 -map 0:1 -c:a:0 libopus -map 1:0 -c:s:0 webvtt -metadata:s:s:0 language=jpn" + meta,
+			wantCounts:   streamCounts{video: 1, audio: 1, subtitle: 1},
+			wantSidecars: []string{srt},
+			incompatible: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if tt.streams != "" {
+				cfg.Streams = tt.streams
+			}
+			if tt.audioCodec != "" {
+				cfg.AudioCodec = tt.audioCodec
+			}
+			if tt.subCodec != "" {
+				cfg.SubtitleCodec = tt.subCodec
+			}
+			cfg.Languages = tt.languages
+			cfg.NoMetadata = tt.noMetadata
+			c := &Converter{cfg: cfg}
+
+			m := c.mapStreams(tt.info, tt.output, false, tt.filtered, tt.sidecars)
+			if got := strings.Join(m.args, " "); got != tt.wantArgs {
+				t.Errorf("args:\n got  %s\n want %s", got, tt.wantArgs)
+			}
+			if m.counts != tt.wantCounts {
+				t.Errorf("counts = %+v, want %+v", m.counts, tt.wantCounts)
+			}
+			if m.pictures != tt.wantPictures {
+				t.Errorf("pictures = %d, want %d", m.pictures, tt.wantPictures)
+			}
+			if !reflect.DeepEqual(m.sidecars, tt.wantSidecars) {
+				t.Errorf("sidecars = %v, want %v", m.sidecars, tt.wantSidecars)
+			}
+			if len(m.dropped) != tt.dropped {
+				t.Errorf("dropped = %v, want %d 件", m.dropped, tt.dropped)
+			}
+			if len(m.incompatible) != tt.incompatible {
+				t.Errorf("incompatible = %v, want %d 件", m.incompatible, tt.incompatible)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package transav1
+
+import (
+	"log"
+	"sort"
+	"sync"
+)
+
+// --- 実行サマリーの項目 (キーは run_finished イベントでも使用する安定した名前) ---
+const (
+	summaryAV1Skipped = "av1_skipped" // AV1 ソースをスキップ
+	summaryAV1Copied  = "av1_copied"  // AV1 ソースをそのままコピー
+	summaryAV1Remuxed = "av1_remuxed" // AV1 ソースを再エンコードせずに再多重化
+
+	summaryLargerOriginal = "larger_original" // 出力が基準より大きいため元ファイルをコピー
+	summaryLargerRetried  = "larger_retried"  // 出力が基準より大きいため CPU で再エンコード
+	summaryLargerKept     = "larger_kept"     // 出力が基準より大きいがそのまま残した
+
+	summaryImageCopied = "image_copied" // 静止画を変換できなかったため元ファイルをコピー
+	summaryRenamed     = "renamed"      // 出力名の衝突により出力名を変更した
+
+	summaryInterrupted = "interrupted" // 中断により作業状態を元に戻した
+)
+
+// summaryLabels: 実行サマリーの項目のログ表示名
+var summaryLabels = map[string]string{
+	summaryAV1Skipped: "AV1 ソース (スキップ)",
+	summaryAV1Copied:  "AV1 ソース (コピー)",
+	summaryAV1Remuxed: "AV1 ソース (再多重化)",
+
+	summaryLargerOriginal: "出力が基準より大きい (元ファイルをコピー)",
+	summaryLargerRetried:  "出力が基準より大きい (CPU で再エンコード)",
+	summaryLargerKept:     "出力が基準より大きい (そのまま保持)",
+
+	summaryImageCopied: "画像を変換できない (元ファイルをコピー)",
+	summaryRenamed:     "出力名の衝突 (出力名を変更)",
+
+	summaryInterrupted: "中断 (作業状態を元に戻した)",
+}
+
+// runSummary: 終了時に出力する実行サマリー (成功・失敗以外の特記事項をファイル単位で集計する)
+// 複数のエンコードワーカーから同時に呼び出される
+type runSummary struct {
+	mu    sync.Mutex
+	items map[string][]string
+}
+
+// newRunSummary: 空の実行サマリーを作成する
+func newRunSummary() *runSummary {
+	return &runSummary{items: make(map[string][]string)}
+}
+
+// add: 項目に対象ファイルを追加する
+func (s *runSummary) add(key, file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = append(s.items[key], file)
+}
+
+// counts: 項目ごとの件数を返す (イベント出力用, 0 件の項目は含まない)
+func (s *runSummary) counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(s.items))
+	for key, files := range s.items {
+		counts[key] = len(files)
+	}
+	return counts
+}
+
+// snapshot: 項目ごとの対象ファイル一覧のコピーを返す (Report 用, 項目がなければ nil)
+func (s *runSummary) snapshot() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return nil
+	}
+	items := make(map[string][]string, len(s.items))
+	for key, files := range s.items {
+		items[key] = append([]string(nil), files...)
+	}
+	return items
+}
+
+// print: 実行サマリーをログに出力する (項目がなければ何もしない)
+func (s *runSummary) print(logger *log.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.items))
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	logger.Println("--- 実行サマリー ---")
+	const limit = 20 // 項目ごとの最大表示件数
+	for _, key := range keys {
+		files := s.items[key]
+		label := summaryLabels[key]
+		if label == "" {
+			label = key
+		}
+		logger.Printf("%s: %d 件", label, len(files))
+		for i, f := range files {
+			if i >= limit {
+				logger.Printf("  ...他 %d 件 (詳細はジャーナルを確認してください)", len(files)-limit)
+				break
+			}
+			logger.Printf("  %s", f)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package transav1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// VerifyMode: エンコード後の出力検証の方法 (-verify)
+type VerifyMode string
+
+const (
+	VerifyNone   VerifyMode = "none"   // 検証しない (従来の動作)
+	VerifyProbe  VerifyMode = "probe"  // ffprobe で再生時間とストリーム数を入力と比較する
+	VerifyDecode VerifyMode = "decode" // probe に加え、ffmpeg で出力全体をデコードできるか確認する
+)
+
+// VerifySuffix: 出力の検証に失敗した動画の出力パスに付与するマーカーのサフィックス
+const VerifySuffix = ".verify_failed"
+
+// ParseVerifyMode: -verify の指定値を解釈する (大文字小文字は区別しない)
+func ParseVerifyMode(s string) (VerifyMode, error) {
+	switch m := VerifyMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case VerifyNone, VerifyProbe, VerifyDecode:
+		return m, nil
+	}
+	return "", fmt.Errorf("不明な検証方法: '%s' (none, probe, decode のいずれか)", s)
+}
+
+// streamCounts: 種類ごとのストリーム数 (カバー画像は映像として数えない)
+type streamCounts struct {
+	video    int
+	audio    int
+	subtitle int
+}
+
+// countStreams: メディア情報から映像・音声・字幕ストリームの数を数える
+func countStreams(info *mediaInfo) streamCounts {
+	var c streamCounts
+	for _, s := range info.Streams {
+		switch {
+		case s.CodecType == "video" && !s.isAttachedPicture():
+			c.video++
+		case s.CodecType == "audio":
+			c.audio++
+		case s.CodecType == "subtitle":
+			c.subtitle++
+		}
+	}
+	return c
+}
+
+// verifyOutput: ffmpeg が正常終了した出力を、最終パスへ配置する前に検証する
+// job.sourceInfo (入力の ffprobe 結果) がない場合は比較できないため検証をスキップする
+func (r *run) verifyOutput(job *videoJob, outputPath string) error {
+	if r.cfg.Verify == VerifyNone {
+		return nil
+	}
+	if r.cfg.FFprobePath == "" || job.sourceInfo == nil {
+		r.debugf("入力のメディア情報がないため、出力の検証をスキップします: %s", outputPath)
+		return nil
+	}
+
+	return r.checkOutput(job.sourceInfo, outputPath, job.streams.counts)
+}
+
+// checkOutput: 出力の再生時間とストリーム数を入力と比較し、VerifyDecode の場合は出力全体をデコードして確認する
+// src: 入力のメディア情報, want: 出力に含まれるべきストリーム数 (mapStreams で選んだ数)
+// 字幕は多重化したサイドカーの分だけ多くなることがあるため、want.subtitle 以上あればよい
+func (r *run) checkOutput(src *mediaInfo, outputPath string, want streamCounts) error {
+	// --- 再生時間とストリーム数の比較 ---
+	info, err := r.probeMedia(r.ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("出力を解析できません: %w", err)
+	}
+	srcDuration, outDuration := src.duration(), info.duration()
+	tolerance := r.cfg.VerifyTolerance
+	if srcDuration > 0 {
+		diff := outDuration - srcDuration
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			return fmt.Errorf("再生時間が一致しません (入力: %s, 出力: %s, 許容差: %v)", srcDuration.Round(time.Millisecond), outDuration.Round(time.Millisecond), tolerance)
+		}
+	}
+	got := countStreams(info)
+	if got.video != want.video {
+		return fmt.Errorf("映像ストリーム数が一致しません (期待: %d, 出力: %d)", want.video, got.video)
+	}
+	if got.audio != want.audio {
+		return fmt.Errorf("音声ストリーム数が一致しません (期待: %d, 出力: %d)", want.audio, got.audio)
+	}
+	if got.subtitle < want.subtitle {
+		return fmt.Errorf("字幕ストリーム数が一致しません (期待: %d 以上, 出力: %d)", want.subtitle, got.subtitle)
+	}
+	r.debugf("出力の検証 OK (再生時間: %s, 映像: %d, 音声: %d, 字幕: %d): %s", formatClock(outDuration), got.video, got.audio, got.subtitle, outputPath)
+
+	if r.cfg.Verify != VerifyDecode {
+		return nil
+	}
+
+	// --- 出力全体のデコード確認 ---
+	ctx, cancel := r.timeoutContext(r.cfg.Timeout)
+	defer cancel()
+	return r.checkFullDecode(ctx, outputPath)
+}
+
+// checkFullDecode: ffmpeg で出力全体をデコードし (-f null)、エラーが出ないことを確認する
+func (r *run) checkFullDecode(ctx context.Context, path string) error {
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-v", "error",
+		"-xerror", // デコードエラーで即座に終了させる
+		"-i", path,
+		"-f", "null", "-",
+	}
+	cmd := exec.CommandContext(ctx, r.cfg.FFmpegPath, args...)
+	setOSSpecificAttrs(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	r.logger.Printf("出力のデコード確認中: %s", path)
+	r.debugf("デコード確認: %s %s", r.cfg.FFmpegPath, strings.Join(args, " "))
+	if err := r.startProcess(cmd, r.cfg.Priority); err != nil { // エンコードと同じ優先度で実行する
+		return fmt.Errorf("デコード確認の開始エラー: %w", err)
+	}
+	err := cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("デコード確認タイムアウト (%v経過)", r.cfg.Timeout)
+	}
+	msg := strings.TrimSpace(stderr.String())
+	if err != nil {
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("出力をデコードできません: %s", msg)
+	}
+	return nil
+}